@@ -3,6 +3,7 @@ package ast
 import (
 	"bytes"
 	"fmt"
+	"math/big"
 	"strings"
 
 	"github.com/GenericEntity/interpreter-go/monkey/token"
@@ -11,6 +12,7 @@ import (
 type Node interface {
 	TokenLiteral() string // used for debugging and testing
 	String() string
+	Span() token.Span // the source code covered by the node
 }
 
 type Statement interface {
@@ -26,6 +28,7 @@ type Expression interface {
 
 type Program struct {
 	Statements []Statement
+	Slots      int // number of local variables outside functions, i.e. in for loops (set by the resolver)
 }
 
 func (p *Program) TokenLiteral() string {
@@ -36,6 +39,16 @@ func (p *Program) TokenLiteral() string {
 	}
 }
 
+func (p *Program) Span() token.Span {
+	if len(p.Statements) == 0 {
+		return token.Span{}
+	}
+	return token.Span{
+		Start: p.Statements[0].Span().Start,
+		End:   p.Statements[len(p.Statements)-1].Span().End,
+	}
+}
+
 func (p *Program) String() string {
 	var out bytes.Buffer
 
@@ -57,6 +70,13 @@ func (ls *LetStatement) TokenLiteral() string {
 	return ls.Token.Literal
 }
 
+func (ls *LetStatement) Span() token.Span {
+	if ls.Value != nil {
+		return spanFrom(ls.Token, ls.Value)
+	}
+	return spanFrom(ls.Token, ls.Name)
+}
+
 func (ls *LetStatement) String() string {
 	var out bytes.Buffer
 
@@ -75,8 +95,27 @@ func (ls *LetStatement) String() string {
 type Identifier struct {
 	Token token.Token // the token.IDENT token
 	Value string
+
+	// where the variable is stored, set by the resolver
+	Scope Scope
+	Index int // slot of a local or free variable
+	Depth int // for a free variable, the number of functions out from the current one
 }
 
+// Scope tells where the variable named by an Identifier is stored.
+type Scope int
+
+const (
+	// ScopeUnresolved identifiers have not been resolved, and are looked up by name.
+	ScopeUnresolved Scope = iota
+	// ScopeGlobal variables are looked up by name in the global environment.
+	ScopeGlobal
+	// ScopeLocal variables are stored in a slot of the frame of the current call.
+	ScopeLocal
+	// ScopeFree variables are stored in a slot of the frame of an enclosing function.
+	ScopeFree
+)
+
 // An Identifier is an expression because for simplicity we do not distinguish identifiers
 // used in the LHS of an assignment from identifiers used in expressions.
 // We could create two identifier types to distinguish their usages.
@@ -85,6 +124,10 @@ func (i *Identifier) TokenLiteral() string {
 	return i.Token.Literal
 }
 
+func (i *Identifier) Span() token.Span {
+	return i.Token.Span
+}
+
 func (i *Identifier) String() string {
 	return i.Value
 }
@@ -99,6 +142,10 @@ func (rs *ReturnStatement) TokenLiteral() string {
 	return rs.Token.Literal
 }
 
+func (rs *ReturnStatement) Span() token.Span {
+	return spanFrom(rs.Token, rs.ReturnValue)
+}
+
 func (rs *ReturnStatement) String() string {
 	var out bytes.Buffer
 
@@ -113,6 +160,129 @@ func (rs *ReturnStatement) String() string {
 	return out.String()
 }
 
+type WhileStatement struct {
+	Token     token.Token // the 'while' token
+	Condition Expression
+	Body      *BlockStatement
+}
+
+func (ws *WhileStatement) statementNode() {}
+func (ws *WhileStatement) TokenLiteral() string {
+	return ws.Token.Literal
+}
+
+func (ws *WhileStatement) Span() token.Span {
+	if ws.Body != nil {
+		return spanFrom(ws.Token, ws.Body)
+	}
+	return spanFrom(ws.Token, ws.Condition)
+}
+
+func (ws *WhileStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("while")
+	out.WriteString(ws.Condition.String())
+	out.WriteString(" ")
+	out.WriteString(ws.Body.String())
+
+	return out.String()
+}
+
+// ForStatement is a C-style for loop, e.g. for (let i = 0; i < n; i += 1) { ... }
+// Each of Init, Condition and Post may be nil.
+type ForStatement struct {
+	Token     token.Token // the 'for' token
+	Init      Statement
+	Condition Expression
+	Post      Expression
+	Body      *BlockStatement
+}
+
+func (fs *ForStatement) statementNode() {}
+func (fs *ForStatement) TokenLiteral() string {
+	return fs.Token.Literal
+}
+
+func (fs *ForStatement) Span() token.Span {
+	return spanFrom(fs.Token, fs.Body)
+}
+
+func (fs *ForStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("for (")
+	if fs.Init != nil {
+		out.WriteString(strings.TrimSuffix(fs.Init.String(), ";"))
+	}
+	out.WriteString("; ")
+	if fs.Condition != nil {
+		out.WriteString(fs.Condition.String())
+	}
+	out.WriteString("; ")
+	if fs.Post != nil {
+		out.WriteString(fs.Post.String())
+	}
+	out.WriteString(") ")
+	out.WriteString(fs.Body.String())
+
+	return out.String()
+}
+
+// ForInStatement loops over the elements of an array or string, or the keys of a hash,
+// e.g. for (x in xs) { ... }
+// If Key is not nil, it is bound to the index of each element, or the key of each value of a hash.
+type ForInStatement struct {
+	Token    token.Token // the 'for' token
+	Key      *Identifier
+	Value    *Identifier
+	Iterable Expression
+	Body     *BlockStatement
+}
+
+func (fs *ForInStatement) statementNode() {}
+func (fs *ForInStatement) TokenLiteral() string {
+	return fs.Token.Literal
+}
+
+func (fs *ForInStatement) Span() token.Span {
+	return spanFrom(fs.Token, fs.Body)
+}
+
+func (fs *ForInStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("for (")
+	if fs.Key != nil {
+		out.WriteString(fs.Key.String() + ", ")
+	}
+	out.WriteString(fs.Value.String())
+	out.WriteString(" in ")
+	out.WriteString(fs.Iterable.String())
+	out.WriteString(") ")
+	out.WriteString(fs.Body.String())
+
+	return out.String()
+}
+
+type BreakStatement struct {
+	Token token.Token // the 'break' token
+}
+
+func (bs *BreakStatement) statementNode()       {}
+func (bs *BreakStatement) TokenLiteral() string { return bs.Token.Literal }
+func (bs *BreakStatement) Span() token.Span     { return bs.Token.Span }
+func (bs *BreakStatement) String() string       { return bs.Token.Literal + ";" }
+
+type ContinueStatement struct {
+	Token token.Token // the 'continue' token
+}
+
+func (cs *ContinueStatement) statementNode()       {}
+func (cs *ContinueStatement) TokenLiteral() string { return cs.Token.Literal }
+func (cs *ContinueStatement) Span() token.Span     { return cs.Token.Span }
+func (cs *ContinueStatement) String() string       { return cs.Token.Literal + ";" }
+
 type ExpressionStatement struct {
 	Token      token.Token // first token of expression
 	Expression Expression
@@ -123,6 +293,13 @@ func (es *ExpressionStatement) TokenLiteral() string {
 	return es.Token.Literal
 }
 
+func (es *ExpressionStatement) Span() token.Span {
+	if es.Expression != nil {
+		return es.Expression.Span()
+	}
+	return es.Token.Span
+}
+
 func (es *ExpressionStatement) String() string {
 	if es.Expression != nil {
 		return es.Expression.String()
@@ -133,6 +310,7 @@ func (es *ExpressionStatement) String() string {
 type IntegerLiteral struct {
 	Token token.Token
 	Value int64
+	Big   *big.Int // the value if it does not fit in an int64, in which case Value is 0
 }
 
 func (il *IntegerLiteral) expressionNode() {}
@@ -140,10 +318,32 @@ func (il *IntegerLiteral) TokenLiteral() string {
 	return il.Token.Literal
 }
 
+func (il *IntegerLiteral) Span() token.Span {
+	return il.Token.Span
+}
+
 func (il *IntegerLiteral) String() string {
 	return il.Token.Literal
 }
 
+type FloatLiteral struct {
+	Token token.Token
+	Value float64
+}
+
+func (fl *FloatLiteral) expressionNode() {}
+func (fl *FloatLiteral) TokenLiteral() string {
+	return fl.Token.Literal
+}
+
+func (fl *FloatLiteral) Span() token.Span {
+	return fl.Token.Span
+}
+
+func (fl *FloatLiteral) String() string {
+	return fl.Token.Literal
+}
+
 type PrefixExpression struct {
 	Token    token.Token
 	Operator string
@@ -155,6 +355,10 @@ func (pe *PrefixExpression) TokenLiteral() string {
 	return pe.Token.Literal
 }
 
+func (pe *PrefixExpression) Span() token.Span {
+	return spanFrom(pe.Token, pe.Right)
+}
+
 func (pe *PrefixExpression) String() string {
 	var out bytes.Buffer
 
@@ -178,6 +382,14 @@ func (ie *InfixExpression) TokenLiteral() string {
 	return ie.Token.Literal
 }
 
+func (ie *InfixExpression) Span() token.Span {
+	span := spanFrom(ie.Token, ie.Right)
+	if ie.Left != nil {
+		span.Start = ie.Left.Span().Start
+	}
+	return span
+}
+
 func (ie *InfixExpression) String() string {
 	var out bytes.Buffer
 
@@ -190,6 +402,39 @@ func (ie *InfixExpression) String() string {
 	return out.String()
 }
 
+// AssignExpression updates an existing variable, e.g. x = 5 or x += 1.
+type AssignExpression struct {
+	Token    token.Token // The assignment operator token, e.g. = or +=
+	Name     *Identifier
+	Operator string
+	Value    Expression
+}
+
+func (ae *AssignExpression) expressionNode() {}
+func (ae *AssignExpression) TokenLiteral() string {
+	return ae.Token.Literal
+}
+
+func (ae *AssignExpression) Span() token.Span {
+	span := spanFrom(ae.Token, ae.Value)
+	if ae.Name != nil {
+		span.Start = ae.Name.Span().Start
+	}
+	return span
+}
+
+func (ae *AssignExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("(")
+	out.WriteString(ae.Name.String())
+	out.WriteString(" " + ae.Operator + " ")
+	out.WriteString(ae.Value.String())
+	out.WriteString(")")
+
+	return out.String()
+}
+
 type Boolean struct {
 	Token token.Token
 	Value bool
@@ -198,6 +443,7 @@ type Boolean struct {
 func (b *Boolean) expressionNode()      {}
 func (b *Boolean) TokenLiteral() string { return b.Token.Literal }
 func (b *Boolean) String() string       { return b.Token.Literal }
+func (b *Boolean) Span() token.Span     { return b.Token.Span }
 
 type IfExpression struct {
 	Token       token.Token // the 'if' token
@@ -210,6 +456,15 @@ func (ie *IfExpression) expressionNode() {}
 func (ie *IfExpression) TokenLiteral() string {
 	return ie.Token.Literal
 }
+func (ie *IfExpression) Span() token.Span {
+	if ie.Alternative != nil {
+		return spanFrom(ie.Token, ie.Alternative)
+	}
+	if ie.Consequence != nil {
+		return spanFrom(ie.Token, ie.Consequence)
+	}
+	return spanFrom(ie.Token, ie.Condition)
+}
 func (ie *IfExpression) String() string {
 	var out bytes.Buffer
 
@@ -227,14 +482,18 @@ func (ie *IfExpression) String() string {
 }
 
 type BlockStatement struct {
-	Token      token.Token
+	Token      token.Token // the "{" token
 	Statements []Statement
+	RBrace     token.Token // the "}" token
 }
 
 func (bs *BlockStatement) statementNode() {}
 func (bs *BlockStatement) TokenLiteral() string {
 	return bs.Token.Literal
 }
+func (bs *BlockStatement) Span() token.Span {
+	return token.Span{Start: bs.Token.Span.Start, End: bs.RBrace.Span.End}
+}
 func (bs *BlockStatement) String() string {
 	var out bytes.Buffer
 
@@ -251,12 +510,20 @@ type FunctionLiteral struct {
 	Token      token.Token
 	Parameters []*Identifier
 	Body       *BlockStatement
+	Name       string // the name the function is bound to with let, if any
+	Slots      int    // number of local variables of a call, including parameters (set by the resolver)
 }
 
 func (fl *FunctionLiteral) expressionNode() {}
 func (fl *FunctionLiteral) TokenLiteral() string {
 	return fl.Token.Literal
 }
+func (fl *FunctionLiteral) Span() token.Span {
+	if fl.Body != nil {
+		return spanFrom(fl.Token, fl.Body)
+	}
+	return fl.Token.Span
+}
 func (fl *FunctionLiteral) String() string {
 	var out bytes.Buffer
 
@@ -274,16 +541,58 @@ func (fl *FunctionLiteral) String() string {
 	return out.String()
 }
 
+// MacroLiteral is a macro, which is expanded before the program runs (see evaluator.ExpandMacros).
+type MacroLiteral struct {
+	Token      token.Token // the "macro" token
+	Parameters []*Identifier
+	Body       *BlockStatement
+}
+
+func (ml *MacroLiteral) expressionNode() {}
+func (ml *MacroLiteral) TokenLiteral() string {
+	return ml.Token.Literal
+}
+func (ml *MacroLiteral) Span() token.Span {
+	if ml.Body != nil {
+		return spanFrom(ml.Token, ml.Body)
+	}
+	return ml.Token.Span
+}
+func (ml *MacroLiteral) String() string {
+	var out bytes.Buffer
+
+	params := []string{}
+	for _, p := range ml.Parameters {
+		params = append(params, p.String())
+	}
+
+	out.WriteString(ml.TokenLiteral())
+	out.WriteString("(")
+	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(")")
+	out.WriteString(ml.Body.String())
+
+	return out.String()
+}
+
 type CallExpression struct {
 	Token     token.Token // the "(" token
 	Function  Expression  // identifier or function literal
 	Arguments []Expression
+	RParen    token.Token // the ")" token
 }
 
 func (ce *CallExpression) expressionNode() {}
 func (ce *CallExpression) TokenLiteral() string {
 	return ce.Token.Literal
 }
+func (ce *CallExpression) Span() token.Span {
+	span := token.Span{Start: ce.Token.Span.Start, End: ce.RParen.Span.End}
+	if ce.Function != nil {
+		span.Start = ce.Function.Span().Start
+	}
+	return span
+}
 func (ce *CallExpression) String() string {
 	var out bytes.Buffer
 
@@ -309,6 +618,9 @@ func (sl *StringLiteral) expressionNode() {}
 func (sl *StringLiteral) TokenLiteral() string {
 	return sl.Token.Literal
 }
+func (sl *StringLiteral) Span() token.Span {
+	return sl.Token.Span
+}
 func (sl *StringLiteral) String() string {
 	return sl.Token.Literal
 }
@@ -316,12 +628,16 @@ func (sl *StringLiteral) String() string {
 type ArrayLiteral struct {
 	Token    token.Token // the "[" literal
 	Elements []Expression
+	RBracket token.Token // the "]" literal
 }
 
 func (al *ArrayLiteral) expressionNode() {}
 func (al *ArrayLiteral) TokenLiteral() string {
 	return al.Token.Literal
 }
+func (al *ArrayLiteral) Span() token.Span {
+	return token.Span{Start: al.Token.Span.Start, End: al.RBracket.Span.End}
+}
 func (al *ArrayLiteral) String() string {
 	var out bytes.Buffer
 
@@ -339,15 +655,23 @@ func (al *ArrayLiteral) String() string {
 }
 
 type SubscriptExpression struct {
-	Token token.Token // the "[" literal
-	Left  Expression
-	Index Expression
+	Token    token.Token // the "[" literal
+	Left     Expression
+	Index    Expression
+	RBracket token.Token // the "]" literal
 }
 
 func (se *SubscriptExpression) expressionNode() {}
 func (se *SubscriptExpression) TokenLiteral() string {
 	return se.Token.Literal
 }
+func (se *SubscriptExpression) Span() token.Span {
+	span := token.Span{Start: se.Token.Span.Start, End: se.RBracket.Span.End}
+	if se.Left != nil {
+		span.Start = se.Left.Span().Start
+	}
+	return span
+}
 func (se *SubscriptExpression) String() string {
 	var out bytes.Buffer
 
@@ -361,20 +685,24 @@ func (se *SubscriptExpression) String() string {
 }
 
 type HashLiteral struct {
-	Token token.Token // the "{" literal
-	Pairs map[Expression]Expression
+	Token  token.Token // the "{" literal
+	Pairs  map[Expression]Expression
+	RBrace token.Token // the "}" literal
 }
 
 func (hl *HashLiteral) expressionNode() {}
 func (hl *HashLiteral) TokenLiteral() string {
 	return hl.Token.Literal
 }
+func (hl *HashLiteral) Span() token.Span {
+	return token.Span{Start: hl.Token.Span.Start, End: hl.RBrace.Span.End}
+}
 func (hl *HashLiteral) String() string {
 	var out bytes.Buffer
 
-	pairs := make([]string, len(hl.Pairs))
-	for key, val := range hl.Pairs {
-		pairs = append(pairs, fmt.Sprintf("%s: %s", key, val))
+	pairs := make([]string, 0, len(hl.Pairs))
+	for _, key := range sortedKeys(hl.Pairs) {
+		pairs = append(pairs, fmt.Sprintf("%s: %s", key, hl.Pairs[key]))
 	}
 
 	out.WriteString("{")
@@ -383,3 +711,13 @@ func (hl *HashLiteral) String() string {
 
 	return out.String()
 }
+
+// spanFrom returns the span from the start of tok to the end of last.
+// If last is missing (e.g. after a parse error), only the span of tok is returned.
+func spanFrom(tok token.Token, last Node) token.Span {
+	span := tok.Span
+	if last != nil {
+		span.End = last.Span().End
+	}
+	return span
+}
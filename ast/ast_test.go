@@ -27,3 +27,55 @@ func TestString(t *testing.T) {
 		t.Errorf("program.String() wrong. got=%q", program.String())
 	}
 }
+
+func TestHashLiteralString(t *testing.T) {
+	ident := func(name string, offset int) *Identifier {
+		span := token.Span{Start: token.Position{Offset: offset}}
+		return &Identifier{Token: token.Token{Type: token.IDENT, Literal: name, Span: span}, Value: name}
+	}
+
+	tests := []struct {
+		hash     *HashLiteral
+		expected string
+	}{
+		{&HashLiteral{Pairs: map[Expression]Expression{}}, "{}"},
+		{&HashLiteral{Pairs: map[Expression]Expression{ident("b", 7): ident("c", 10), ident("a", 1): ident("d", 4)}}, "{a: d, b: c}"},
+	}
+
+	for _, tt := range tests {
+		if tt.hash.String() != tt.expected {
+			t.Errorf("hash.String() wrong. expected=%q, got=%q", tt.expected, tt.hash.String())
+		}
+	}
+}
+
+func TestInfixExpressionSpan(t *testing.T) {
+	left := &Identifier{
+		Token: token.Token{Type: token.IDENT, Literal: "a", Span: token.Span{
+			Start: token.Position{Offset: 0, Line: 1, Column: 1},
+			End:   token.Position{Offset: 1, Line: 1, Column: 2},
+		}},
+		Value: "a",
+	}
+	right := &Identifier{
+		Token: token.Token{Type: token.IDENT, Literal: "b", Span: token.Span{
+			Start: token.Position{Offset: 4, Line: 1, Column: 5},
+			End:   token.Position{Offset: 5, Line: 1, Column: 6},
+		}},
+		Value: "b",
+	}
+	expr := &InfixExpression{
+		Token:    token.Token{Type: token.PLUS, Literal: "+"},
+		Left:     left,
+		Operator: "+",
+		Right:    right,
+	}
+
+	span := expr.Span()
+	if span.Start != left.Token.Span.Start {
+		t.Errorf("span does not start at left operand. got=%+v", span.Start)
+	}
+	if span.End != right.Token.Span.End {
+		t.Errorf("span does not end at right operand. got=%+v", span.End)
+	}
+}
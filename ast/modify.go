@@ -0,0 +1,222 @@
+package ast
+
+import "fmt"
+
+// ModifierFunc returns the node that replaces node.
+type ModifierFunc func(node Node) Node
+
+// Modify returns a copy of node in which every node, starting from the innermost ones, is replaced by
+// what modifier returns for it. node itself is left unchanged, so it can be modified again,
+// e.g. when a macro body is expanded more than once.
+//
+// modifier must replace statements by statements, expressions by expressions, and identifiers and
+// block statements by nodes of the same type. Nodes of types declared outside this package are passed
+// to modifier as they are, as if they had no children. Modify panics on nodes of types declared in this
+// package that it does not support.
+func Modify(node Node, modifier ModifierFunc) Node {
+	switch node := node.(type) {
+	case *Program:
+		copied := *node
+		copied.Statements = modifyStatements(node.Statements, modifier)
+		return modifier(&copied)
+
+	case *ExpressionStatement:
+		copied := *node
+		copied.Expression = modifyExpression(node.Expression, modifier)
+		return modifier(&copied)
+
+	case *BlockStatement:
+		copied := *node
+		copied.Statements = modifyStatements(node.Statements, modifier)
+		return modifier(&copied)
+
+	case *LetStatement:
+		copied := *node
+		copied.Name = modifyIdentifier(node.Name, modifier)
+		copied.Value = modifyExpression(node.Value, modifier)
+		return modifier(&copied)
+
+	case *ReturnStatement:
+		copied := *node
+		copied.ReturnValue = modifyExpression(node.ReturnValue, modifier)
+		return modifier(&copied)
+
+	case *WhileStatement:
+		copied := *node
+		copied.Condition = modifyExpression(node.Condition, modifier)
+		copied.Body = modifyBlock(node.Body, modifier)
+		return modifier(&copied)
+
+	case *ForStatement:
+		copied := *node
+		copied.Init = modifyStatement(node.Init, modifier)
+		copied.Condition = modifyExpression(node.Condition, modifier)
+		copied.Post = modifyExpression(node.Post, modifier)
+		copied.Body = modifyBlock(node.Body, modifier)
+		return modifier(&copied)
+
+	case *ForInStatement:
+		copied := *node
+		copied.Key = modifyIdentifier(node.Key, modifier)
+		copied.Value = modifyIdentifier(node.Value, modifier)
+		copied.Iterable = modifyExpression(node.Iterable, modifier)
+		copied.Body = modifyBlock(node.Body, modifier)
+		return modifier(&copied)
+
+	case *BreakStatement:
+		copied := *node
+		return modifier(&copied)
+
+	case *ContinueStatement:
+		copied := *node
+		return modifier(&copied)
+
+	case *Identifier:
+		copied := *node
+		return modifier(&copied)
+
+	case *IntegerLiteral:
+		copied := *node
+		return modifier(&copied)
+
+	case *FloatLiteral:
+		copied := *node
+		return modifier(&copied)
+
+	case *StringLiteral:
+		copied := *node
+		return modifier(&copied)
+
+	case *Boolean:
+		copied := *node
+		return modifier(&copied)
+
+	case *PrefixExpression:
+		copied := *node
+		copied.Right = modifyExpression(node.Right, modifier)
+		return modifier(&copied)
+
+	case *InfixExpression:
+		copied := *node
+		copied.Left = modifyExpression(node.Left, modifier)
+		copied.Right = modifyExpression(node.Right, modifier)
+		return modifier(&copied)
+
+	case *AssignExpression:
+		copied := *node
+		copied.Name = modifyIdentifier(node.Name, modifier)
+		copied.Value = modifyExpression(node.Value, modifier)
+		return modifier(&copied)
+
+	case *IfExpression:
+		copied := *node
+		copied.Condition = modifyExpression(node.Condition, modifier)
+		copied.Consequence = modifyBlock(node.Consequence, modifier)
+		copied.Alternative = modifyBlock(node.Alternative, modifier)
+		return modifier(&copied)
+
+	case *FunctionLiteral:
+		copied := *node
+		copied.Parameters = modifyIdentifiers(node.Parameters, modifier)
+		copied.Body = modifyBlock(node.Body, modifier)
+		return modifier(&copied)
+
+	case *MacroLiteral:
+		copied := *node
+		copied.Parameters = modifyIdentifiers(node.Parameters, modifier)
+		copied.Body = modifyBlock(node.Body, modifier)
+		return modifier(&copied)
+
+	case *CallExpression:
+		copied := *node
+		copied.Function = modifyExpression(node.Function, modifier)
+		copied.Arguments = modifyExpressions(node.Arguments, modifier)
+		return modifier(&copied)
+
+	case *ArrayLiteral:
+		copied := *node
+		copied.Elements = modifyExpressions(node.Elements, modifier)
+		return modifier(&copied)
+
+	case *SubscriptExpression:
+		copied := *node
+		copied.Left = modifyExpression(node.Left, modifier)
+		copied.Index = modifyExpression(node.Index, modifier)
+		return modifier(&copied)
+
+	case *HashLiteral:
+		copied := *node
+		copied.Pairs = make(map[Expression]Expression, len(node.Pairs))
+		for _, key := range sortedKeys(node.Pairs) {
+			copied.Pairs[modifyExpression(key, modifier)] = modifyExpression(node.Pairs[key], modifier)
+		}
+		return modifier(&copied)
+
+	default:
+		if isExternal(node) {
+			return modifier(node)
+		}
+		panic(fmt.Sprintf("ast.Modify: unexpected node type %T", node))
+	}
+}
+
+func modifyStatement(stmt Statement, modifier ModifierFunc) Statement {
+	if stmt == nil {
+		return nil
+	}
+	return Modify(stmt, modifier).(Statement)
+}
+
+func modifyExpression(exp Expression, modifier ModifierFunc) Expression {
+	if exp == nil {
+		return nil
+	}
+	return Modify(exp, modifier).(Expression)
+}
+
+func modifyIdentifier(ident *Identifier, modifier ModifierFunc) *Identifier {
+	if ident == nil {
+		return nil
+	}
+	return Modify(ident, modifier).(*Identifier)
+}
+
+func modifyBlock(block *BlockStatement, modifier ModifierFunc) *BlockStatement {
+	if block == nil {
+		return nil
+	}
+	return Modify(block, modifier).(*BlockStatement)
+}
+
+func modifyStatements(stmts []Statement, modifier ModifierFunc) []Statement {
+	if stmts == nil {
+		return nil
+	}
+	modified := make([]Statement, len(stmts))
+	for i, stmt := range stmts {
+		modified[i] = modifyStatement(stmt, modifier)
+	}
+	return modified
+}
+
+func modifyExpressions(exps []Expression, modifier ModifierFunc) []Expression {
+	if exps == nil {
+		return nil
+	}
+	modified := make([]Expression, len(exps))
+	for i, exp := range exps {
+		modified[i] = modifyExpression(exp, modifier)
+	}
+	return modified
+}
+
+func modifyIdentifiers(idents []*Identifier, modifier ModifierFunc) []*Identifier {
+	if idents == nil {
+		return nil
+	}
+	modified := make([]*Identifier, len(idents))
+	for i, ident := range idents {
+		modified[i] = modifyIdentifier(ident, modifier)
+	}
+	return modified
+}
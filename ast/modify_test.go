@@ -0,0 +1,94 @@
+package ast
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestModify(t *testing.T) {
+	one := func() Expression { return &IntegerLiteral{Value: 1} }
+	two := func() Expression { return &IntegerLiteral{Value: 2} }
+	ident := func(name string) *Identifier { return &Identifier{Value: name} }
+
+	turnOneIntoTwo := func(node Node) Node {
+		integer, ok := node.(*IntegerLiteral)
+		if !ok || integer.Value != 1 {
+			return node
+		}
+		return &IntegerLiteral{Value: 2}
+	}
+
+	tests := []struct {
+		input    Node
+		expected Node
+	}{
+		{one(), two()},
+		{
+			&Program{Statements: []Statement{&ExpressionStatement{Expression: one()}}},
+			&Program{Statements: []Statement{&ExpressionStatement{Expression: two()}}},
+		},
+		{&InfixExpression{Left: one(), Operator: "+", Right: two()}, &InfixExpression{Left: two(), Operator: "+", Right: two()}},
+		{&InfixExpression{Left: two(), Operator: "+", Right: one()}, &InfixExpression{Left: two(), Operator: "+", Right: two()}},
+		{&PrefixExpression{Operator: "-", Right: one()}, &PrefixExpression{Operator: "-", Right: two()}},
+		{&SubscriptExpression{Left: one(), Index: one()}, &SubscriptExpression{Left: two(), Index: two()}},
+		{
+			&IfExpression{
+				Condition:   one(),
+				Consequence: &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: one()}}},
+				Alternative: &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: one()}}},
+			},
+			&IfExpression{
+				Condition:   two(),
+				Consequence: &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: two()}}},
+				Alternative: &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: two()}}},
+			},
+		},
+		{&ReturnStatement{ReturnValue: one()}, &ReturnStatement{ReturnValue: two()}},
+		{&LetStatement{Name: ident("x"), Value: one()}, &LetStatement{Name: ident("x"), Value: two()}},
+		{&AssignExpression{Name: ident("x"), Operator: "=", Value: one()}, &AssignExpression{Name: ident("x"), Operator: "=", Value: two()}},
+		{
+			&FunctionLiteral{
+				Parameters: []*Identifier{ident("x")},
+				Body:       &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: one()}}},
+			},
+			&FunctionLiteral{
+				Parameters: []*Identifier{ident("x")},
+				Body:       &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: two()}}},
+			},
+		},
+		{&CallExpression{Function: ident("f"), Arguments: []Expression{one(), two()}}, &CallExpression{Function: ident("f"), Arguments: []Expression{two(), two()}}},
+		{&ArrayLiteral{Elements: []Expression{one(), one()}}, &ArrayLiteral{Elements: []Expression{two(), two()}}},
+		{
+			&WhileStatement{Condition: one(), Body: &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: one()}}}},
+			&WhileStatement{Condition: two(), Body: &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: two()}}}},
+		},
+		{
+			&ForStatement{Condition: one(), Post: one(), Body: &BlockStatement{}},
+			&ForStatement{Condition: two(), Post: two(), Body: &BlockStatement{}},
+		},
+		{
+			&ForInStatement{Value: ident("x"), Iterable: one(), Body: &BlockStatement{}},
+			&ForInStatement{Value: ident("x"), Iterable: two(), Body: &BlockStatement{}},
+		},
+	}
+
+	for _, tt := range tests {
+		before := tt.input.String()
+
+		modified := Modify(tt.input, turnOneIntoTwo)
+		if !reflect.DeepEqual(modified, tt.expected) {
+			t.Errorf("not equal. got=%#v, want=%#v", modified, tt.expected)
+		}
+		if tt.input.String() != before {
+			t.Errorf("input modified in place. got=%s, want=%s", tt.input.String(), before)
+		}
+	}
+
+	hashLiteral := &HashLiteral{Pairs: map[Expression]Expression{one(): one(), one(): one()}}
+	modified := Modify(hashLiteral, turnOneIntoTwo).(*HashLiteral)
+	for key, val := range modified.Pairs {
+		if key.(*IntegerLiteral).Value != 2 || val.(*IntegerLiteral).Value != 2 {
+			t.Errorf("pair not modified. got=%s: %s", key, val)
+		}
+	}
+}
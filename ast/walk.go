@@ -0,0 +1,206 @@
+package ast
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// Visitor visits the nodes of a syntax tree (see Walk).
+type Visitor interface {
+	// Visit visits node, returning the visitor for its children, or nil to skip them.
+	Visit(node Node) (w Visitor)
+}
+
+// Walk traverses a syntax tree in depth-first order, in the order the nodes appear in the source.
+// It calls v.Visit(node), and unless that returns nil, walks each of the children of node with the
+// visitor w it returned, followed by a call of w.Visit(nil).
+// Nodes of types declared outside this package are walked as if they had no children.
+// Walk panics on nodes of types declared in this package that it does not support.
+func Walk(v Visitor, node Node) {
+	if v = v.Visit(node); v == nil {
+		return
+	}
+
+	switch n := node.(type) {
+	case *Program:
+		walkStatements(v, n.Statements)
+
+	case *ExpressionStatement:
+		walkIfPresent(v, n.Expression)
+
+	case *BlockStatement:
+		walkStatements(v, n.Statements)
+
+	case *LetStatement:
+		walkIfPresent(v, n.Name)
+		walkIfPresent(v, n.Value)
+
+	case *ReturnStatement:
+		walkIfPresent(v, n.ReturnValue)
+
+	case *WhileStatement:
+		walkIfPresent(v, n.Condition)
+		walkIfPresent(v, n.Body)
+
+	case *ForStatement:
+		walkIfPresent(v, n.Init)
+		walkIfPresent(v, n.Condition)
+		walkIfPresent(v, n.Post)
+		walkIfPresent(v, n.Body)
+
+	case *ForInStatement:
+		walkIfPresent(v, n.Key)
+		walkIfPresent(v, n.Value)
+		walkIfPresent(v, n.Iterable)
+		walkIfPresent(v, n.Body)
+
+	case *BreakStatement, *ContinueStatement:
+		// no children
+
+	case *Identifier, *IntegerLiteral, *FloatLiteral, *StringLiteral, *Boolean:
+		// no children
+
+	case *PrefixExpression:
+		walkIfPresent(v, n.Right)
+
+	case *InfixExpression:
+		walkIfPresent(v, n.Left)
+		walkIfPresent(v, n.Right)
+
+	case *AssignExpression:
+		walkIfPresent(v, n.Name)
+		walkIfPresent(v, n.Value)
+
+	case *IfExpression:
+		walkIfPresent(v, n.Condition)
+		walkIfPresent(v, n.Consequence)
+		walkIfPresent(v, n.Alternative)
+
+	case *FunctionLiteral:
+		for _, param := range n.Parameters {
+			walkIfPresent(v, param)
+		}
+		walkIfPresent(v, n.Body)
+
+	case *MacroLiteral:
+		for _, param := range n.Parameters {
+			walkIfPresent(v, param)
+		}
+		walkIfPresent(v, n.Body)
+
+	case *CallExpression:
+		walkIfPresent(v, n.Function)
+		walkExpressions(v, n.Arguments)
+
+	case *ArrayLiteral:
+		walkExpressions(v, n.Elements)
+
+	case *SubscriptExpression:
+		walkIfPresent(v, n.Left)
+		walkIfPresent(v, n.Index)
+
+	case *HashLiteral:
+		for _, key := range sortedKeys(n.Pairs) {
+			walkIfPresent(v, key)
+			walkIfPresent(v, n.Pairs[key])
+		}
+
+	default:
+		// the children of external node types are unknown, but those of this package must all be walked
+		if !isExternal(node) {
+			panic(fmt.Sprintf("ast.Walk: unexpected node type %T", node))
+		}
+	}
+
+	v.Visit(nil)
+}
+
+// packagePath is the import path of this package.
+var packagePath = reflect.TypeOf(Program{}).PkgPath()
+
+// isExternal reports whether node is of a type declared outside this package.
+func isExternal(node Node) bool {
+	t := reflect.TypeOf(node)
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.PkgPath() != packagePath
+}
+
+// walkIfPresent walks node unless it is missing, e.g. an optional child or after a parse error.
+func walkIfPresent(v Visitor, node Node) {
+	if !isMissing(node) {
+		Walk(v, node)
+	}
+}
+
+func walkStatements(v Visitor, stmts []Statement) {
+	for _, stmt := range stmts {
+		walkIfPresent(v, stmt)
+	}
+}
+
+func walkExpressions(v Visitor, exps []Expression) {
+	for _, exp := range exps {
+		walkIfPresent(v, exp)
+	}
+}
+
+// isMissing reports whether node is nil, including a nil pointer to a node.
+func isMissing(node Node) bool {
+	switch n := node.(type) {
+	case nil:
+		return true
+	case *Identifier:
+		return n == nil
+	case *BlockStatement:
+		return n == nil
+	default:
+		return false
+	}
+}
+
+// sortedKeys returns the keys of the pairs of a hash literal in the order they appear in the source.
+// Keys at the same position, e.g. built by Modify, are ordered by their source code and that of their values,
+// so that the order does not depend on that of the map.
+func sortedKeys(pairs map[Expression]Expression) []Expression {
+	keys := make([]Expression, 0, len(pairs))
+	for key := range pairs {
+		keys = append(keys, key)
+	}
+	sort.SliceStable(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.Span().Start.Offset != b.Span().Start.Offset {
+			return a.Span().Start.Offset < b.Span().Start.Offset
+		}
+		if nodeString(a) != nodeString(b) {
+			return nodeString(a) < nodeString(b)
+		}
+		return nodeString(pairs[a]) < nodeString(pairs[b])
+	})
+	return keys
+}
+
+// nodeString returns the source code of node, which is empty if it is missing.
+func nodeString(node Node) string {
+	if isMissing(node) {
+		return ""
+	}
+	return node.String()
+}
+
+type inspector func(Node) bool
+
+func (f inspector) Visit(node Node) Visitor {
+	if f(node) {
+		return f
+	}
+	return nil
+}
+
+// Inspect traverses a syntax tree like Walk, calling f(node) for each node, which returns
+// whether to inspect the children of node. After the children, f(nil) is called.
+func Inspect(node Node, f func(Node) bool) {
+	Walk(inspector(f), node)
+}
@@ -0,0 +1,311 @@
+package ast
+
+import (
+	goast "go/ast"
+	"go/parser"
+	gotoken "go/token"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/GenericEntity/interpreter-go/monkey/token"
+)
+
+// samples returns a node of every type, with all of its children present.
+func samples() []Node {
+	ident := func() *Identifier { return &Identifier{Value: "x"} }
+	integer := func() *IntegerLiteral { return &IntegerLiteral{Value: 1} }
+	block := func() *BlockStatement {
+		return &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: integer()}}}
+	}
+
+	return []Node{
+		&Program{Statements: []Statement{&ExpressionStatement{Expression: integer()}, &BreakStatement{}}},
+		&ExpressionStatement{Expression: integer()},
+		block(),
+		&LetStatement{Name: ident(), Value: integer()},
+		&ReturnStatement{ReturnValue: integer()},
+		&WhileStatement{Condition: ident(), Body: block()},
+		&ForStatement{Init: &LetStatement{Name: ident(), Value: integer()}, Condition: ident(), Post: ident(), Body: block()},
+		&ForInStatement{Key: ident(), Value: ident(), Iterable: ident(), Body: block()},
+		&BreakStatement{},
+		&ContinueStatement{},
+		ident(),
+		integer(),
+		&FloatLiteral{Value: 1.5},
+		&StringLiteral{Value: "s"},
+		&Boolean{Value: true},
+		&PrefixExpression{Operator: "-", Right: integer()},
+		&InfixExpression{Left: integer(), Operator: "+", Right: ident()},
+		&AssignExpression{Name: ident(), Operator: "=", Value: integer()},
+		&IfExpression{Condition: ident(), Consequence: block(), Alternative: block()},
+		&FunctionLiteral{Parameters: []*Identifier{ident(), ident()}, Body: block()},
+		&MacroLiteral{Parameters: []*Identifier{ident()}, Body: block()},
+		&CallExpression{Function: ident(), Arguments: []Expression{integer(), ident()}},
+		&ArrayLiteral{Elements: []Expression{integer(), ident()}},
+		&SubscriptExpression{Left: ident(), Index: integer()},
+		&HashLiteral{Pairs: map[Expression]Expression{ident(): integer(), integer(): ident()}},
+	}
+}
+
+// nodeTypes returns the names of the node types declared in this package,
+// which are those with a TokenLiteral method.
+func nodeTypes(t *testing.T) map[string]bool {
+	pkgs, err := parser.ParseDir(gotoken.NewFileSet(), ".", nil, 0)
+	if err != nil {
+		t.Fatalf("cannot parse package ast: %v", err)
+	}
+
+	types := map[string]bool{}
+	for _, pkg := range pkgs {
+		for name, file := range pkg.Files {
+			if strings.HasSuffix(name, "_test.go") {
+				continue
+			}
+			for _, decl := range file.Decls {
+				fn, ok := decl.(*goast.FuncDecl)
+				if !ok || fn.Recv == nil || fn.Name.Name != "TokenLiteral" {
+					continue
+				}
+				if star, ok := fn.Recv.List[0].Type.(*goast.StarExpr); ok {
+					types[star.X.(*goast.Ident).Name] = true
+				}
+			}
+		}
+	}
+	return types
+}
+
+// children returns the child nodes of node, failing if any is missing from a sample.
+func children(t *testing.T, node Node) []Node {
+	nodeType := reflect.TypeOf((*Node)(nil)).Elem()
+
+	var found []Node
+	value := reflect.ValueOf(node).Elem()
+	for i := 0; i < value.NumField(); i++ {
+		field, name := value.Field(i), value.Type().Field(i).Name
+
+		switch {
+		case field.Type().Implements(nodeType):
+			if field.IsNil() {
+				t.Errorf("%s of sample %T is missing", name, node)
+				continue
+			}
+			found = append(found, field.Interface().(Node))
+
+		case field.Kind() == reflect.Slice && field.Type().Elem().Implements(nodeType):
+			if field.Len() == 0 {
+				t.Errorf("%s of sample %T is empty", name, node)
+			}
+			for j := 0; j < field.Len(); j++ {
+				found = append(found, field.Index(j).Interface().(Node))
+			}
+
+		case field.Kind() == reflect.Map && field.Type().Key().Implements(nodeType):
+			if field.Len() == 0 {
+				t.Errorf("%s of sample %T is empty", name, node)
+			}
+			for _, key := range field.MapKeys() {
+				found = append(found, key.Interface().(Node), field.MapIndex(key).Interface().(Node))
+			}
+		}
+	}
+	return found
+}
+
+func containsNode(nodes []Node, node Node) bool {
+	for _, n := range nodes {
+		if n == node {
+			return true
+		}
+	}
+	return false
+}
+
+func TestSamplesCoverAllNodeTypes(t *testing.T) {
+	sampled := map[string]bool{}
+	for _, sample := range samples() {
+		sampled[reflect.TypeOf(sample).Elem().Name()] = true
+	}
+
+	for name := range nodeTypes(t) {
+		if !sampled[name] {
+			t.Errorf("no sample of node type %s. add one to samples(), and support it in Walk and Modify", name)
+		}
+	}
+}
+
+func TestWalkVisitsAllChildren(t *testing.T) {
+	for _, sample := range samples() {
+		expected := children(t, sample)
+
+		var visited []Node
+		Inspect(sample, func(node Node) bool {
+			if node == sample {
+				return true
+			}
+			if node != nil {
+				visited = append(visited, node)
+			}
+			return false
+		})
+
+		if len(visited) != len(expected) {
+			t.Errorf("wrong number of children of %T visited. expected=%d, got=%d", sample, len(expected), len(visited))
+		}
+		for _, child := range expected {
+			if !containsNode(visited, child) {
+				t.Errorf("child %T of %T not visited", child, sample)
+			}
+		}
+	}
+}
+
+func TestModifyModifiesAllChildren(t *testing.T) {
+	for _, sample := range samples() {
+		original := children(t, sample)
+
+		var modified []Node
+		result := Modify(sample, func(node Node) Node {
+			modified = append(modified, node)
+			return node
+		})
+
+		if reflect.TypeOf(result) != reflect.TypeOf(sample) || result == sample {
+			t.Errorf("%T not copied. got=%T", sample, result)
+			continue
+		}
+		if result.String() != sample.String() {
+			t.Errorf("copy of %T differs. expected=%q, got=%q", sample, sample.String(), result.String())
+		}
+
+		// every child is replaced by a copy that was passed to the modifier
+		copies := children(t, result)
+		if len(copies) != len(original) {
+			t.Errorf("wrong number of children of %T. expected=%d, got=%d", sample, len(original), len(copies))
+		}
+		for _, child := range copies {
+			if containsNode(original, child) {
+				t.Errorf("child %T of %T not copied", child, sample)
+			}
+			if !containsNode(modified, child) {
+				t.Errorf("child %T of %T not modified", child, sample)
+			}
+		}
+	}
+}
+
+func TestInspectOrder(t *testing.T) {
+	ident := func(name string, offset int) *Identifier {
+		span := token.Span{Start: token.Position{Offset: offset, Line: 1, Column: offset + 1}}
+		return &Identifier{Token: token.Token{Type: token.IDENT, Literal: name, Span: span}, Value: name}
+	}
+
+	// for (k, v in {b: c, a: d}) { e(f) }
+	program := &Program{Statements: []Statement{
+		&ForInStatement{
+			Key:   ident("k", 5),
+			Value: ident("v", 8),
+			Iterable: &HashLiteral{Pairs: map[Expression]Expression{
+				ident("a", 20): ident("d", 23),
+				ident("b", 14): ident("c", 17),
+			}},
+			Body: &BlockStatement{Statements: []Statement{
+				&ExpressionStatement{Expression: &CallExpression{Function: ident("e", 29), Arguments: []Expression{ident("f", 31)}}},
+			}},
+		},
+	}}
+
+	var names []string
+	Inspect(program, func(node Node) bool {
+		if ident, ok := node.(*Identifier); ok {
+			names = append(names, ident.Value)
+		}
+		_, isCall := node.(*CallExpression)
+		return !isCall
+	})
+
+	if strings.Join(names, " ") != "k v b c a d" {
+		t.Errorf("wrong order of identifiers. expected=%q, got=%q", "k v b c a d", strings.Join(names, " "))
+	}
+}
+
+func TestInspectOrderWithoutPositions(t *testing.T) {
+	ident := func(name string) *Identifier {
+		return &Identifier{Token: token.Token{Type: token.IDENT, Literal: name}, Value: name}
+	}
+
+	// keys built without positions, e.g. by Modify, are ordered by their source code, then that of their values
+	for i := 0; i < 20; i++ {
+		hash := &HashLiteral{Pairs: map[Expression]Expression{
+			ident("y"): ident("a"),
+			ident("x"): ident("c"),
+			ident("x"): ident("b"),
+		}}
+
+		var names []string
+		Inspect(hash, func(node Node) bool {
+			if ident, ok := node.(*Identifier); ok {
+				names = append(names, ident.Value)
+			}
+			return true
+		})
+
+		if strings.Join(names, " ") != "x b x c y a" {
+			t.Fatalf("wrong order of identifiers. expected=%q, got=%q", "x b x c y a", strings.Join(names, " "))
+		}
+	}
+}
+
+func TestWalkExternalNode(t *testing.T) {
+	// an unnamed type is not declared in this package, like the node types of other packages
+	node := &struct{ Identifier }{}
+	program := &Program{Statements: []Statement{&ExpressionStatement{Expression: node}}}
+
+	var visited []Node
+	Inspect(program, func(n Node) bool {
+		visited = append(visited, n)
+		return true
+	})
+
+	if len(visited) != 6 || visited[2] != node {
+		t.Errorf("wrong nodes visited. got=%v", visited)
+	}
+
+	var modified []Node
+	Modify(program, func(n Node) Node {
+		modified = append(modified, n)
+		return n
+	})
+
+	if len(modified) != 3 || modified[0] != node {
+		t.Errorf("wrong nodes modified. got=%v", modified)
+	}
+}
+
+// unsupported is a node type of this package that Walk and Modify do not support.
+type unsupported struct{ Identifier }
+
+func TestUnsupportedNode(t *testing.T) {
+	program := &Program{Statements: []Statement{&ExpressionStatement{Expression: &unsupported{}}}}
+
+	tests := []struct {
+		name     string
+		fn       func()
+		expected string
+	}{
+		{"Walk", func() { Inspect(program, func(Node) bool { return true }) }, "ast.Walk: unexpected node type *ast.unsupported"},
+		{"Modify", func() { Modify(program, func(n Node) Node { return n }) }, "ast.Modify: unexpected node type *ast.unsupported"},
+	}
+
+	for _, tt := range tests {
+		func() {
+			defer func() {
+				if r := recover(); r != tt.expected {
+					t.Errorf("wrong panic of %s. expected=%q, got=%v", tt.name, tt.expected, r)
+				}
+			}()
+			tt.fn()
+		}()
+	}
+}
@@ -0,0 +1,595 @@
+// Package bridge converts between Go values and Monkey objects,
+// so that Go functions and data can be exposed to Monkey programs without hand-written wrappers.
+//
+// Go values convert to Monkey objects as follows:
+//   - bool to BOOLEAN, integers and *big.Int to INTEGER, floats to FLOAT, strings to STRING
+//   - slices and arrays to ARRAY, maps to HASH
+//   - structs to HASH, with a STRING key for each exported field (see FieldName)
+//   - funcs to BUILTIN (see Func)
+//   - pointers to the object for the value they point to, and nil to NULL
+//   - object.Object values to themselves
+//
+// Monkey objects convert back to Go values of the same kinds, and to interface{} as
+// bool, int64, *big.Int, float64, string, []interface{}, map[interface{}]interface{} or nil.
+// Only a BUILTIN converts to a Go func: a FUNCTION needs an evaluator to be called, and is rejected.
+// Values must not contain cycles.
+package bridge
+
+import (
+	"fmt"
+	"math/big"
+	"reflect"
+
+	"github.com/GenericEntity/interpreter-go/monkey/evaluator"
+	"github.com/GenericEntity/interpreter-go/monkey/object"
+)
+
+var (
+	objectType = reflect.TypeOf((*object.Object)(nil)).Elem()
+	errorType  = reflect.TypeOf((*error)(nil)).Elem()
+	bigIntType = reflect.TypeOf((*big.Int)(nil))
+)
+
+// ConversionError describes a value that cannot be converted.
+type ConversionError struct {
+	From string // the type of the value, e.g. "STRING" or "chan int"
+	To   string // the type it was converted to
+}
+
+func (e *ConversionError) Error() string {
+	return fmt.Sprintf("cannot convert %s to %s", e.From, e.To)
+}
+
+// ToObject converts a Go value to a Monkey object.
+func ToObject(value interface{}) (object.Object, error) {
+	if value == nil {
+		return evaluator.NULL, nil
+	}
+	return toObject(reflect.ValueOf(value))
+}
+
+func toObject(v reflect.Value) (object.Object, error) {
+	if v.Type().Implements(objectType) && !(v.Kind() == reflect.Ptr && v.IsNil()) {
+		return v.Interface().(object.Object), nil
+	}
+	if v.Type() == bigIntType && !v.IsNil() {
+		return object.NewInteger(new(big.Int).Set(v.Interface().(*big.Int))), nil
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			return evaluator.TRUE, nil
+		}
+		return evaluator.FALSE, nil
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &object.Integer{Value: v.Int()}, nil
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return object.NewInteger(new(big.Int).SetUint64(v.Uint())), nil
+
+	case reflect.Float32, reflect.Float64:
+		return &object.Float{Value: v.Float()}, nil
+
+	case reflect.String:
+		return &object.String{Value: v.String()}, nil
+
+	case reflect.Slice, reflect.Array:
+		elements := make([]object.Object, v.Len())
+		for i := range elements {
+			element, err := toObject(v.Index(i))
+			if err != nil {
+				return nil, fmt.Errorf("index %d: %w", i, err)
+			}
+			elements[i] = element
+		}
+		return &object.Array{Elements: elements}, nil
+
+	case reflect.Map:
+		hash := &object.Hash{Pairs: make(map[object.HashKey]object.HashPair, v.Len())}
+		iter := v.MapRange()
+		for iter.Next() {
+			if err := setPair(hash, iter.Key(), iter.Value()); err != nil {
+				return nil, fmt.Errorf("key %v: %w", iter.Key(), err)
+			}
+		}
+		return hash, nil
+
+	case reflect.Struct:
+		hash := &object.Hash{Pairs: map[object.HashKey]object.HashPair{}}
+		for i := 0; i < v.NumField(); i++ {
+			name, ok := FieldName(v.Type().Field(i))
+			if !ok {
+				continue
+			}
+			if err := setPair(hash, reflect.ValueOf(name), v.Field(i)); err != nil {
+				return nil, fmt.Errorf("field %s: %w", name, err)
+			}
+		}
+		return hash, nil
+
+	case reflect.Func:
+		if v.IsNil() {
+			return evaluator.NULL, nil
+		}
+		return &object.Builtin{Fn: wrapFunc(v)}, nil
+
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return evaluator.NULL, nil
+		}
+		return toObject(v.Elem())
+	}
+
+	return nil, &ConversionError{From: v.Type().String(), To: "a Monkey object"}
+}
+
+func setPair(hash *object.Hash, key, value reflect.Value) error {
+	keyObj, err := toObject(key)
+	if err != nil {
+		return err
+	}
+	hashable, ok := keyObj.(object.Hashable)
+	if !ok {
+		return &ConversionError{From: key.Type().String(), To: "a hash key"}
+	}
+
+	valueObj, err := toObject(value)
+	if err != nil {
+		return err
+	}
+
+	hash.Pairs[hashable.HashKey()] = object.HashPair{Key: keyObj, Value: valueObj}
+	return nil
+}
+
+// FieldName returns the name of the hash key for a struct field: the name in its `monkey` tag, if any,
+// or else its own name. It returns false for unexported fields and fields tagged `monkey:"-"`.
+func FieldName(field reflect.StructField) (string, bool) {
+	if field.PkgPath != "" {
+		return "", false
+	}
+
+	tag := field.Tag.Get("monkey")
+	switch tag {
+	case "-":
+		return "", false
+	case "":
+		return field.Name, true
+	default:
+		return tag, true
+	}
+}
+
+// Into converts obj to the Go value pointed to by ptr, e.g. Into(obj, &s) for a string s.
+func Into(obj object.Object, ptr interface{}) error {
+	v := reflect.ValueOf(ptr)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return fmt.Errorf("Into requires a non-nil pointer, got %T", ptr)
+	}
+
+	value, err := FromObject(obj, v.Type().Elem())
+	if err != nil {
+		return err
+	}
+	v.Elem().Set(value)
+	return nil
+}
+
+// FromObject converts obj to a Go value of type t.
+func FromObject(obj object.Object, t reflect.Type) (reflect.Value, error) {
+	if t.Kind() == reflect.Interface && t.NumMethod() == 0 {
+		return naturalValue(obj, t)
+	}
+
+	if reflect.TypeOf(obj).AssignableTo(t) {
+		return reflect.ValueOf(obj), nil
+	}
+
+	if obj == evaluator.NULL {
+		switch t.Kind() {
+		case reflect.Ptr, reflect.Interface, reflect.Slice, reflect.Map, reflect.Func:
+			return reflect.Zero(t), nil
+		}
+	}
+
+	if t == bigIntType {
+		if value, ok := bigValue(obj); ok {
+			return reflect.ValueOf(value), nil
+		}
+		return reflect.Value{}, conversionError(obj, t)
+	}
+
+	v := reflect.New(t).Elem()
+
+	switch t.Kind() {
+	case reflect.Bool:
+		if obj, ok := obj.(*object.Boolean); ok {
+			v.SetBool(obj.Value)
+			return v, nil
+		}
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if obj, ok := obj.(*object.Integer); ok {
+			if v.OverflowInt(obj.Value) {
+				return v, fmt.Errorf("%d overflows %s", obj.Value, t)
+			}
+			v.SetInt(obj.Value)
+			return v, nil
+		}
+		if obj, ok := obj.(*object.BigInteger); ok {
+			return v, fmt.Errorf("%s overflows %s", obj.Value, t)
+		}
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if value, ok := bigValue(obj); ok {
+			if value.Sign() < 0 || !value.IsUint64() || v.OverflowUint(value.Uint64()) {
+				return v, fmt.Errorf("%s overflows %s", value, t)
+			}
+			v.SetUint(value.Uint64())
+			return v, nil
+		}
+
+	case reflect.Float32, reflect.Float64:
+		switch obj := obj.(type) {
+		case *object.Float:
+			v.SetFloat(obj.Value)
+			return v, nil
+		case *object.Integer:
+			v.SetFloat(float64(obj.Value))
+			return v, nil
+		case *object.BigInteger:
+			f, _ := new(big.Float).SetInt(obj.Value).Float64()
+			v.SetFloat(f)
+			return v, nil
+		}
+
+	case reflect.String:
+		if obj, ok := obj.(*object.String); ok {
+			v.SetString(obj.Value)
+			return v, nil
+		}
+
+	case reflect.Slice:
+		if obj, ok := obj.(*object.Array); ok {
+			v.Set(reflect.MakeSlice(t, len(obj.Elements), len(obj.Elements)))
+			return v, setElements(v, obj.Elements)
+		}
+
+	case reflect.Array:
+		if obj, ok := obj.(*object.Array); ok {
+			if len(obj.Elements) != t.Len() {
+				return v, fmt.Errorf("cannot convert ARRAY of length %d to %s", len(obj.Elements), t)
+			}
+			return v, setElements(v, obj.Elements)
+		}
+
+	case reflect.Map:
+		if obj, ok := obj.(*object.Hash); ok {
+			v.Set(reflect.MakeMapWithSize(t, len(obj.Pairs)))
+			for _, pair := range obj.Pairs {
+				key, err := FromObject(pair.Key, t.Key())
+				if err != nil {
+					return v, fmt.Errorf("key %s: %w", pair.Key.Inspect(), err)
+				}
+				value, err := FromObject(pair.Value, t.Elem())
+				if err != nil {
+					return v, fmt.Errorf("key %s: %w", pair.Key.Inspect(), err)
+				}
+				v.SetMapIndex(key, value)
+			}
+			return v, nil
+		}
+
+	case reflect.Struct:
+		if obj, ok := obj.(*object.Hash); ok {
+			return v, setFields(v, obj)
+		}
+
+	case reflect.Ptr:
+		elem, err := FromObject(obj, t.Elem())
+		if err != nil {
+			return v, err
+		}
+		v.Set(reflect.New(t.Elem()))
+		v.Elem().Set(elem)
+		return v, nil
+
+	case reflect.Func:
+		if obj, ok := obj.(*object.Builtin); ok {
+			return makeFunc(obj, t), nil
+		}
+	}
+
+	return v, conversionError(obj, t)
+}
+
+func conversionError(obj object.Object, t reflect.Type) error {
+	return &ConversionError{From: string(obj.Type()), To: t.String()}
+}
+
+func bigValue(obj object.Object) (*big.Int, bool) {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		return big.NewInt(obj.Value), true
+	case *object.BigInteger:
+		return new(big.Int).Set(obj.Value), true
+	default:
+		return nil, false
+	}
+}
+
+func setElements(v reflect.Value, elements []object.Object) error {
+	for i, element := range elements {
+		value, err := FromObject(element, v.Type().Elem())
+		if err != nil {
+			return fmt.Errorf("index %d: %w", i, err)
+		}
+		v.Index(i).Set(value)
+	}
+	return nil
+}
+
+// setFields sets the fields of the struct v to the values of the pairs of hash.
+// Fields without a pair keep their zero value.
+func setFields(v reflect.Value, hash *object.Hash) error {
+	fields := map[string]int{}
+	for i := 0; i < v.NumField(); i++ {
+		if name, ok := FieldName(v.Type().Field(i)); ok {
+			fields[name] = i
+		}
+	}
+
+	for _, pair := range hash.Pairs {
+		key, ok := pair.Key.(*object.String)
+		if !ok {
+			return fmt.Errorf("cannot convert HASH with %s key %s to %s", pair.Key.Type(), pair.Key.Inspect(), v.Type())
+		}
+		i, ok := fields[key.Value]
+		if !ok {
+			return fmt.Errorf("%s has no field %s", v.Type(), key.Value)
+		}
+
+		value, err := FromObject(pair.Value, v.Type().Field(i).Type)
+		if err != nil {
+			return fmt.Errorf("field %s: %w", key.Value, err)
+		}
+		v.Field(i).Set(value)
+	}
+	return nil
+}
+
+// naturalValue converts obj to the Go value of the corresponding type, stored in an interface of type t.
+func naturalValue(obj object.Object, t reflect.Type) (reflect.Value, error) {
+	var value interface{}
+
+	switch obj := obj.(type) {
+	case *object.Boolean:
+		value = obj.Value
+	case *object.Integer:
+		value = obj.Value
+	case *object.BigInteger:
+		value = new(big.Int).Set(obj.Value)
+	case *object.Float:
+		value = obj.Value
+	case *object.String:
+		value = obj.Value
+	case *object.Null:
+		return reflect.Zero(t), nil
+
+	case *object.Array:
+		elements := make([]interface{}, len(obj.Elements))
+		v := reflect.ValueOf(elements)
+		if err := setElements(v, obj.Elements); err != nil {
+			return reflect.Value{}, err
+		}
+		value = elements
+
+	case *object.Hash:
+		m := make(map[interface{}]interface{}, len(obj.Pairs))
+		for _, pair := range obj.Pairs {
+			key, err := naturalValue(pair.Key, t)
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			val, err := naturalValue(pair.Value, t)
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			m[key.Interface()] = val.Interface()
+		}
+		value = m
+
+	default:
+		// functions are passed as they are, to be called through the evaluator
+		value = obj
+	}
+
+	v := reflect.New(t).Elem()
+	v.Set(reflect.ValueOf(value))
+	return v, nil
+}
+
+// Func converts fn, which must be a Go function, to a builtin function.
+// Arguments are converted to the types of the parameters of fn, and its results to objects:
+// no results to NULL, one to its object, and several to an ARRAY. If the last result of fn is an error,
+// it is not part of the results, and a non-nil error makes the builtin return an ERROR wrapping it.
+// Func panics if fn is not a function. If fn calls a builtin passed to it as a Go function,
+// and the builtin fails, the builtin made by Func returns an ERROR for the failure.
+func Func(fn interface{}) object.BuiltinFunction {
+	v := reflect.ValueOf(fn)
+	if v.Kind() != reflect.Func || v.IsNil() {
+		panic(fmt.Sprintf("bridge.Func: %T is not a function", fn))
+	}
+	return wrapFunc(v)
+}
+
+func wrapFunc(fn reflect.Value) object.BuiltinFunction {
+	t := fn.Type()
+
+	return func(args ...object.Object) (result object.Object) {
+		defer func() {
+			if r := recover(); r != nil {
+				err, ok := callbackError(r)
+				if !ok {
+					panic(r)
+				}
+				result = newError(err, "%s", err)
+			}
+		}()
+
+		params := t.NumIn()
+		if t.IsVariadic() {
+			if len(args) < params-1 {
+				return newError(nil, "wrong number of arguments. got=%d, want at least %d", len(args), params-1)
+			}
+		} else if len(args) != params {
+			return newError(nil, "wrong number of arguments. got=%d, want=%d", len(args), params)
+		}
+
+		in := make([]reflect.Value, len(args))
+		for i, arg := range args {
+			paramType := paramType(t, i)
+			value, err := FromObject(arg, paramType)
+			if err != nil {
+				return newError(err, "argument %d: %s", i+1, err)
+			}
+			in[i] = value
+		}
+
+		out := fn.Call(in)
+		if n := len(out); n > 0 && t.Out(n-1) == errorType {
+			if err, _ := out[n-1].Interface().(error); err != nil {
+				return newError(err, "%s", err)
+			}
+			out = out[:n-1]
+		}
+
+		results := make([]object.Object, len(out))
+		for i, value := range out {
+			result, err := toObject(value)
+			if err != nil {
+				return newError(err, "result %d: %s", i+1, err)
+			}
+			results[i] = result
+		}
+
+		switch len(results) {
+		case 0:
+			return evaluator.NULL
+		case 1:
+			return results[0]
+		default:
+			return &object.Array{Elements: results}
+		}
+	}
+}
+
+func paramType(fn reflect.Type, i int) reflect.Type {
+	if fn.IsVariadic() && i >= fn.NumIn()-1 {
+		return fn.In(fn.NumIn() - 1).Elem()
+	}
+	return fn.In(i)
+}
+
+func newError(err error, format string, args ...interface{}) *object.Error {
+	return &object.Error{Message: fmt.Sprintf(format, args...), Err: err}
+}
+
+// makeFunc converts a builtin to a Go function of type t, whose results are converted like its parameters
+// in Func. If the builtin returns an ERROR, the function returns it as its last result if that is an error,
+// and panics with it otherwise.
+func makeFunc(builtin *object.Builtin, t reflect.Type) reflect.Value {
+	return reflect.MakeFunc(t, func(in []reflect.Value) []reflect.Value {
+		args := make([]object.Object, 0, len(in))
+		for i, value := range in {
+			if t.IsVariadic() && i == len(in)-1 {
+				for j := 0; j < value.Len(); j++ {
+					args = append(args, mustToObject(value.Index(j)))
+				}
+				break
+			}
+			args = append(args, mustToObject(value))
+		}
+
+		results := make([]reflect.Value, t.NumOut())
+		for i := range results {
+			results[i] = reflect.Zero(t.Out(i))
+		}
+
+		result := builtin.Fn(args...)
+		returnsError := t.NumOut() > 0 && t.Out(t.NumOut()-1) == errorType
+		if errObj, ok := result.(*object.Error); ok {
+			err := runtimeError{errObj}
+			if !returnsError {
+				panic(err)
+			}
+			results[len(results)-1] = reflect.ValueOf(err)
+			return results
+		}
+
+		values := results
+		if returnsError {
+			values = results[:len(results)-1]
+		}
+		switch len(values) {
+		case 0:
+		case 1:
+			values[0] = mustFromObject(result, values[0].Type())
+		default:
+			array, ok := result.(*object.Array)
+			if !ok || len(array.Elements) != len(values) {
+				panic(conversionPanic{fmt.Errorf("cannot convert %s to %d results", result.Type(), len(values))})
+			}
+			for i, element := range array.Elements {
+				values[i] = mustFromObject(element, values[i].Type())
+			}
+		}
+		return results
+	})
+}
+
+// runtimeError is an ERROR returned by a builtin called as a Go function.
+type runtimeError struct {
+	obj *object.Error
+}
+
+func (e runtimeError) Error() string { return e.obj.Message }
+func (e runtimeError) Unwrap() error { return e.obj.Err }
+
+// conversionPanic is an error converting the arguments or results of a builtin called as a Go function.
+type conversionPanic struct {
+	err error
+}
+
+func (e conversionPanic) Error() string { return e.err.Error() }
+func (e conversionPanic) Unwrap() error { return e.err }
+
+// callbackError returns the error a function made by makeFunc panicked with, if r is one.
+func callbackError(r interface{}) (error, bool) {
+	switch r := r.(type) {
+	case runtimeError:
+		return r, true
+	case conversionPanic:
+		return r, true
+	default:
+		return nil, false
+	}
+}
+
+func mustToObject(v reflect.Value) object.Object {
+	obj, err := toObject(v)
+	if err != nil {
+		panic(conversionPanic{err})
+	}
+	return obj
+}
+
+func mustFromObject(obj object.Object, t reflect.Type) reflect.Value {
+	v, err := FromObject(obj, t)
+	if err != nil {
+		panic(conversionPanic{err})
+	}
+	return v
+}
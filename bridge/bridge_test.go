@@ -0,0 +1,281 @@
+package bridge
+
+import (
+	"errors"
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/GenericEntity/interpreter-go/monkey/evaluator"
+	"github.com/GenericEntity/interpreter-go/monkey/lexer"
+	"github.com/GenericEntity/interpreter-go/monkey/object"
+	"github.com/GenericEntity/interpreter-go/monkey/parser"
+)
+
+type point struct {
+	X, Y   int
+	Label  string `monkey:"label"`
+	hidden bool
+	Skip   bool `monkey:"-"`
+}
+
+func testEval(t *testing.T, input string, builtins map[string]object.BuiltinFunction) object.Object {
+	t.Helper()
+
+	e := evaluator.New()
+	e.Builtins = e.DefaultBuiltins()
+	for name, fn := range builtins {
+		e.Builtins.Register(name, fn)
+	}
+
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors for %s: %v", input, p.Errors())
+	}
+	return e.Eval(program, object.NewEnvironment())
+}
+
+func TestToObject(t *testing.T) {
+	tests := []struct {
+		value    interface{}
+		expected string
+	}{
+		{nil, "null"},
+		{true, "true"},
+		{int8(-5), "-5"},
+		{uint64(18446744073709551615), "18446744073709551615"},
+		{big.NewInt(7), "7"},
+		{2.5, "2.5"},
+		{"monkey", "monkey"},
+		{[]int{1, 2, 3}, "[1,2,3]"},
+		{[2]bool{true, false}, "[true,false]"},
+		{map[string]int{"a": 1}, "{a: 1}"},
+		{&point{X: 1}, ""},
+		{(*point)(nil), "null"},
+		{[]interface{}{1, "a", nil}, "[1,a,null]"},
+		{&object.String{Value: "as is"}, "as is"},
+	}
+
+	for _, tt := range tests {
+		obj, err := ToObject(tt.value)
+		if err != nil {
+			t.Errorf("unexpected error for %#v: %v", tt.value, err)
+			continue
+		}
+		if tt.expected != "" && obj.Inspect() != tt.expected {
+			t.Errorf("wrong object for %#v. expected=%s, got=%s", tt.value, tt.expected, obj.Inspect())
+		}
+	}
+
+	if obj, _ := ToObject(true); obj != evaluator.TRUE {
+		t.Errorf("booleans are not converted to the TRUE singleton")
+	}
+
+	obj, err := ToObject(point{X: 1, Y: 2, Label: "p"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	hash, ok := obj.(*object.Hash)
+	if !ok {
+		t.Fatalf("struct not converted to hash. got=%T", obj)
+	}
+	if len(hash.Pairs) != 3 {
+		t.Errorf("wrong number of fields. expected=3, got=%d (%s)", len(hash.Pairs), hash.Inspect())
+	}
+	label := hash.Pairs[(&object.String{Value: "label"}).HashKey()]
+	if label.Value == nil || label.Value.Inspect() != "p" {
+		t.Errorf("tagged field not converted. got=%v", label.Value)
+	}
+
+	_, err = ToObject(map[string]chan int{"c": nil})
+	if err == nil || err.Error() != "key c: cannot convert chan int to a Monkey object" {
+		t.Errorf("wrong error. got=%v", err)
+	}
+	var convErr *ConversionError
+	if !errors.As(err, &convErr) {
+		t.Errorf("error does not wrap a *ConversionError")
+	}
+}
+
+func TestFromObject(t *testing.T) {
+	program := `{"X": 1, "Y": -2, "label": "p"}`
+	var p point
+	if err := Into(testEval(t, program, nil), &p); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if p != (point{X: 1, Y: -2, Label: "p"}) {
+		t.Errorf("wrong struct. got=%+v", p)
+	}
+
+	var m map[string][]float64
+	if err := Into(testEval(t, `{"a": [1, 2.5]}`, nil), &m); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(m, map[string][]float64{"a": {1, 2.5}}) {
+		t.Errorf("wrong map. got=%v", m)
+	}
+
+	var natural interface{}
+	if err := Into(testEval(t, `[1, "a", true, {"k": 2.5}, 9223372036854775807 + 1]`, nil), &natural); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []interface{}{int64(1), "a", true, map[interface{}]interface{}{"k": 2.5}, bigInt("9223372036854775808")}
+	if !reflect.DeepEqual(natural, expected) {
+		t.Errorf("wrong natural value. expected=%#v, got=%#v", expected, natural)
+	}
+
+	var f float64
+	if err := Into(testEval(t, "2 ** 64", nil), &f); err != nil || f != 1<<64 {
+		t.Errorf("wrong float. got=%v, %v", f, err)
+	}
+
+	var ptr *int
+	if err := Into(testEval(t, "5", nil), &ptr); err != nil || ptr == nil || *ptr != 5 {
+		t.Errorf("wrong pointer. got=%v, %v", ptr, err)
+	}
+
+	var obj object.Object
+	if err := Into(testEval(t, "[1]", nil), &obj); err != nil || obj.Type() != object.ARRAY_OBJ {
+		t.Errorf("object not kept as is. got=%v, %v", obj, err)
+	}
+
+	errorTests := []struct {
+		input    string
+		ptr      interface{}
+		expected string
+	}{
+		{`"a"`, new(int), "cannot convert STRING to int"},
+		{"300", new(int8), "300 overflows int8"},
+		{"-1", new(uint), "-1 overflows uint"},
+		{"9223372036854775807 + 1", new(int64), "9223372036854775808 overflows int64"},
+		{"fn(x) { x }", new(func(int) int), "cannot convert FUNCTION to func(int) int"},
+		{"1.5", new(int), "cannot convert FLOAT to int"},
+		{`[1, "a"]`, new([]int), "index 1: cannot convert STRING to int"},
+		{"[1, 2]", new([3]int), "cannot convert ARRAY of length 2 to [3]int"},
+		{`{"Z": 1}`, new(point), "bridge.point has no field Z"},
+		{`{1: 1}`, new(point), "cannot convert HASH with INTEGER key 1 to bridge.point"},
+		{`{"X": "1"}`, new(point), "field X: cannot convert STRING to int"},
+	}
+
+	for _, tt := range errorTests {
+		err := Into(testEval(t, tt.input, nil), tt.ptr)
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("wrong error for %s. expected=%q, got=%v", tt.input, tt.expected, err)
+		}
+	}
+}
+
+func bigInt(s string) *big.Int {
+	value, _ := new(big.Int).SetString(s, 10)
+	return value
+}
+
+func TestFunc(t *testing.T) {
+	errNegative := errors.New("negative")
+	builtins := map[string]object.BuiltinFunction{
+		"repeat": Func(strings.Repeat),
+		"join":   Func(func(sep string, parts ...string) string { return strings.Join(parts, sep) }),
+		"divmod": Func(func(a, b int) (int, int) { return a / b, a % b }),
+		"sqrt": Func(func(x float64) (float64, error) {
+			if x < 0 {
+				return 0, errNegative
+			}
+			return x / 2, nil
+		}),
+		"nothing": Func(func() {}),
+		"origin":  Func(func() point { return point{Label: "origin"} }),
+		"norm":    Func(func(p point) int { return p.X*p.X + p.Y*p.Y }),
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`repeat("ab", 3)`, "ababab"},
+		{`join(", ")`, ""},
+		{`join(", ", "a", "b")`, "a, b"},
+		{"divmod(7, 2)", "[3,1]"},
+		{"sqrt(8)", "4.0"},
+		{"nothing()", "null"},
+		{`origin()["label"]`, "origin"},
+		{`norm({"X": 3, "Y": 4})`, "25"},
+		{`repeat("ab")`, "ERROR: 1:1: wrong number of arguments. got=1, want=2"},
+		{`join()`, "ERROR: 1:1: wrong number of arguments. got=0, want at least 1"},
+		{`repeat("ab", "3")`, "ERROR: 1:1: argument 2: cannot convert STRING to int"},
+		{"sqrt(-1)", "ERROR: 1:1: negative"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input, builtins)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %s. expected=%s, got=%s", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+
+	evaluated := testEval(t, "sqrt(-1)", builtins)
+	if err := evaluated.(*object.Error).Err; err != errNegative {
+		t.Errorf("error does not wrap the Go error. got=%v", err)
+	}
+}
+
+func TestFuncCallbackErrors(t *testing.T) {
+	builtins := map[string]object.BuiltinFunction{
+		"apply": Func(func(f func(int) int, x int) int { return f(x) }),
+		"name":  Func(func(x int) string { return "x" }),
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"apply(fn(x) { x * 2 }, 3)", "ERROR: 1:1: argument 1: cannot convert FUNCTION to func(int) int"},
+		{"apply(len, 3)", "ERROR: 1:1: type of 1st argument to `len` not supported, got INTEGER"},
+		{"apply(name, 3)", "ERROR: 1:1: cannot convert STRING to int"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input, builtins)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %s. expected=%s, got=%s", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+
+	evaluated := testEval(t, "apply(len, 3)", builtins)
+	var runtimeErr runtimeError
+	if err := evaluated.(*object.Error).Err; !errors.As(err, &runtimeErr) {
+		t.Errorf("error does not wrap the error of the callback. got=%v", err)
+	}
+}
+
+func TestBuiltinToFunc(t *testing.T) {
+	var double func(int) int
+	builtin := &object.Builtin{Fn: Func(func(x int) int { return x * 2 })}
+	if err := Into(builtin, &double); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if double(21) != 42 {
+		t.Errorf("wrong result. expected=42, got=%d", double(21))
+	}
+
+	var checkedDouble func(int) (int, error)
+	if err := Into(builtin, &checkedDouble); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := checkedDouble(1); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	var length func(interface{}) (int, error)
+	if err := Into(testEval(t, "len", nil), &length); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n, err := length("abc"); n != 3 || err != nil {
+		t.Errorf("wrong result. expected=3, got=%d, %v", n, err)
+	}
+	_, err := length(1)
+	if err == nil || err.Error() != "type of 1st argument to `len` not supported, got INTEGER" {
+		t.Errorf("wrong error. got=%v", err)
+	}
+}
@@ -0,0 +1,232 @@
+package compiler
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// Instructions is a sequence of encoded instructions: an opcode followed by its operands.
+type Instructions []byte
+
+// Opcode identifies an instruction of the vm.
+type Opcode byte
+
+const (
+	// OpConstant pushes the constant at the index of its operand.
+	OpConstant Opcode = iota
+	// OpPop discards the top of the stack.
+	OpPop
+	// OpTrue, OpFalse and OpNull push the corresponding singleton.
+	OpTrue
+	OpFalse
+	OpNull
+	// OpInfix replaces the top two elements of the stack by the result of the operator in Operators
+	// at the index of its operand.
+	OpInfix
+	// OpPrefix replaces the top of the stack by the result of the operator in Operators
+	// at the index of its operand.
+	OpPrefix
+	// OpJump jumps to the offset of its operand.
+	OpJump
+	// OpJumpNotTruthy pops the top of the stack and jumps to the offset of its operand if it is not truthy.
+	OpJumpNotTruthy
+	// OpJumpTruthy pops the top of the stack and jumps to the offset of its operand if it is truthy.
+	OpJumpTruthy
+	// OpGetGlobal pushes the global variable at the index of its operand,
+	// or the builtin function with its name if it is not set.
+	OpGetGlobal
+	// OpSetGlobal pops the top of the stack into the global variable at the index of its operand.
+	OpSetGlobal
+	// OpGetLocal pushes the local variable at the index of its operand.
+	OpGetLocal
+	// OpSetLocal pops the top of the stack into the local variable at the index of its operand.
+	OpSetLocal
+	// OpGetOuter pushes the local variable at the index of its second operand
+	// in the environment of the function the number of its first operand levels out.
+	OpGetOuter
+	// OpAssignGlobal, OpAssignLocal and OpAssignOuter assign the top of the stack to a variable that
+	// must have been set, like the corresponding Set and Get instructions. If the last operand is not 0,
+	// the value is first combined with the variable by the operator in Operators at that index minus 1.
+	// The assigned value is left on the stack.
+	OpAssignGlobal
+	OpAssignLocal
+	OpAssignOuter
+	// OpArray replaces the number of elements of its operand on top of the stack by an array of them.
+	OpArray
+	// OpHash replaces the number of key-value pairs of its operand on top of the stack by a hash of them.
+	OpHash
+	// OpIndex replaces the top two elements of the stack, a value and an index, by the element at the index.
+	OpIndex
+	// OpCall calls the function below the number of arguments of its operand on top of the stack.
+	OpCall
+	// OpTailCall is like OpCall, but reuses the frame of the calling function, which returns the result.
+	OpTailCall
+	// OpReturnValue returns the top of the stack from the current function.
+	OpReturnValue
+	// OpReturn returns from the current function without a value: null, or nothing from the program.
+	OpReturn
+	// OpClosure pushes a closure of the function constant at the index of its operand.
+	OpClosure
+	// OpIter replaces the top of the stack by an iterator over it. If its operand is 1, the loop has
+	// a key variable as well as a value variable.
+	OpIter
+	// OpIterNext pushes the next value, and key if the loop has a key variable, of the iterator
+	// on top of the stack, or jumps to the offset of its operand if there are no more.
+	OpIterNext
+	// OpLoop records the height of the stack for the loop at the nesting level of its operand
+	// in the current function.
+	OpLoop
+	// OpUnwind truncates the stack to the height OpLoop recorded for the loop at the nesting level
+	// of its operand, discarding the operands of the expressions a break or continue statement leaves.
+	OpUnwind
+)
+
+// Operators are the infix and prefix operators of OpInfix, OpPrefix and the assignment instructions.
+var Operators = []string{"+", "-", "*", "/", "%", "**", "&", "|", "^", "<<", ">>", "==", "!=", "<", ">", "<=", ">=", "!", "~"}
+
+func operatorIndex(operator string) (int, bool) {
+	for i, op := range Operators {
+		if op == operator {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// Definition describes an opcode for disassembly.
+type Definition struct {
+	Name          string
+	OperandWidths []int // number of bytes of each operand
+}
+
+var definitions = map[Opcode]*Definition{
+	OpConstant:      {"OpConstant", []int{2}},
+	OpPop:           {"OpPop", []int{}},
+	OpTrue:          {"OpTrue", []int{}},
+	OpFalse:         {"OpFalse", []int{}},
+	OpNull:          {"OpNull", []int{}},
+	OpInfix:         {"OpInfix", []int{1}},
+	OpPrefix:        {"OpPrefix", []int{1}},
+	OpJump:          {"OpJump", []int{2}},
+	OpJumpNotTruthy: {"OpJumpNotTruthy", []int{2}},
+	OpJumpTruthy:    {"OpJumpTruthy", []int{2}},
+	OpGetGlobal:     {"OpGetGlobal", []int{2}},
+	OpSetGlobal:     {"OpSetGlobal", []int{2}},
+	OpGetLocal:      {"OpGetLocal", []int{2}},
+	OpSetLocal:      {"OpSetLocal", []int{2}},
+	OpGetOuter:      {"OpGetOuter", []int{1, 2}},
+	OpAssignGlobal:  {"OpAssignGlobal", []int{2, 1}},
+	OpAssignLocal:   {"OpAssignLocal", []int{2, 1}},
+	OpAssignOuter:   {"OpAssignOuter", []int{1, 2, 1}},
+	OpArray:         {"OpArray", []int{2}},
+	OpHash:          {"OpHash", []int{2}},
+	OpIndex:         {"OpIndex", []int{}},
+	OpCall:          {"OpCall", []int{1}},
+	OpTailCall:      {"OpTailCall", []int{1}},
+	OpReturnValue:   {"OpReturnValue", []int{}},
+	OpReturn:        {"OpReturn", []int{}},
+	OpClosure:       {"OpClosure", []int{2}},
+	OpIter:          {"OpIter", []int{1}},
+	OpIterNext:      {"OpIterNext", []int{2}},
+	OpLoop:          {"OpLoop", []int{1}},
+	OpUnwind:        {"OpUnwind", []int{1}},
+}
+
+// Lookup returns the definition of op.
+func Lookup(op byte) (*Definition, error) {
+	def, ok := definitions[Opcode(op)]
+	if !ok {
+		return nil, fmt.Errorf("opcode %d undefined", op)
+	}
+	return def, nil
+}
+
+// Make encodes an instruction.
+func Make(op Opcode, operands ...int) []byte {
+	def, ok := definitions[op]
+	if !ok {
+		return []byte{}
+	}
+
+	length := 1
+	for _, w := range def.OperandWidths {
+		length += w
+	}
+
+	instruction := make([]byte, length)
+	instruction[0] = byte(op)
+
+	offset := 1
+	for i, o := range operands {
+		width := def.OperandWidths[i]
+		switch width {
+		case 1:
+			instruction[offset] = byte(o)
+		case 2:
+			binary.BigEndian.PutUint16(instruction[offset:], uint16(o))
+		}
+		offset += width
+	}
+
+	return instruction
+}
+
+// ReadOperands decodes the operands of an instruction, returning them and their number of bytes.
+func ReadOperands(def *Definition, ins Instructions) ([]int, int) {
+	operands := make([]int, len(def.OperandWidths))
+	offset := 0
+
+	for i, width := range def.OperandWidths {
+		switch width {
+		case 1:
+			operands[i] = int(ReadUint8(ins[offset:]))
+		case 2:
+			operands[i] = int(ReadUint16(ins[offset:]))
+		}
+		offset += width
+	}
+
+	return operands, offset
+}
+
+func ReadUint8(ins Instructions) uint8 { return ins[0] }
+
+func ReadUint16(ins Instructions) uint16 {
+	return binary.BigEndian.Uint16(ins)
+}
+
+// String disassembles the instructions, one per line.
+func (ins Instructions) String() string {
+	var out bytes.Buffer
+
+	i := 0
+	for i < len(ins) {
+		def, err := Lookup(ins[i])
+		if err != nil {
+			fmt.Fprintf(&out, "ERROR: %s\n", err)
+			i++
+			continue
+		}
+
+		operands, read := ReadOperands(def, ins[i+1:])
+		fmt.Fprintf(&out, "%04d %s\n", i, formatInstruction(def, operands))
+
+		i += 1 + read
+	}
+
+	return out.String()
+}
+
+func formatInstruction(def *Definition, operands []int) string {
+	if len(operands) != len(def.OperandWidths) {
+		return fmt.Sprintf("ERROR: operand len %d does not match defined %d\n", len(operands), len(def.OperandWidths))
+	}
+
+	var out bytes.Buffer
+	out.WriteString(def.Name)
+	for _, operand := range operands {
+		fmt.Fprintf(&out, " %d", operand)
+	}
+	return out.String()
+}
@@ -0,0 +1,669 @@
+// Package compiler lowers Monkey programs to bytecode for the vm package.
+package compiler
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/GenericEntity/interpreter-go/monkey/ast"
+	"github.com/GenericEntity/interpreter-go/monkey/object"
+	"github.com/GenericEntity/interpreter-go/monkey/resolver"
+	"github.com/GenericEntity/interpreter-go/monkey/token"
+)
+
+// CompiledFunction is a function, or a program, compiled to bytecode.
+type CompiledFunction struct {
+	Instructions  Instructions
+	NumLocals     int
+	NumParameters int
+	Name          string   // empty for anonymous functions and programs
+	LocalNames    []string // names of the local variables by index
+	Positions     []Position
+
+	Literal *ast.FunctionLiteral // the source of the function, nil for programs
+}
+
+// Position maps the instruction at Offset to the node it was compiled from,
+// to locate errors and calls in the source.
+type Position struct {
+	Offset int
+	Node   ast.Node
+}
+
+func (cf *CompiledFunction) Type() object.ObjectType { return "COMPILED_FUNCTION" }
+func (cf *CompiledFunction) Inspect() string {
+	if cf.Literal == nil {
+		return "compiled program"
+	}
+	return "compiled " + cf.Literal.String()
+}
+
+// NodeAt returns the node that the instruction at offset was compiled from.
+func (cf *CompiledFunction) NodeAt(offset int) ast.Node {
+	i := sort.Search(len(cf.Positions), func(i int) bool { return cf.Positions[i].Offset > offset })
+	if i == 0 {
+		return nil
+	}
+	return cf.Positions[i-1].Node
+}
+
+// Bytecode is a compiled program.
+type Bytecode struct {
+	Main        *CompiledFunction
+	Constants   []object.Object
+	GlobalNames []string // names of the global variables by index
+}
+
+// loop tracks the jumps out of a loop being compiled, to patch them once their targets are known.
+type loop struct {
+	level          int   // nesting level of the loop in its function, for OpLoop and OpUnwind
+	continueTarget int   // offset continue jumps to, or -1 if it is after the body
+	breaks         []int // offsets of the jumps of break statements
+	continues      []int // offsets of the jumps of continue statements, if continueTarget is -1
+}
+
+// compilationScope holds the instructions of the function being compiled.
+type compilationScope struct {
+	instructions Instructions
+	positions    []Position
+	loops        []*loop
+	names        []string // names of the local variables by slot
+}
+
+// Compiler compiles programs whose variables have been resolved by the resolver package,
+// which Compile does itself before compiling them.
+type Compiler struct {
+	constants []object.Object
+	indexes   map[constantKey]int // the indexes of the constants, so that equal constants are added once
+	globals   *Globals
+	scopes    []*compilationScope
+}
+
+// New returns a Compiler for a program with its own global variables.
+func New() *Compiler {
+	return NewWithState(NewGlobals(), []object.Object{})
+}
+
+// NewWithState returns a Compiler for a program that shares the global variables and constants
+// of previously compiled programs, e.g. in a REPL. Constants equal to previous ones reuse them,
+// so that running the same programs again does not grow the constants.
+func NewWithState(globals *Globals, constants []object.Object) *Compiler {
+	c := &Compiler{
+		constants: constants,
+		indexes:   make(map[constantKey]int, len(constants)),
+		globals:   globals,
+		scopes:    []*compilationScope{{}},
+	}
+	for i, obj := range constants {
+		if key, ok := keyOf(obj); ok {
+			c.indexes[key] = i
+		}
+	}
+	return c
+}
+
+// Compile resolves the variables of a program and compiles it.
+// Undefined variables are not reported, as they may be defined by later programs.
+func (c *Compiler) Compile(program *ast.Program) error {
+	resolver.Resolve(program, nil)
+	return c.CompileResolved(program)
+}
+
+// CompileResolved compiles a program whose variables have been resolved by resolver.Resolve.
+func (c *Compiler) CompileResolved(program *ast.Program) (err error) {
+	// errors are rare, e.g. programs too large to encode, so they are raised as panics of compileError
+	defer func() {
+		if r := recover(); r != nil {
+			compileErr, ok := r.(compileError)
+			if !ok {
+				panic(r)
+			}
+			err = compileErr
+		}
+	}()
+
+	c.scope().names = make([]string, program.Slots)
+
+	stmts := program.Statements
+	if len(stmts) == 0 {
+		c.emit(program, OpReturn)
+		return nil
+	}
+
+	for _, stmt := range stmts[:len(stmts)-1] {
+		c.compileStatement(stmt)
+	}
+
+	// the program evaluates to its last statement, or to nothing if it is a let statement
+	switch last := stmts[len(stmts)-1].(type) {
+	case *ast.LetStatement:
+		c.compileStatement(last)
+		c.emit(last, OpReturn)
+	default:
+		c.compileValueStatement(last, false)
+		c.emit(last, OpReturnValue)
+	}
+
+	return nil
+}
+
+type compileError struct {
+	node ast.Node
+	msg  string
+}
+
+func (e compileError) Error() string {
+	return fmt.Sprintf("%s: %s", e.node.Span().Start, e.msg)
+}
+
+func (c *Compiler) fail(node ast.Node, format string, args ...interface{}) {
+	panic(compileError{node: node, msg: fmt.Sprintf(format, args...)})
+}
+
+// Bytecode returns the compiled program.
+func (c *Compiler) Bytecode() *Bytecode {
+	return &Bytecode{
+		Main: &CompiledFunction{
+			Instructions: c.scope().instructions,
+			NumLocals:    len(c.scope().names),
+			LocalNames:   c.scope().names,
+			Positions:    c.scope().positions,
+		},
+		Constants:   c.constants,
+		GlobalNames: c.globals.Names(),
+	}
+}
+
+func (c *Compiler) scope() *compilationScope {
+	return c.scopes[len(c.scopes)-1]
+}
+
+// emit appends an instruction compiled from node, returning its offset.
+func (c *Compiler) emit(node ast.Node, op Opcode, operands ...int) int {
+	for i, operand := range operands {
+		if operand >= 1<<(8*uint(definitions[op].OperandWidths[i])) {
+			c.fail(node, "program too large: %s operand %d out of range", definitions[op].Name, operand)
+		}
+	}
+
+	scope := c.scope()
+	offset := len(scope.instructions)
+	scope.instructions = append(scope.instructions, Make(op, operands...)...)
+	scope.positions = append(scope.positions, Position{Offset: offset, Node: node})
+	return offset
+}
+
+// patchJump sets the target of the jump at offset to the current end of the instructions.
+func (c *Compiler) patchJump(offset int) {
+	instructions := c.scope().instructions
+	target := len(instructions)
+	if target > math.MaxUint16 {
+		c.fail(c.scope().positions[0].Node, "program too large: jump target %d out of range", target)
+	}
+	copy(instructions[offset+1:], Make(Opcode(instructions[offset]), target)[1:])
+}
+
+func (c *Compiler) addConstant(obj object.Object) int {
+	key, ok := keyOf(obj)
+	if ok {
+		if i, ok := c.indexes[key]; ok {
+			return i
+		}
+	}
+
+	c.constants = append(c.constants, obj)
+	i := len(c.constants) - 1
+	if ok {
+		c.indexes[key] = i
+	}
+	return i
+}
+
+// constantKey identifies constants that are interchangeable.
+type constantKey struct {
+	typ   object.ObjectType
+	value interface{}
+}
+
+// functionKey identifies compiled functions with the same source and bytecode.
+type functionKey struct {
+	span               token.Span
+	name, source, code string
+}
+
+func keyOf(obj object.Object) (constantKey, bool) {
+	var value interface{}
+	switch obj := obj.(type) {
+	case *object.Integer:
+		value = obj.Value
+	case *object.BigInteger:
+		value = obj.Value.String()
+	case *object.Float:
+		// by bits rather than value, to tell -0.0 from 0.0
+		value = math.Float64bits(obj.Value)
+	case *object.String:
+		value = obj.Value
+	case *CompiledFunction:
+		if obj.Literal == nil {
+			return constantKey{}, false
+		}
+		value = functionKey{
+			span:   obj.Literal.Span(),
+			name:   obj.Name,
+			source: obj.Literal.String(),
+			code:   string(obj.Instructions),
+		}
+	default:
+		return constantKey{}, false
+	}
+	return constantKey{obj.Type(), value}, true
+}
+
+// compileStatement compiles a statement that leaves nothing on the stack.
+func (c *Compiler) compileStatement(stmt ast.Statement) {
+	switch stmt := stmt.(type) {
+	case *ast.ExpressionStatement:
+		c.compileExpression(stmt.Expression, false)
+		c.emit(stmt, OpPop)
+
+	case *ast.LetStatement:
+		c.compileLetStatement(stmt)
+
+	case *ast.ReturnStatement:
+		// calls in the main program are not made in tail position,
+		// so that they keep their frame in stack traces like in the evaluator
+		c.compileExpression(stmt.ReturnValue, len(c.scopes) > 1)
+		c.emit(stmt, OpReturnValue)
+
+	case *ast.WhileStatement:
+		c.compileWhileStatement(stmt)
+
+	case *ast.ForStatement:
+		c.compileForStatement(stmt)
+
+	case *ast.ForInStatement:
+		c.compileForInStatement(stmt)
+
+	case *ast.BreakStatement:
+		current := c.currentLoop(stmt)
+		c.emit(stmt, OpUnwind, current.level)
+		current.breaks = append(current.breaks, c.emit(stmt, OpJump, 0))
+
+	case *ast.ContinueStatement:
+		current := c.currentLoop(stmt)
+		c.emit(stmt, OpUnwind, current.level)
+		if current.continueTarget >= 0 {
+			c.emit(stmt, OpJump, current.continueTarget)
+		} else {
+			current.continues = append(current.continues, c.emit(stmt, OpJump, 0))
+		}
+
+	default:
+		c.fail(stmt, "cannot compile %T", stmt)
+	}
+}
+
+// compileValueStatement compiles a statement that leaves its value on the stack, like the last
+// statement of a block. Statements other than expressions have the value null.
+func (c *Compiler) compileValueStatement(stmt ast.Statement, tail bool) {
+	if stmt, ok := stmt.(*ast.ExpressionStatement); ok {
+		c.compileExpression(stmt.Expression, tail)
+		return
+	}
+
+	c.compileStatement(stmt)
+	c.emit(stmt, OpNull)
+}
+
+// compileBlock compiles the statements of a block that leaves the value of its last statement on the stack.
+func (c *Compiler) compileBlock(block *ast.BlockStatement, tail bool) {
+	if len(block.Statements) == 0 {
+		c.emit(block, OpNull)
+		return
+	}
+
+	last := len(block.Statements) - 1
+	for _, stmt := range block.Statements[:last] {
+		c.compileStatement(stmt)
+	}
+	c.compileValueStatement(block.Statements[last], tail)
+}
+
+// compileStatements compiles the statements of a block that leaves nothing on the stack, like a loop body.
+func (c *Compiler) compileStatements(block *ast.BlockStatement) {
+	for _, stmt := range block.Statements {
+		c.compileStatement(stmt)
+	}
+}
+
+func (c *Compiler) compileLetStatement(stmt *ast.LetStatement) {
+	c.compileExpression(stmt.Value, false)
+	c.define(stmt, stmt.Name)
+}
+
+// define pops the top of the stack into the variable declared by ident.
+func (c *Compiler) define(node ast.Node, ident *ast.Identifier) {
+	if ident.Scope == ast.ScopeLocal {
+		c.scope().names[ident.Index] = ident.Value
+		c.emit(node, OpSetLocal, ident.Index)
+	} else {
+		c.emit(node, OpSetGlobal, c.globals.Define(ident.Value))
+	}
+}
+
+// compileExpression compiles an expression that leaves its value on the stack.
+// Calls in tail position, whose value is returned from the enclosing function, are tail calls.
+func (c *Compiler) compileExpression(exp ast.Expression, tail bool) {
+	switch exp := exp.(type) {
+	case *ast.IntegerLiteral:
+		if exp.Big != nil {
+			c.emit(exp, OpConstant, c.addConstant(&object.BigInteger{Value: exp.Big}))
+		} else {
+			c.emit(exp, OpConstant, c.addConstant(&object.Integer{Value: exp.Value}))
+		}
+
+	case *ast.FloatLiteral:
+		c.emit(exp, OpConstant, c.addConstant(&object.Float{Value: exp.Value}))
+
+	case *ast.StringLiteral:
+		c.emit(exp, OpConstant, c.addConstant(&object.String{Value: exp.Value}))
+
+	case *ast.Boolean:
+		if exp.Value {
+			c.emit(exp, OpTrue)
+		} else {
+			c.emit(exp, OpFalse)
+		}
+
+	case *ast.PrefixExpression:
+		c.compileExpression(exp.Right, false)
+		c.emit(exp, OpPrefix, c.operator(exp, exp.Operator))
+
+	case *ast.InfixExpression:
+		if exp.Operator == "&&" || exp.Operator == "||" {
+			c.compileLogicalExpression(exp)
+			return
+		}
+		c.compileExpression(exp.Left, false)
+		c.compileExpression(exp.Right, false)
+		c.emit(exp, OpInfix, c.operator(exp, exp.Operator))
+
+	case *ast.AssignExpression:
+		c.compileAssignExpression(exp)
+
+	case *ast.IfExpression:
+		c.compileIfExpression(exp, tail)
+
+	case *ast.Identifier:
+		c.compileIdentifier(exp)
+
+	case *ast.FunctionLiteral:
+		c.compileFunctionLiteral(exp)
+
+	case *ast.CallExpression:
+		if ident, ok := exp.Function.(*ast.Identifier); ok && ident.Value == "quote" {
+			c.fail(exp, "quote is only supported by the evaluator")
+		}
+		c.compileExpression(exp.Function, false)
+		for _, arg := range exp.Arguments {
+			c.compileExpression(arg, false)
+		}
+		if tail {
+			c.emit(exp, OpTailCall, len(exp.Arguments))
+		} else {
+			c.emit(exp, OpCall, len(exp.Arguments))
+		}
+
+	case *ast.ArrayLiteral:
+		for _, element := range exp.Elements {
+			c.compileExpression(element, false)
+		}
+		c.emit(exp, OpArray, len(exp.Elements))
+
+	case *ast.HashLiteral:
+		c.compileHashLiteral(exp)
+
+	case *ast.SubscriptExpression:
+		c.compileExpression(exp.Left, false)
+		c.compileExpression(exp.Index, false)
+		c.emit(exp, OpIndex)
+
+	default:
+		c.fail(exp, "cannot compile %T", exp)
+	}
+}
+
+func (c *Compiler) operator(node ast.Node, operator string) int {
+	index, ok := operatorIndex(operator)
+	if !ok {
+		c.fail(node, "unknown operator: %s", operator)
+	}
+	return index
+}
+
+// compileLogicalExpression compiles && and ||, which evaluate their right operand only if needed,
+// and evaluate to a boolean.
+func (c *Compiler) compileLogicalExpression(exp *ast.InfixExpression) {
+	shortCircuit, result := OpJumpNotTruthy, OpFalse
+	if exp.Operator == "||" {
+		shortCircuit, result = OpJumpTruthy, OpTrue
+	}
+	opposite := OpTrue
+	if result == OpTrue {
+		opposite = OpFalse
+	}
+
+	c.compileExpression(exp.Left, false)
+	leftJump := c.emit(exp, shortCircuit, 0)
+	c.compileExpression(exp.Right, false)
+	rightJump := c.emit(exp, shortCircuit, 0)
+
+	c.emit(exp, opposite)
+	endJump := c.emit(exp, OpJump, 0)
+
+	c.patchJump(leftJump)
+	c.patchJump(rightJump)
+	c.emit(exp, result)
+	c.patchJump(endJump)
+}
+
+func (c *Compiler) compileAssignExpression(exp *ast.AssignExpression) {
+	operator := 0
+	if exp.Operator != "=" {
+		operator = c.operator(exp, strings.TrimSuffix(exp.Operator, "=")) + 1
+	}
+
+	c.compileExpression(exp.Value, false)
+
+	name := exp.Name
+	switch name.Scope {
+	case ast.ScopeLocal:
+		c.emit(exp, OpAssignLocal, name.Index, operator)
+	case ast.ScopeFree:
+		c.emit(exp, OpAssignOuter, name.Depth, name.Index, operator)
+	default:
+		c.emit(exp, OpAssignGlobal, c.globals.Define(name.Value), operator)
+	}
+}
+
+func (c *Compiler) compileIdentifier(exp *ast.Identifier) {
+	switch exp.Scope {
+	case ast.ScopeLocal:
+		c.emit(exp, OpGetLocal, exp.Index)
+	case ast.ScopeFree:
+		c.emit(exp, OpGetOuter, exp.Depth, exp.Index)
+	default:
+		c.emit(exp, OpGetGlobal, c.globals.Define(exp.Value))
+	}
+}
+
+func (c *Compiler) compileIfExpression(exp *ast.IfExpression, tail bool) {
+	c.compileExpression(exp.Condition, false)
+	elseJump := c.emit(exp, OpJumpNotTruthy, 0)
+
+	c.compileBlock(exp.Consequence, tail)
+	endJump := c.emit(exp, OpJump, 0)
+
+	c.patchJump(elseJump)
+	if exp.Alternative != nil {
+		c.compileBlock(exp.Alternative, tail)
+	} else {
+		c.emit(exp, OpNull)
+	}
+	c.patchJump(endJump)
+}
+
+// compileHashLiteral compiles the pairs of a hash literal in the order they appear in the source.
+func (c *Compiler) compileHashLiteral(exp *ast.HashLiteral) {
+	keys := make([]ast.Expression, 0, len(exp.Pairs))
+	for key := range exp.Pairs {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].Span().Start.Offset < keys[j].Span().Start.Offset
+	})
+
+	for _, key := range keys {
+		c.compileExpression(key, false)
+		c.compileExpression(exp.Pairs[key], false)
+	}
+	c.emit(exp, OpHash, len(keys))
+}
+
+func (c *Compiler) compileFunctionLiteral(exp *ast.FunctionLiteral) {
+	scope := &compilationScope{names: make([]string, exp.Slots)}
+	c.scopes = append(c.scopes, scope)
+
+	for _, param := range exp.Parameters {
+		scope.names[param.Index] = param.Value
+	}
+	c.compileBlock(exp.Body, true)
+	c.emit(exp.Body, OpReturnValue)
+
+	fn := &CompiledFunction{
+		Instructions:  c.scope().instructions,
+		NumLocals:     exp.Slots,
+		NumParameters: len(exp.Parameters),
+		Name:          exp.Name,
+		LocalNames:    scope.names,
+		Positions:     c.scope().positions,
+		Literal:       exp,
+	}
+
+	c.scopes = c.scopes[:len(c.scopes)-1]
+
+	c.emit(exp, OpClosure, c.addConstant(fn))
+}
+
+func (c *Compiler) currentLoop(stmt ast.Statement) *loop {
+	loops := c.scope().loops
+	if len(loops) == 0 {
+		c.fail(stmt, "%s outside loop", stmt.TokenLiteral())
+	}
+	return loops[len(loops)-1]
+}
+
+// enterLoop makes the loop whose body is compiled next the innermost one.
+// Its head, which starts with OpLoop, belongs to the enclosing loop,
+// since break and continue statements refer to the loop whose body they are in.
+func (c *Compiler) enterLoop(continueTarget int) *loop {
+	l := &loop{level: c.nextLoopLevel(), continueTarget: continueTarget}
+	c.scope().loops = append(c.scope().loops, l)
+	return l
+}
+
+// nextLoopLevel returns the nesting level of a loop entered in the current function.
+func (c *Compiler) nextLoopLevel() int {
+	return len(c.scope().loops)
+}
+
+// leaveLoop patches the break statements of the innermost loop to jump to the current offset.
+func (c *Compiler) leaveLoop() {
+	scope := c.scope()
+	l := scope.loops[len(scope.loops)-1]
+	scope.loops = scope.loops[:len(scope.loops)-1]
+
+	for _, offset := range l.breaks {
+		c.patchJump(offset)
+	}
+}
+
+func (c *Compiler) compileWhileStatement(stmt *ast.WhileStatement) {
+	c.emit(stmt, OpLoop, c.nextLoopLevel())
+	start := len(c.scope().instructions)
+
+	c.compileExpression(stmt.Condition, false)
+	endJump := c.emit(stmt, OpJumpNotTruthy, 0)
+	c.enterLoop(start)
+	c.compileStatements(stmt.Body)
+	c.emit(stmt, OpJump, start)
+
+	c.patchJump(endJump)
+	c.leaveLoop()
+}
+
+func (c *Compiler) compileForStatement(stmt *ast.ForStatement) {
+	if stmt.Init != nil {
+		c.compileStatement(stmt.Init)
+	}
+
+	c.emit(stmt, OpLoop, c.nextLoopLevel())
+	start := len(c.scope().instructions)
+
+	endJump := -1
+	if stmt.Condition != nil {
+		c.compileExpression(stmt.Condition, false)
+		endJump = c.emit(stmt, OpJumpNotTruthy, 0)
+	}
+
+	l := c.enterLoop(-1)
+	c.compileStatements(stmt.Body)
+
+	for _, offset := range l.continues {
+		c.patchJump(offset)
+	}
+	if stmt.Post != nil {
+		// like the condition, the post expression belongs to the enclosing loop
+		scope := c.scope()
+		scope.loops = scope.loops[:len(scope.loops)-1]
+		c.compileExpression(stmt.Post, false)
+		c.emit(stmt, OpPop)
+		scope.loops = append(scope.loops, l)
+	}
+	c.emit(stmt, OpJump, start)
+
+	if endJump >= 0 {
+		c.patchJump(endJump)
+	}
+	c.leaveLoop()
+}
+
+func (c *Compiler) compileForInStatement(stmt *ast.ForInStatement) {
+	c.compileExpression(stmt.Iterable, false)
+	hasKey := 0
+	if stmt.Key != nil {
+		hasKey = 1
+	}
+	c.emit(stmt, OpIter, hasKey)
+
+	c.emit(stmt, OpLoop, c.nextLoopLevel())
+	start := len(c.scope().instructions)
+	c.enterLoop(start)
+
+	endJump := c.emit(stmt, OpIterNext, 0)
+	if stmt.Key != nil {
+		c.define(stmt.Key, stmt.Key)
+	}
+	c.define(stmt.Value, stmt.Value)
+
+	c.compileStatements(stmt.Body)
+	c.emit(stmt, OpJump, start)
+
+	c.patchJump(endJump)
+	c.leaveLoop()
+
+	// pop the iterator, also after break statements
+	c.emit(stmt, OpPop)
+}
@@ -0,0 +1,255 @@
+package compiler
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/GenericEntity/interpreter-go/monkey/ast"
+	"github.com/GenericEntity/interpreter-go/monkey/lexer"
+	"github.com/GenericEntity/interpreter-go/monkey/object"
+	"github.com/GenericEntity/interpreter-go/monkey/parser"
+	"github.com/GenericEntity/interpreter-go/monkey/token"
+)
+
+func TestMake(t *testing.T) {
+	tests := []struct {
+		op       Opcode
+		operands []int
+		expected []byte
+	}{
+		{OpConstant, []int{65534}, []byte{byte(OpConstant), 255, 254}},
+		{OpPop, []int{}, []byte{byte(OpPop)}},
+		{OpGetOuter, []int{2, 300}, []byte{byte(OpGetOuter), 2, 1, 44}},
+		{OpAssignOuter, []int{1, 2, 3}, []byte{byte(OpAssignOuter), 1, 0, 2, 3}},
+	}
+
+	for _, tt := range tests {
+		instruction := Make(tt.op, tt.operands...)
+		if string(instruction) != string(tt.expected) {
+			t.Errorf("wrong instruction. expected=%v, got=%v", tt.expected, instruction)
+			continue
+		}
+
+		def, err := Lookup(byte(tt.op))
+		if err != nil {
+			t.Fatalf("definition not found: %s", err)
+		}
+		operands, read := ReadOperands(def, instruction[1:])
+		if read != len(tt.expected)-1 {
+			t.Errorf("wrong number of bytes read. expected=%d, got=%d", len(tt.expected)-1, read)
+		}
+		for i, want := range tt.operands {
+			if operands[i] != want {
+				t.Errorf("wrong operand %d. expected=%d, got=%d", i, want, operands[i])
+			}
+		}
+	}
+}
+
+func TestInstructionsString(t *testing.T) {
+	instructions := Instructions{}
+	for _, ins := range [][]byte{
+		Make(OpConstant, 1),
+		Make(OpInfix, 0),
+		Make(OpGetOuter, 1, 2),
+		Make(OpReturnValue),
+	} {
+		instructions = append(instructions, ins...)
+	}
+
+	expected := `0000 OpConstant 1
+0003 OpInfix 0
+0005 OpGetOuter 1 2
+0009 OpReturnValue
+`
+	if instructions.String() != expected {
+		t.Errorf("wrong disassembly.\nexpected=%q\n     got=%q", expected, instructions.String())
+	}
+}
+
+func TestCompile(t *testing.T) {
+	tests := []struct {
+		input             string
+		expectedConstants []interface{}
+		expected          [][]byte
+	}{
+		{
+			"1 + 2",
+			[]interface{}{1, 2},
+			[][]byte{Make(OpConstant, 0), Make(OpConstant, 1), Make(OpInfix, 0), Make(OpReturnValue)},
+		},
+		{
+			"let x = 1;",
+			[]interface{}{1},
+			[][]byte{Make(OpConstant, 0), Make(OpSetGlobal, 0), Make(OpReturn)},
+		},
+		{
+			"if (true) { 10 }; x",
+			[]interface{}{10},
+			[][]byte{
+				Make(OpTrue), Make(OpJumpNotTruthy, 10), Make(OpConstant, 0), Make(OpJump, 11), Make(OpNull),
+				Make(OpPop), Make(OpGetGlobal, 0), Make(OpReturnValue),
+			},
+		},
+		{
+			"true && false",
+			[]interface{}{},
+			[][]byte{
+				Make(OpTrue), Make(OpJumpNotTruthy, 12), Make(OpFalse), Make(OpJumpNotTruthy, 12),
+				Make(OpTrue), Make(OpJump, 13), Make(OpFalse), Make(OpReturnValue),
+			},
+		},
+		{
+			"x += 2",
+			[]interface{}{2},
+			[][]byte{Make(OpConstant, 0), Make(OpAssignGlobal, 0, 1), Make(OpReturnValue)},
+		},
+		{
+			"while (true) { break }",
+			[]interface{}{},
+			[][]byte{
+				Make(OpLoop, 0), Make(OpTrue), Make(OpJumpNotTruthy, 14), Make(OpUnwind, 0), Make(OpJump, 14),
+				Make(OpJump, 2), Make(OpNull), Make(OpReturnValue),
+			},
+		},
+		{
+			"[1, 2][0]",
+			[]interface{}{1, 2, 0},
+			[][]byte{
+				Make(OpConstant, 0), Make(OpConstant, 1), Make(OpArray, 2), Make(OpConstant, 2), Make(OpIndex),
+				Make(OpReturnValue),
+			},
+		},
+		{
+			"[1, 2, 1]",
+			[]interface{}{1, 2},
+			[][]byte{
+				Make(OpConstant, 0), Make(OpConstant, 1), Make(OpConstant, 0), Make(OpArray, 3), Make(OpReturnValue),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		bytecode := testCompile(t, tt.input)
+
+		var expected Instructions
+		for _, ins := range tt.expected {
+			expected = append(expected, ins...)
+		}
+		if bytecode.Main.Instructions.String() != expected.String() {
+			t.Errorf("wrong instructions for %q.\nexpected=\n%s\ngot=\n%s",
+				tt.input, expected, bytecode.Main.Instructions)
+		}
+
+		if len(bytecode.Constants) != len(tt.expectedConstants) {
+			t.Errorf("wrong number of constants for %q. expected=%d, got=%d",
+				tt.input, len(tt.expectedConstants), len(bytecode.Constants))
+			continue
+		}
+		for i, constant := range tt.expectedConstants {
+			integer, ok := bytecode.Constants[i].(*object.Integer)
+			if !ok || integer.Value != int64(constant.(int)) {
+				t.Errorf("wrong constant %d for %q. expected=%v, got=%v", i, tt.input, constant, bytecode.Constants[i])
+			}
+		}
+	}
+}
+
+func TestCompileFunctions(t *testing.T) {
+	input := `
+let counter = fn(start) {
+	let n = start;
+	fn() { n += 1; len(n) }
+};`
+	bytecode := testCompile(t, input)
+
+	fns := []*CompiledFunction{}
+	for _, constant := range bytecode.Constants {
+		if fn, ok := constant.(*CompiledFunction); ok {
+			fns = append(fns, fn)
+		}
+	}
+	if len(fns) != 2 {
+		t.Fatalf("wrong number of functions. expected=2, got=%d", len(fns))
+	}
+	inner, outer := fns[0], fns[1]
+
+	if outer.Name != "counter" || outer.NumParameters != 1 || outer.NumLocals != 2 {
+		t.Errorf("wrong outer function. name=%q, parameters=%d, locals=%d",
+			outer.Name, outer.NumParameters, outer.NumLocals)
+	}
+	if strings.Join(outer.LocalNames, ",") != "start,n" {
+		t.Errorf("wrong local names. got=%v", outer.LocalNames)
+	}
+
+	// the inner function updates a variable of the outer function, and looks up len as a global
+	if !strings.Contains(inner.Instructions.String(), "OpAssignOuter 1 1 1") {
+		t.Errorf("outer variable not assigned.\n%s", inner.Instructions)
+	}
+	if !strings.Contains(inner.Instructions.String(), "OpGetGlobal 0") || bytecode.GlobalNames[0] != "len" {
+		t.Errorf("builtin not resolved as global. globals=%v\n%s", bytecode.GlobalNames, inner.Instructions)
+	}
+	if !strings.HasSuffix(inner.Instructions.String(), "0016 OpTailCall 1\n0018 OpReturnValue\n") {
+		t.Errorf("call not compiled as tail call.\n%s", inner.Instructions)
+	}
+
+	// instructions map back to the nodes they were compiled from
+	if node, ok := inner.NodeAt(len(inner.Instructions) - 3).(*ast.CallExpression); !ok || node.String() != "len(n)" {
+		t.Errorf("wrong node for tail call. got=%v", inner.NodeAt(len(inner.Instructions)-3))
+	}
+}
+
+func TestCompileWithState(t *testing.T) {
+	globals := NewGlobals()
+	constants := []object.Object{}
+	for _, input := range []string{
+		`let f = fn(x) { x + 1.5 }; f("a")`,
+		`let f = fn(x) { x + 1.5 }; f("a")`,
+		`let g = fn(x) { x + 1.5 }; f("a")`,
+	} {
+		program := parser.New(lexer.New(input)).ParseProgram()
+		c := NewWithState(globals, constants)
+		if err := c.Compile(program); err != nil {
+			t.Fatalf("compiler error for %q: %s", input, err)
+		}
+		constants = c.Bytecode().Constants
+	}
+
+	// the second program reuses the constants of the first, and the third only adds its function
+	if len(constants) != 4 {
+		t.Errorf("wrong number of constants. expected=4, got=%d: %v", len(constants), constants)
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	// the parser does not allow break statements outside loops, but programs can be built by hand
+	brk := token.Token{Type: token.BREAK, Literal: "break", Span: token.Span{Start: token.Position{Line: 1, Column: 1}}}
+	program := &ast.Program{Statements: []ast.Statement{&ast.BreakStatement{Token: brk}}}
+
+	err := New().Compile(program)
+	if err == nil || err.Error() != "1:1: break outside loop" {
+		t.Errorf("wrong error. expected=%q, got=%v", "1:1: break outside loop", err)
+	}
+
+	program = parser.New(lexer.New("1; quote(x)")).ParseProgram()
+	err = New().Compile(program)
+	if err == nil || err.Error() != "1:4: quote is only supported by the evaluator" {
+		t.Errorf("wrong error. expected=%q, got=%v", "1:4: quote is only supported by the evaluator", err)
+	}
+}
+
+func testCompile(t *testing.T, input string) *Bytecode {
+	t.Helper()
+
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors for %q: %v", input, p.Errors())
+	}
+
+	c := New()
+	if err := c.Compile(program); err != nil {
+		t.Fatalf("compiler error for %q: %s", input, err)
+	}
+	return c.Bytecode()
+}
@@ -0,0 +1,34 @@
+package compiler
+
+// Globals are the names of the global variables, indexed like the globals of the vm.
+// They are shared by all programs compiled for the same globals.
+type Globals struct {
+	names   []string
+	indexes map[string]int
+}
+
+// NewGlobals returns an empty set of global variables.
+func NewGlobals() *Globals {
+	return &Globals{indexes: map[string]int{}}
+}
+
+// Define returns the index of the global variable name, adding it if there is none.
+func (g *Globals) Define(name string) int {
+	if i, ok := g.indexes[name]; ok {
+		return i
+	}
+	g.indexes[name] = len(g.names)
+	g.names = append(g.names, name)
+	return len(g.names) - 1
+}
+
+// Lookup returns the index of the global variable name, if there is one.
+func (g *Globals) Lookup(name string) (int, bool) {
+	i, ok := g.indexes[name]
+	return i, ok
+}
+
+// Names returns the names of the global variables by index.
+func (g *Globals) Names() []string {
+	return g.names
+}
@@ -0,0 +1,85 @@
+package evaluator
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/GenericEntity/interpreter-go/monkey/object"
+)
+
+var (
+	// ErrStepLimit is the cause of the error returned when evaluation exceeds Evaluator.MaxSteps.
+	ErrStepLimit = errors.New("step limit exceeded")
+
+	// ErrAllocationLimit is the cause of the error returned when evaluation exceeds Evaluator.MaxAllocations.
+	ErrAllocationLimit = errors.New("allocation limit exceeded")
+)
+
+// Usage is the resources consumed by an Evaluator.
+type Usage struct {
+	// Steps is the number of AST nodes evaluated, or of instructions run by other execution engines.
+	Steps int
+
+	// Allocations approximates the memory allocated for arrays, hashes, strings and big integers:
+	// each counts as one allocation, plus one per element, pair, byte or machine word it holds.
+	Allocations int
+}
+
+// Usage returns the resources consumed by all evaluations since e was created or ResetUsage was called.
+func (e *Evaluator) Usage() Usage {
+	return e.usage
+}
+
+// ResetUsage sets the consumed resources to zero, giving e a fresh budget.
+func (e *Evaluator) ResetUsage() {
+	e.usage = Usage{}
+}
+
+// Step records a step of another execution engine, such as an instruction of the vm package,
+// and returns an error if it exceeds the step budget.
+func (e *Evaluator) Step() *object.Error {
+	return e.step()
+}
+
+// Allocate records the allocation of obj by another execution engine like an evaluation would,
+// returning obj, or an error if it exceeds the allocation budget.
+func (e *Evaluator) Allocate(obj object.Object) object.Object {
+	return e.allocate(obj)
+}
+
+// step records the evaluation of a node, and returns an error if it exceeds the step budget.
+func (e *Evaluator) step() *object.Error {
+	e.usage.Steps++
+	if e.MaxSteps > 0 && e.usage.Steps > e.MaxSteps {
+		return budgetError(ErrStepLimit, e.MaxSteps, "steps")
+	}
+	return nil
+}
+
+// allocate records the allocation of obj, returning obj,
+// or an error if it exceeds the allocation budget.
+func (e *Evaluator) allocate(obj object.Object) object.Object {
+	size := 1
+	switch obj := obj.(type) {
+	case *object.Array:
+		size += len(obj.Elements)
+	case *object.Hash:
+		size += len(obj.Pairs)
+	case *object.String:
+		size += len(obj.Value)
+	case *object.BigInteger:
+		size += len(obj.Value.Bits())
+	default:
+		return obj
+	}
+
+	e.usage.Allocations += size
+	if e.MaxAllocations > 0 && e.usage.Allocations > e.MaxAllocations {
+		return budgetError(ErrAllocationLimit, e.MaxAllocations, "allocations")
+	}
+	return obj
+}
+
+func budgetError(err error, limit int, unit string) *object.Error {
+	return &object.Error{Message: fmt.Sprintf("%s: limit is %d %s", err, limit, unit), Err: err}
+}
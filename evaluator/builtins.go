@@ -2,6 +2,11 @@ package evaluator
 
 import (
 	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+	"unicode/utf8"
 
 	"github.com/GenericEntity/interpreter-go/monkey/object"
 )
@@ -39,6 +44,34 @@ func newTypeNotSupportedError(funcName string, position int, arg object.Object)
 	return newError("type of %s argument to `%s` not supported, got %s", formatPosition(position), funcName, arg.Type())
 }
 
+// Any matches arguments of any type in CheckArgs and Typed.
+const Any object.ObjectType = "ANY"
+
+// CheckArgs returns an error if the arguments to the builtin function funcName
+// do not match the given types, one per parameter.
+func CheckArgs(funcName string, args []object.Object, types ...object.ObjectType) *object.Error {
+	if err := checkArgsLen(len(types), args...); err != nil {
+		return err
+	}
+	for i, arg := range args {
+		if types[i] != Any && arg.Type() != types[i] {
+			return newTypeNotSupportedError(funcName, i+1, arg)
+		}
+	}
+	return nil
+}
+
+// Typed returns a builtin function that calls fn if its arguments match the given types,
+// and returns the error from CheckArgs otherwise.
+func Typed(funcName string, fn object.BuiltinFunction, types ...object.ObjectType) object.BuiltinFunction {
+	return func(args ...object.Object) object.Object {
+		if err := CheckArgs(funcName, args, types...); err != nil {
+			return err
+		}
+		return fn(args...)
+	}
+}
+
 var builtins = map[string]*object.Builtin{
 	"len": {
 		Fn: func(args ...object.Object) object.Object {
@@ -48,7 +81,8 @@ var builtins = map[string]*object.Builtin{
 
 			switch arg := args[0].(type) {
 			case *object.String:
-				return &object.Integer{Value: int64(len(arg.Value))}
+				// characters, like for-in loops over strings, rather than bytes
+				return &object.Integer{Value: int64(utf8.RuneCountInString(arg.Value))}
 
 			case *object.Array:
 				return &object.Integer{Value: int64(len(arg.Elements))}
@@ -141,15 +175,6 @@ var builtins = map[string]*object.Builtin{
 		},
 	},
 
-	"puts": {
-		Fn: func(args ...object.Object) object.Object {
-			for _, arg := range args {
-				fmt.Println(arg.Inspect())
-			}
-			return NULL
-		},
-	},
-
 	"put": {
 		Fn: func(args ...object.Object) object.Object {
 			const funcName = "put"
@@ -181,4 +206,80 @@ var builtins = map[string]*object.Builtin{
 			}
 		},
 	},
+
+	"int": {
+		Fn: func(args ...object.Object) object.Object {
+			if err := checkArgsLen(1, args...); err != nil {
+				return err
+			}
+
+			switch arg := args[0].(type) {
+			case *object.Integer, *object.BigInteger:
+				return arg
+
+			case *object.Float:
+				// truncates towards zero
+				if math.IsNaN(arg.Value) || math.IsInf(arg.Value, 0) {
+					return newError("could not convert %s to an integer", arg.Inspect())
+				}
+				if math.MinInt64 <= arg.Value && arg.Value < math.MaxInt64 {
+					return &object.Integer{Value: int64(arg.Value)}
+				}
+				value, _ := big.NewFloat(arg.Value).Int(nil)
+				return object.NewInteger(value)
+
+			case *object.String:
+				value, ok := new(big.Int).SetString(strings.TrimSpace(arg.Value), 10)
+				if !ok {
+					return newError("could not parse %q as an integer", arg.Value)
+				}
+				return object.NewInteger(value)
+
+			default:
+				return newTypeNotSupportedError("int", 1, arg)
+			}
+		},
+	},
+
+	"float": {
+		Fn: func(args ...object.Object) object.Object {
+			if err := checkArgsLen(1, args...); err != nil {
+				return err
+			}
+
+			switch arg := args[0].(type) {
+			case *object.Integer:
+				return &object.Float{Value: float64(arg.Value)}
+
+			case *object.BigInteger:
+				return &object.Float{Value: bigToFloat(arg.Value)}
+
+			case *object.Float:
+				return arg
+
+			case *object.String:
+				value, err := strconv.ParseFloat(strings.TrimSpace(arg.Value), 64)
+				if err != nil {
+					return newError("could not parse %q as a float", arg.Value)
+				}
+				return &object.Float{Value: value}
+
+			default:
+				return newTypeNotSupportedError("float", 1, arg)
+			}
+		},
+	},
+
+	"str": {
+		Fn: func(args ...object.Object) object.Object {
+			if err := checkArgsLen(1, args...); err != nil {
+				return err
+			}
+
+			if arg, ok := args[0].(*object.String); ok {
+				return arg
+			}
+			return &object.String{Value: args[0].Inspect()}
+		},
+	},
 }
@@ -1,74 +1,225 @@
 package evaluator
 
 import (
+	"bufio"
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"strings"
 
 	"github.com/GenericEntity/interpreter-go/monkey/ast"
 	"github.com/GenericEntity/interpreter-go/monkey/object"
+	"github.com/GenericEntity/interpreter-go/monkey/resolver"
 )
 
 var (
-	NULL  = &object.Null{}
-	TRUE  = &object.Boolean{Value: true}
-	FALSE = &object.Boolean{Value: false}
+	NULL     = &object.Null{}
+	TRUE     = &object.Boolean{Value: true}
+	FALSE    = &object.Boolean{Value: false}
+	BREAK    = &object.Break{}
+	CONTINUE = &object.Continue{}
 )
 
+var (
+	// ErrMaxDepth is the cause of the error returned when function calls nest deeper than Evaluator.MaxDepth.
+	ErrMaxDepth = errors.New("maximum recursion depth exceeded")
+)
+
+// DefaultMaxDepth is the maximum depth of nested function calls if Evaluator.MaxDepth is 0.
+const DefaultMaxDepth = 10000
+
+// Evaluator evaluates Monkey programs. The zero value is ready to use.
+// An Evaluator must not be used by multiple goroutines at once.
+type Evaluator struct {
+	// CheckedArithmetic makes integer overflow in +, -, *, /, **, << and negation an error
+	// instead of promoting the result to a big integer.
+	CheckedArithmetic bool
+
+	// MaxDepth is the maximum depth of nested function calls (tail calls do not nest),
+	// beyond which evaluation fails instead of exhausting the Go stack.
+	// If it is 0, DefaultMaxDepth is used.
+	MaxDepth int
+
+	// MaxSteps is the maximum number of AST nodes to evaluate, beyond which evaluation fails
+	// with ErrStepLimit. If it is 0, the number of steps is unlimited.
+	MaxSteps int
+
+	// MaxAllocations is the maximum size of the arrays, hashes, strings and big integers to allocate
+	// (see Usage.Allocations), beyond which evaluation fails with ErrAllocationLimit.
+	// If it is 0, allocations are unlimited.
+	MaxAllocations int
+
+	// Builtins are the builtin functions available to programs.
+	// If it is nil, the default builtins are available (see DefaultBuiltins).
+	Builtins *Registry
+
+	// Stdout is where output builtins such as puts write. If it is nil, os.Stdout is used.
+	Stdout io.Writer
+
+	// Stdin is where input builtins such as readline read from. If it is nil, os.Stdin is used.
+	// Unless it is a *bufio.Reader, it is buffered, so input may be read ahead of the builtins.
+	Stdin io.Reader
+
+	defaults    *Registry     // the default builtins, used if Builtins is nil and created on first use
+	stdinReader *bufio.Reader // Stdin, buffered for reading lines
+	stdinSource io.Reader     // the Stdin that stdinReader reads from
+
+	usage Usage           // resources consumed so far
+	depth int             // current depth of nested function calls
+	ctx   context.Context // the context of the current evaluation, if any
+}
+
+// New returns an Evaluator with the default settings.
+func New() *Evaluator {
+	return &Evaluator{}
+}
+
+func (e *Evaluator) maxDepth() int {
+	if e.MaxDepth == 0 {
+		return DefaultMaxDepth
+	}
+	return e.MaxDepth
+}
+
+// Eval evaluates node in env using an Evaluator with the default settings.
 func Eval(node ast.Node, env *object.Environment) object.Object {
+	return New().Eval(node, env)
+}
+
+// EvalContext evaluates node in env using an Evaluator with the default settings,
+// until ctx is done (see Evaluator.EvalContext).
+func EvalContext(ctx context.Context, node ast.Node, env *object.Environment) object.Object {
+	return New().EvalContext(ctx, node, env)
+}
+
+// EvalContext is like Eval, but stops evaluation once ctx is done.
+// Evaluation then fails with an error whose Err is ctx.Err().
+// The context is checked at every function call and loop iteration.
+func (e *Evaluator) EvalContext(ctx context.Context, node ast.Node, env *object.Environment) object.Object {
+	outer := e.ctx
+	e.ctx = ctx
+	defer func() { e.ctx = outer }()
+
+	return e.Eval(node, env)
+}
+
+// checkContext returns an error if the context of the current evaluation is done.
+func (e *Evaluator) checkContext() *object.Error {
+	if e.ctx == nil {
+		return nil
+	}
+
+	select {
+	case <-e.ctx.Done():
+		err := e.ctx.Err()
+		return &object.Error{Message: "evaluation stopped: " + err.Error(), Err: err}
+	default:
+		return nil
+	}
+}
+
+func (e *Evaluator) Eval(node ast.Node, env *object.Environment) object.Object {
+	if err := e.step(); err != nil {
+		return withSpan(err, node)
+	}
+	return withSpan(e.eval(node, env), node)
+}
+
+// withSpan sets the span of result to that of node if it is an error without a span.
+// The innermost node that produced an error is the most precise location for it.
+func withSpan(result object.Object, node ast.Node) object.Object {
+	if err, ok := result.(*object.Error); ok && !err.Span.Start.IsValid() {
+		err.Span = node.Span()
+	}
+	return result
+}
+
+func (e *Evaluator) eval(node ast.Node, env *object.Environment) object.Object {
 	switch node := node.(type) {
 	// Statements
 	case *ast.Program:
-		return evalProgram(node, env)
+		return e.evalProgram(node, env)
 
 	case *ast.ExpressionStatement:
-		return Eval(node.Expression, env)
+		return e.Eval(node.Expression, env)
 
 	case *ast.BlockStatement:
-		return evalBlockStatement(node.Statements, env)
+		return e.evalBlockStatement(node.Statements, env, false)
 
 	case *ast.ReturnStatement:
-		val := Eval(node.ReturnValue, env)
-		if isError(val) {
+		val := e.evalTail(node.ReturnValue, env)
+		if isSignal(val) {
 			return val
 		}
 		return &object.ReturnValue{Value: val}
 
 	case *ast.LetStatement:
-		val := Eval(node.Value, env)
-		if isError(val) {
+		val := e.Eval(node.Value, env)
+		if isSignal(val) {
 			return val
 		}
-		env.Set(node.Name.Value, val)
+		define(node.Name, val, env)
+
+	case *ast.WhileStatement:
+		return e.evalWhileStatement(node, env)
+
+	case *ast.ForStatement:
+		return e.evalForStatement(node, env)
+
+	case *ast.ForInStatement:
+		return e.evalForInStatement(node, env)
+
+	case *ast.BreakStatement:
+		return BREAK
+
+	case *ast.ContinueStatement:
+		return CONTINUE
 
 	// Expressions
 	case *ast.IntegerLiteral:
+		if node.Big != nil {
+			return e.allocate(&object.BigInteger{Value: node.Big})
+		}
 		return &object.Integer{Value: node.Value}
 
+	case *ast.FloatLiteral:
+		return &object.Float{Value: node.Value}
+
 	case *ast.Boolean:
 		return nativeBoolToBooleanObject(node.Value)
 
 	case *ast.PrefixExpression:
-		right := Eval(node.Right, env)
-		if isError(right) {
+		right := e.Eval(node.Right, env)
+		if isSignal(right) {
 			return right
 		}
-		return evalPrefixExpression(node.Operator, right)
+		return e.evalPrefixExpression(node.Operator, right)
 
 	case *ast.InfixExpression:
-		left := Eval(node.Left, env)
-		if isError(left) {
+		if node.Operator == "&&" || node.Operator == "||" {
+			return e.evalLogicalExpression(node, env)
+		}
+		left := e.Eval(node.Left, env)
+		if isSignal(left) {
 			return left
 		}
-		right := Eval(node.Right, env)
-		if isError(right) {
+		right := e.Eval(node.Right, env)
+		if isSignal(right) {
 			return right
 		}
-		return evalInfixExpression(node.Operator, left, right)
+		return e.evalInfixExpression(node.Operator, left, right)
+
+	case *ast.AssignExpression:
+		return e.evalAssignExpression(node, env)
 
 	case *ast.IfExpression:
-		return evalIfExpression(node, env)
+		return e.evalIfExpression(node, env, false)
 
 	case *ast.Identifier:
-		return evalIdentifier(node, env)
+		return e.evalIdentifier(node, env)
 
 	case *ast.FunctionLiteral:
 		params := node.Parameters
@@ -77,38 +228,80 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 			Parameters: params,
 			Body:       body,
 			Env:        env,
+			Name:       node.Name,
+			Slots:      node.Slots,
 		}
 
-	case *ast.CallExpression:
-		fn := Eval(node.Function, env)
-		if isError(fn) {
-			return fn
-		}
+	case *ast.MacroLiteral:
+		return newError("macros can only be defined by let statements at the top level of a program")
 
-		args := evalExpressions(node.Arguments, env)
-		if len(args) == 1 && isError(args[0]) {
-			return args[0]
+	case *ast.CallExpression:
+		call := e.evalCall(node, env)
+		if call, ok := call.(*tailCall); ok {
+			return e.callFunction(call)
 		}
-
-		return applyFunction(fn, args)
+		return call
 
 	case *ast.StringLiteral:
-		return &object.String{Value: node.Value}
+		return e.allocate(&object.String{Value: node.Value})
 
 	case *ast.ArrayLiteral:
-		return evalArrayLiteral(node, env)
+		return e.evalArrayLiteral(node, env)
 
 	case *ast.SubscriptExpression:
-		return evalSubscriptExpression(node, env)
+		return e.evalSubscriptExpression(node, env)
 
 	case *ast.HashLiteral:
-		return evalHashLiteral(node, env)
+		return e.evalHashLiteral(node, env)
 	}
 
 	return nil
 }
 
-func applyFunction(fn object.Object, args []object.Object) object.Object {
+// callFunction makes a call, recording it in the stack trace of an error it returns.
+func (e *Evaluator) callFunction(call *tailCall) object.Object {
+	result := e.applyFunction(call.fn, call.args)
+	if err, ok := result.(*object.Error); ok {
+		addStackFrame(err, call)
+	}
+	return result
+}
+
+func addStackFrame(err *object.Error, call *tailCall) {
+	if function, ok := call.fn.(*object.Function); ok {
+		err.Stack = append(err.Stack, object.StackFrame{
+			Function: functionName(function, call.node),
+			Call:     call.node.Span(),
+		})
+	}
+}
+
+func (e *Evaluator) applyFunction(fn object.Object, args []object.Object) object.Object {
+	result := e.applyFunctionBody(fn, args)
+
+	// calls in tail position are returned unevaluated, and made here instead of recursively,
+	// so that tail recursion runs in constant stack space
+	for {
+		call, ok := result.(*tailCall)
+		if !ok {
+			return result
+		}
+
+		result = e.applyFunctionBody(call.fn, call.args)
+		if err, ok := result.(*object.Error); ok {
+			if !err.Span.Start.IsValid() {
+				err.Span = call.node.Span()
+			}
+			// only the innermost of a chain of tail calls is in the stack trace
+			addStackFrame(err, call)
+			return err
+		}
+	}
+}
+
+// applyFunctionBody applies fn to args. Calls in tail position in the body of fn are not made,
+// but returned as a *tailCall.
+func (e *Evaluator) applyFunctionBody(fn object.Object, args []object.Object) object.Object {
 	switch function := fn.(type) {
 	case *object.Function:
 		if len(function.Parameters) != len(args) {
@@ -117,33 +310,92 @@ func applyFunction(fn object.Object, args []object.Object) object.Object {
 				len(args))
 		}
 
+		if err := e.checkContext(); err != nil {
+			return err
+		}
+		if e.depth >= e.maxDepth() {
+			return &object.Error{Message: ErrMaxDepth.Error(), Err: ErrMaxDepth}
+		}
+		e.depth++
+		defer func() { e.depth-- }()
+
 		fnCallEnv := extendFunctionEnv(function, args)
-		evaluated := Eval(function.Body, fnCallEnv)
+		evaluated := e.evalTail(function.Body, fnCallEnv)
 		return unwrapReturnValue(evaluated)
 
 	case *object.Builtin:
-		// no need to unwrap return value because we never return an object.ReturnValue
-		return function.Fn(args...)
+		// no need to unwrap return value because we never return an object.ReturnValue.
+		// builtins that return an existing array, hash or string count as allocating it
+		return e.allocate(function.Fn(args...))
 
 	default:
 		return newError("not a function: %s", fn.Type())
 	}
 }
 
+// functionName returns a name for the function to show in stack traces.
+// Anonymous functions are named by the identifier they are called through, if any.
+func functionName(function *object.Function, call *ast.CallExpression) string {
+	if function.Name != "" {
+		return function.Name
+	}
+	if ident, ok := call.Function.(*ast.Identifier); ok {
+		return ident.Value
+	}
+	return "<anonymous function>"
+}
+
 func extendFunctionEnv(function *object.Function, args []object.Object) *object.Environment {
-	env := object.ExtendEnvironment(function.Env)
+	env := object.NewFrame(function.Env, function.Slots)
 	for i, param := range function.Parameters {
-		env.Set(param.Value, args[i])
+		define(param, args[i], env)
 	}
 	return env
 }
 
-func evalExpressions(exps []ast.Expression, env *object.Environment) []object.Object {
+// define sets the variable declared by ident in env.
+func define(ident *ast.Identifier, val object.Object, env *object.Environment) {
+	switch ident.Scope {
+	case ast.ScopeLocal:
+		*env.Slot(0, ident.Index) = val
+	case ast.ScopeGlobal:
+		env.Globals().Set(ident.Value, val)
+	default:
+		env.Set(ident.Value, val)
+	}
+}
+
+// lookup returns the variable used by ident in env, if it is set.
+func lookup(ident *ast.Identifier, env *object.Environment) (object.Object, bool) {
+	switch ident.Scope {
+	case ast.ScopeLocal, ast.ScopeFree:
+		val := *env.Slot(ident.Depth, ident.Index)
+		return val, val != nil
+	case ast.ScopeGlobal:
+		return env.Globals().Get(ident.Value)
+	default:
+		return env.Get(ident.Value)
+	}
+}
+
+// assign updates the variable used by ident in env, which must be set.
+func assign(ident *ast.Identifier, val object.Object, env *object.Environment) {
+	switch ident.Scope {
+	case ast.ScopeLocal, ast.ScopeFree:
+		*env.Slot(ident.Depth, ident.Index) = val
+	case ast.ScopeGlobal:
+		env.Globals().Assign(ident.Value, val)
+	default:
+		env.Assign(ident.Value, val)
+	}
+}
+
+func (e *Evaluator) evalExpressions(exps []ast.Expression, env *object.Environment) []object.Object {
 	var result []object.Object
 
-	for _, e := range exps {
-		evaluated := Eval(e, env)
-		if isError(evaluated) {
+	for _, exp := range exps {
+		evaluated := e.Eval(exp, env)
+		if isSignal(evaluated) {
 			return []object.Object{evaluated}
 		}
 		result = append(result, evaluated)
@@ -159,14 +411,31 @@ func unwrapReturnValue(obj object.Object) object.Object {
 	return obj
 }
 
-func evalProgram(program *ast.Program, env *object.Environment) object.Object {
+// evalProgram resolves the variables of program, then evaluates it in a new frame of env.
+// Global variables are defined in env.
+func (e *Evaluator) evalProgram(program *ast.Program, env *object.Environment) object.Object {
+	defined := func(name string) bool {
+		if _, ok := env.Get(name); ok {
+			return true
+		}
+		_, ok := e.LookupBuiltin(name)
+		return ok
+	}
+	if errs := resolver.Resolve(program, defined); len(errs) != 0 {
+		return &object.Error{Message: errs[0].Message, Span: errs[0].Span}
+	}
+	env = object.NewFrame(env, program.Slots)
+
 	var result object.Object
 
 	for _, stmt := range program.Statements {
-		result = Eval(stmt, env)
+		result = e.Eval(stmt, env)
 
 		switch result := result.(type) {
 		case *object.ReturnValue:
+			if call, ok := result.Value.(*tailCall); ok {
+				return e.callFunction(call)
+			}
 			return result.Value
 		case *object.Error:
 			return result
@@ -176,11 +445,17 @@ func evalProgram(program *ast.Program, env *object.Environment) object.Object {
 	return result
 }
 
-func evalBlockStatement(stmts []ast.Statement, env *object.Environment) object.Object {
+// evalBlockStatement evaluates a block. If tail is true, the block is in tail position,
+// and so is its last statement.
+func (e *Evaluator) evalBlockStatement(stmts []ast.Statement, env *object.Environment, tail bool) object.Object {
 	var result object.Object
 
-	for _, stmt := range stmts {
-		result = Eval(stmt, env)
+	for i, stmt := range stmts {
+		if tail && i == len(stmts)-1 {
+			result = e.evalTail(stmt, env)
+		} else {
+			result = e.Eval(stmt, env)
+		}
 
 		// Eval could return nil. e.g. for LET statements
 		if result == nil {
@@ -191,7 +466,9 @@ func evalBlockStatement(stmts []ast.Statement, env *object.Environment) object.O
 
 		// Don't unwrap the return value yet (in case we're in a nested statement)
 		// This statement stops evaluation of later statements
-		if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ {
+		// break and continue likewise propagate up to the enclosing loop
+		if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ ||
+			rt == object.BREAK_OBJ || rt == object.CONTINUE_OBJ {
 			return result
 		}
 	}
@@ -206,12 +483,19 @@ func nativeBoolToBooleanObject(input bool) *object.Boolean {
 	return FALSE
 }
 
-func evalPrefixExpression(operator string, operand object.Object) object.Object {
+// Prefix applies a prefix operator to operand, like a prefix expression.
+func (e *Evaluator) Prefix(operator string, operand object.Object) object.Object {
+	return e.evalPrefixExpression(operator, operand)
+}
+
+func (e *Evaluator) evalPrefixExpression(operator string, operand object.Object) object.Object {
 	switch operator {
 	case "!":
 		return evalBangOperatorExpression(operand)
 	case "-":
-		return evalMinusPrefixOperatorExpression(operand)
+		return e.allocate(e.evalMinusPrefixOperatorExpression(operand))
+	case "~":
+		return e.allocate(evalBitwiseNotOperatorExpression(operand))
 	default:
 		return newError("unknown operator: %s%s", operator, operand.Type())
 	}
@@ -230,22 +514,54 @@ func evalBangOperatorExpression(operand object.Object) *object.Boolean {
 	}
 }
 
-func evalMinusPrefixOperatorExpression(operand object.Object) object.Object {
-	if operand.Type() != object.INTEGER_OBJ {
+func (e *Evaluator) evalMinusPrefixOperatorExpression(operand object.Object) object.Object {
+	switch operand := operand.(type) {
+	case *object.Integer:
+		if operand.Value == math.MinInt64 {
+			if e.CheckedArithmetic {
+				return newError("integer overflow: -(%d)", operand.Value)
+			}
+			return object.NewInteger(new(big.Int).Neg(big.NewInt(operand.Value)))
+		}
+		return &object.Integer{Value: -operand.Value}
+	case *object.BigInteger:
+		return object.NewInteger(new(big.Int).Neg(operand.Value))
+	case *object.Float:
+		return &object.Float{Value: -operand.Value}
+	default:
 		return newError("unknown operator: -%s", operand.Type())
 	}
+}
+
+func evalBitwiseNotOperatorExpression(operand object.Object) object.Object {
+	switch operand := operand.(type) {
+	case *object.Integer:
+		return &object.Integer{Value: ^operand.Value}
+	case *object.BigInteger:
+		return object.NewInteger(new(big.Int).Not(operand.Value))
+	default:
+		return newError("unknown operator: ~%s", operand.Type())
+	}
+}
 
-	value := operand.(*object.Integer).Value
-	return &object.Integer{Value: -value}
+// Infix applies an infix operator other than && and || to left and right, like an infix expression.
+// Together with Prefix, Index and LookupBuiltin, it lets other execution engines such as the vm package
+// share the semantics of the evaluator.
+func (e *Evaluator) Infix(operator string, left, right object.Object) object.Object {
+	return e.evalInfixExpression(operator, left, right)
 }
 
-func evalInfixExpression(operator string, left, right object.Object) object.Object {
+func (e *Evaluator) evalInfixExpression(operator string, left, right object.Object) object.Object {
 	switch {
 	case left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ:
-		return evalIntegerInfixExpression(operator, left, right)
+		return e.allocate(e.evalIntegerInfixExpression(operator, left, right))
+
+	// integers are converted to floats in mixed arithmetic
+	case isNumber(left) && isNumber(right):
+		return evalFloatInfixExpression(operator, left, right)
 
 	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ:
-		return evalStringInfixExpression(operator, left, right)
+		return e.allocate(evalStringInfixExpression(operator, left, right))
 
 	// Uses pointer comparison to handle == and != for booleans
 	//  works because there are two singleton boolean objects, TRUE and FALSE
@@ -263,23 +579,108 @@ func evalInfixExpression(operator string, left, right object.Object) object.Obje
 	}
 }
 
-func evalIntegerInfixExpression(operator string, left, right object.Object) object.Object {
-	lValue := left.(*object.Integer).Value
-	rValue := right.(*object.Integer).Value
+func (e *Evaluator) evalIntegerInfixExpression(operator string, left, right object.Object) object.Object {
+	l, lSmall := left.(*object.Integer)
+	r, rSmall := right.(*object.Integer)
+	if !lSmall || !rSmall {
+		lBig, _ := toBigInt(left)
+		rBig, _ := toBigInt(right)
+		return evalBigIntegerInfixExpression(operator, lBig, rBig)
+	}
+
+	lValue, rValue := l.Value, r.Value
+	var result int64
+	var ok bool
 
 	switch operator {
 	case "+":
-		return &object.Integer{Value: lValue + rValue}
+		result, ok = addInt64(lValue, rValue)
 	case "-":
-		return &object.Integer{Value: lValue - rValue}
+		result, ok = subInt64(lValue, rValue)
 	case "*":
-		return &object.Integer{Value: lValue * rValue}
+		result, ok = mulInt64(lValue, rValue)
+	case "**":
+		// a negative exponent gives a fraction
+		if rValue < 0 {
+			return &object.Float{Value: math.Pow(float64(lValue), float64(rValue))}
+		}
+		result, ok = intPow(lValue, rValue)
+	case "/", "%":
+		if rValue == 0 {
+			return newError("division by zero: %d %s %d", lValue, operator, rValue)
+		}
+		if operator == "%" {
+			return &object.Integer{Value: lValue % rValue}
+		}
+		// math.MinInt64 / -1 is the only quotient that overflows
+		result, ok = lValue/rValue, lValue != math.MinInt64 || rValue != -1
+	case "&":
+		return &object.Integer{Value: lValue & rValue}
+	case "|":
+		return &object.Integer{Value: lValue | rValue}
+	case "^":
+		return &object.Integer{Value: lValue ^ rValue}
+	case "<<", ">>":
+		if rValue < 0 {
+			return newError("negative shift count: %d", rValue)
+		}
+		if operator == ">>" {
+			return &object.Integer{Value: lValue >> uint64(rValue)}
+		}
+		result = lValue << uint64(rValue)
+		ok = rValue < 64 && result>>uint64(rValue) == lValue
+	case ">":
+		return nativeBoolToBooleanObject(lValue > rValue)
+	case "<":
+		return nativeBoolToBooleanObject(lValue < rValue)
+	case ">=":
+		return nativeBoolToBooleanObject(lValue >= rValue)
+	case "<=":
+		return nativeBoolToBooleanObject(lValue <= rValue)
+	case "==":
+		return nativeBoolToBooleanObject(lValue == rValue)
+	case "!=":
+		return nativeBoolToBooleanObject(lValue != rValue)
+	default:
+		return newError("unknown operator: %s %s %s",
+			left.Type(), operator, right.Type())
+	}
+
+	if ok {
+		return &object.Integer{Value: result}
+	}
+	if e.CheckedArithmetic {
+		return newError("integer overflow: %d %s %d", lValue, operator, rValue)
+	}
+	// the exact result does not fit in an int64
+	return evalBigIntegerInfixExpression(operator, big.NewInt(lValue), big.NewInt(rValue))
+}
+
+func evalFloatInfixExpression(operator string, left, right object.Object) object.Object {
+	lValue, _ := toFloat(left)
+	rValue, _ := toFloat(right)
+
+	switch operator {
+	case "+":
+		return &object.Float{Value: lValue + rValue}
+	case "-":
+		return &object.Float{Value: lValue - rValue}
+	case "*":
+		return &object.Float{Value: lValue * rValue}
 	case "/":
-		return &object.Integer{Value: lValue / rValue}
+		return &object.Float{Value: lValue / rValue}
+	case "%":
+		return &object.Float{Value: math.Mod(lValue, rValue)}
+	case "**":
+		return &object.Float{Value: math.Pow(lValue, rValue)}
 	case ">":
 		return nativeBoolToBooleanObject(lValue > rValue)
 	case "<":
 		return nativeBoolToBooleanObject(lValue < rValue)
+	case ">=":
+		return nativeBoolToBooleanObject(lValue >= rValue)
+	case "<=":
+		return nativeBoolToBooleanObject(lValue <= rValue)
 	case "==":
 		return nativeBoolToBooleanObject(lValue == rValue)
 	case "!=":
@@ -290,25 +691,104 @@ func evalIntegerInfixExpression(operator string, left, right object.Object) obje
 	}
 }
 
-func evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Object {
-	condition := Eval(ie.Condition, env)
-	if isError(condition) {
+func isNumber(obj object.Object) bool {
+	_, ok := toFloat(obj)
+	return ok
+}
+
+// toFloat converts an Integer, BigInteger or Float to a float64.
+func toFloat(obj object.Object) (float64, bool) {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		return float64(obj.Value), true
+	case *object.BigInteger:
+		return bigToFloat(obj.Value), true
+	case *object.Float:
+		return obj.Value, true
+	default:
+		return 0, false
+	}
+}
+
+// evalIfExpression evaluates an if expression. If tail is true, the expression is in tail position,
+// and so are its branches.
+func (e *Evaluator) evalIfExpression(ie *ast.IfExpression, env *object.Environment, tail bool) object.Object {
+	condition := e.Eval(ie.Condition, env)
+	if isSignal(condition) {
 		return condition
 	}
 
+	var branch *ast.BlockStatement
 	if isTruthy(condition) {
-		return Eval(ie.Consequence, env)
+		branch = ie.Consequence
 	} else if ie.Alternative != nil {
-		return Eval(ie.Alternative, env)
+		branch = ie.Alternative
 	} else {
 		return NULL
 	}
+
+	if tail {
+		return e.evalTail(branch, env)
+	}
+	return e.Eval(branch, env)
+}
+
+// evalAssignExpression updates the innermost existing binding of a variable.
+// A compound assignment like x += 1 is evaluated as x = x + 1.
+func (e *Evaluator) evalAssignExpression(node *ast.AssignExpression, env *object.Environment) object.Object {
+	current, ok := lookup(node.Name, env)
+	if !ok {
+		return newError("cannot assign to undeclared variable: %s", node.Name.Value)
+	}
+
+	val := e.Eval(node.Value, env)
+	if isSignal(val) {
+		return val
+	}
+
+	if node.Operator != "=" {
+		operator := strings.TrimSuffix(node.Operator, "=")
+		val = e.evalInfixExpression(operator, current, val)
+		if isSignal(val) {
+			return val
+		}
+	}
+
+	assign(node.Name, val, env)
+	return val
+}
+
+// evalLogicalExpression evaluates && and || with short-circuiting:
+// the right operand is only evaluated if the left one does not decide the result.
+func (e *Evaluator) evalLogicalExpression(node *ast.InfixExpression, env *object.Environment) object.Object {
+	left := e.Eval(node.Left, env)
+	if isSignal(left) {
+		return left
+	}
+
+	if node.Operator == "&&" && !isTruthy(left) {
+		return FALSE
+	}
+	if node.Operator == "||" && isTruthy(left) {
+		return TRUE
+	}
+
+	right := e.Eval(node.Right, env)
+	if isSignal(right) {
+		return right
+	}
+	return nativeBoolToBooleanObject(isTruthy(right))
 }
 
 func isTruthy(obj object.Object) bool {
 	return obj != NULL && obj != FALSE
 }
 
+// IsTruthy reports whether obj counts as true in conditions, i.e. whether it is neither null nor false.
+func IsTruthy(obj object.Object) bool {
+	return isTruthy(obj)
+}
+
 func newError(format string, args ...interface{}) *object.Error {
 	return &object.Error{Message: fmt.Sprintf(format, args...)}
 }
@@ -321,12 +801,27 @@ func isError(obj object.Object) bool {
 	return obj.Type() == object.ERROR_OBJ
 }
 
-func evalIdentifier(id *ast.Identifier, env *object.Environment) object.Object {
-	if val, ok := env.Get(id.Value); ok {
+// isSignal reports whether obj must be passed up instead of being used as a value:
+// an error, or a break or continue on its way to the enclosing loop.
+func isSignal(obj object.Object) bool {
+	switch obj.(type) {
+	case *object.Error, *object.Break, *object.Continue:
+		return true
+	default:
+		return false
+	}
+}
+
+func (e *Evaluator) evalIdentifier(id *ast.Identifier, env *object.Environment) object.Object {
+	if val, ok := lookup(id, env); ok {
 		return val
 	}
+	if id.Scope == ast.ScopeLocal || id.Scope == ast.ScopeFree {
+		// the variable is declared, but its let statement has not run yet
+		return newError("identifier not found: %s", id.Value)
+	}
 
-	if builtin, ok := builtins[id.Value]; ok {
+	if builtin, ok := e.LookupBuiltin(id.Value); ok {
 		return builtin
 	}
 
@@ -340,49 +835,66 @@ func evalStringInfixExpression(operator string, left object.Object, right object
 	switch operator {
 	case "+":
 		return &object.String{Value: lValue + rValue}
+	case "==":
+		return nativeBoolToBooleanObject(lValue == rValue)
+	case "!=":
+		return nativeBoolToBooleanObject(lValue != rValue)
+	case "<":
+		return nativeBoolToBooleanObject(lValue < rValue)
+	case ">":
+		return nativeBoolToBooleanObject(lValue > rValue)
+	case "<=":
+		return nativeBoolToBooleanObject(lValue <= rValue)
+	case ">=":
+		return nativeBoolToBooleanObject(lValue >= rValue)
 	default:
 		return newError("unknown operator: %s %s %s",
 			left.Type(), operator, right.Type())
 	}
 }
 
-func evalArrayLiteral(arr *ast.ArrayLiteral, env *object.Environment) object.Object {
-	exprs := evalExpressions(arr.Elements, env)
-	if len(exprs) == 1 && isError(exprs[0]) {
+func (e *Evaluator) evalArrayLiteral(arr *ast.ArrayLiteral, env *object.Environment) object.Object {
+	exprs := e.evalExpressions(arr.Elements, env)
+	if len(exprs) == 1 && isSignal(exprs[0]) {
 		return exprs[0]
 	}
 
-	return &object.Array{Elements: exprs}
+	return e.allocate(&object.Array{Elements: exprs})
 }
 
-func evalSubscriptExpression(subscriptExpr *ast.SubscriptExpression, env *object.Environment) object.Object {
-	left := Eval(subscriptExpr.Left, env)
-	if isError(left) {
+func (e *Evaluator) evalSubscriptExpression(subscriptExpr *ast.SubscriptExpression, env *object.Environment) object.Object {
+	left := e.Eval(subscriptExpr.Left, env)
+	if isSignal(left) {
 		return left
 	}
 
-	indexObj := Eval(subscriptExpr.Index, env)
-	if isError(indexObj) {
+	indexObj := e.Eval(subscriptExpr.Index, env)
+	if isSignal(indexObj) {
 		return indexObj
 	}
 
+	return Index(left, indexObj)
+}
+
+// Index returns the element of an array or the value of a hash at index, like a subscript expression.
+func Index(left, index object.Object) object.Object {
 	switch left := left.(type) {
 	case *object.Array:
-		return evalArraySubscriptExpression(left, indexObj)
+		return evalArraySubscriptExpression(left, index)
 
 	case *object.Hash:
-		return evalHashSubscriptExpression(left, indexObj)
+		return evalHashSubscriptExpression(left, index)
 
 	default:
 		return newError("subscript operator not supported for type: %s", left.Type())
 	}
 }
 
-func evalPairExpressions(exprs map[ast.Expression]ast.Expression, env *object.Environment) (map[object.HashKey]object.HashPair, object.Object) {
+func (e *Evaluator) evalPairExpressions(exprs map[ast.Expression]ast.Expression, env *object.Environment) (map[object.HashKey]object.HashPair, object.Object) {
 	result := make(map[object.HashKey]object.HashPair, len(exprs))
 	for key, val := range exprs {
-		evaluatedKey := Eval(key, env)
-		if isError(evaluatedKey) {
+		evaluatedKey := e.Eval(key, env)
+		if isSignal(evaluatedKey) {
 			return nil, evaluatedKey
 		}
 
@@ -391,8 +903,8 @@ func evalPairExpressions(exprs map[ast.Expression]ast.Expression, env *object.En
 			return nil, newError("invalid key type: %s", evaluatedKey.Type())
 		}
 
-		evaluatedVal := Eval(val, env)
-		if isError(evaluatedVal) {
+		evaluatedVal := e.Eval(val, env)
+		if isSignal(evaluatedVal) {
 			return nil, evaluatedVal
 		}
 
@@ -407,12 +919,12 @@ func evalPairExpressions(exprs map[ast.Expression]ast.Expression, env *object.En
 	return result, nil
 }
 
-func evalHashLiteral(hash *ast.HashLiteral, env *object.Environment) object.Object {
-	pairs, err := evalPairExpressions(hash.Pairs, env)
+func (e *Evaluator) evalHashLiteral(hash *ast.HashLiteral, env *object.Environment) object.Object {
+	pairs, err := e.evalPairExpressions(hash.Pairs, env)
 	if err != nil {
 		return err
 	}
-	return &object.Hash{Pairs: pairs}
+	return e.allocate(&object.Hash{Pairs: pairs})
 }
 
 func evalHashSubscriptExpression(hash *object.Hash, index object.Object) object.Object {
@@ -428,6 +940,9 @@ func evalHashSubscriptExpression(hash *object.Hash, index object.Object) object.
 }
 
 func evalArraySubscriptExpression(array *object.Array, index object.Object) object.Object {
+	if big, ok := index.(*object.BigInteger); ok {
+		return newError("index out of range: %s. array length: %d", big.Value, len(array.Elements))
+	}
 	idx, ok := index.(*object.Integer)
 	if !ok {
 		return newError("non-integer argument to array subscript not supported, got %s", index.Type())
@@ -1,8 +1,16 @@
 package evaluator
 
 import (
+	"bufio"
+	"bytes"
+	"context"
 	"errors"
+	"math"
+	"math/big"
+	"runtime/debug"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/GenericEntity/interpreter-go/monkey/lexer"
 	"github.com/GenericEntity/interpreter-go/monkey/object"
@@ -29,6 +37,23 @@ func TestEvalIntegerExpression(t *testing.T) {
 		{"3 * 3 * 3 + 10", 37},
 		{"3 * (3 * 3) + 10", 37},
 		{"(5 + 10 * 2 + 15 / 3) * 2 + -10", 50},
+		{"0xFF + 0o10 + 0b11", 266},
+		{"1_000 * 1_000", 1000000},
+		{"7 % 3", 1},
+		{"-7 % 3", -1},
+		{"2 ** 10", 1024},
+		{"2 ** 3 ** 2", 512},
+		{"-2 ** 2", -4},
+		{"(-2) ** 3", -8},
+		{"5 ** 0", 1},
+		{"6 & 3", 2},
+		{"6 | 3", 7},
+		{"6 ^ 3", 5},
+		{"~5", -6},
+		{"1 << 10", 1024},
+		{"-16 >> 2", -4},
+		{"1 + 2 << 3", 24},
+		{"1 | 2 ^ 3 & 4", 3},
 	}
 
 	for _, tt := range tests {
@@ -37,13 +62,81 @@ func TestEvalIntegerExpression(t *testing.T) {
 	}
 }
 
+func TestEvalFloatExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected float64
+	}{
+		{"1.5", 1.5},
+		{"-2.5", -2.5},
+		{"1.5 + 1.25", 2.75},
+		{"1.5 - 2", -0.5},
+		{"2 * 0.25", 0.5},
+		{"1 / 4.0", 0.25},
+		{"7.0 / 2", 3.5},
+		{"1e3 + 1", 1001},
+		{"(1.5 + 2) * -2", -7},
+		{"7.5 % 2", 1.5},
+		{"2.0 ** 3", 8},
+		{"4 ** 0.5", 2},
+		{"2 ** -1", 0.5},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testFloatObject(t, evaluated, tt.expected)
+	}
+}
+
+func testFloatObject(t *testing.T, obj object.Object, expected float64) bool {
+	result, ok := obj.(*object.Float)
+	if !ok {
+		t.Errorf("object is not Float. got=%T (%+v)", obj, obj)
+		return false
+	}
+
+	if result.Value != expected {
+		t.Errorf("object has wrong value. expected=%g, got=%g", expected, result.Value)
+		return false
+	}
+
+	return true
+}
+
 func testEval(input string) object.Object {
+	return testEvalWith(New(), input)
+}
+
+func testEvalWith(e *Evaluator, input string) object.Object {
 	lex := lexer.New(input)
 	p := parser.New(lex)
 	program := p.ParseProgram()
 	env := object.NewEnvironment()
 
-	return Eval(program, env)
+	return e.Eval(program, env)
+}
+
+func testBigIntegerObject(t *testing.T, obj object.Object, expected *big.Int) bool {
+	result, ok := obj.(*object.BigInteger)
+	if !ok {
+		t.Errorf("object is not BigInteger. got=%T (%+v)", obj, obj)
+		return false
+	}
+
+	if result.Value.Cmp(expected) != 0 {
+		t.Errorf("object has wrong value. expected=%s, got=%s", expected, result.Value)
+		return false
+	}
+
+	return true
+}
+
+func bigInt(s string) *big.Int {
+	value, ok := new(big.Int).SetString(s, 10)
+	if !ok {
+		panic("invalid big integer: " + s)
+	}
+	return value
 }
 
 func testIntegerObject(t *testing.T, obj object.Object, expected int64) bool {
@@ -85,6 +178,24 @@ func TestBooleanExpression(t *testing.T) {
 		{"(1 < 2) == false", false},
 		{"(1 > 2) == true", false},
 		{"(1 > 2) == false", true},
+		{"1.5 < 2", true},
+		{"2 > 1.5", true},
+		{"1.0 == 1", true},
+		{"1 != 1.0", false},
+		{"0.1 + 0.2 == 0.3", false},
+		{"1 <= 2", true},
+		{"2 <= 2", true},
+		{"3 <= 2", false},
+		{"1 >= 2", false},
+		{"2 >= 2", true},
+		{"2.5 >= 2", true},
+		{"1 <= 0.5", false},
+		{`"a" == "a"`, true},
+		{`"a" != "a"`, false},
+		{`"a" < "b"`, true},
+		{`"abc" > "abd"`, false},
+		{`"ab" <= "abc"`, true},
+		{`"b" >= "abc"`, true},
 	}
 
 	for _, tt := range tests {
@@ -127,6 +238,30 @@ func TestBangOperator(t *testing.T) {
 	}
 }
 
+func TestLogicalOperators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"true && true", true},
+		{"true && false", false},
+		{"false && true", false},
+		{"false || false", false},
+		{"false || true", true},
+		{"true || false", true},
+		{"1 && \"\"", true},
+		{"1 < 2 && 2 < 3", true},
+		{"1 > 2 || 2 > 3", false},
+		{"false && 1 + true", false},
+		{"true || -true", true},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testBooleanObject(t, evaluated, tt.expected)
+	}
+}
+
 func TestIfElseExpressions(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -272,6 +407,26 @@ func TestErrorHandling(t *testing.T) {
 			`"Hello" - "World"`,
 			"unknown operator: STRING - STRING",
 		},
+		{
+			"1.5 & 1",
+			"unknown operator: FLOAT & INTEGER",
+		},
+		{
+			"~1.5",
+			"unknown operator: ~FLOAT",
+		},
+		{
+			"1 << -1",
+			"negative shift count: -1",
+		},
+		{
+			"1 / 0",
+			"division by zero: 1 / 0",
+		},
+		{
+			"let x = 0; 5 % x",
+			"division by zero: 5 % 0",
+		},
 	}
 
 	for _, tt := range tests {
@@ -290,6 +445,91 @@ func TestErrorHandling(t *testing.T) {
 	}
 }
 
+func TestIntegerOverflow(t *testing.T) {
+	tests := []struct {
+		input           string
+		promoted        *big.Int
+		expectedMessage string
+	}{
+		{"9223372036854775807 + 1", bigInt("9223372036854775808"), "integer overflow: 9223372036854775807 + 1"},
+		{"-9223372036854775807 - 2", bigInt("-9223372036854775809"), "integer overflow: -9223372036854775807 - 2"},
+		{"4294967296 * 4294967296", bigInt("18446744073709551616"), "integer overflow: 4294967296 * 4294967296"},
+		{"let min = -9223372036854775807 - 1; min * -1", bigInt("9223372036854775808"), "integer overflow: -9223372036854775808 * -1"},
+		{"let min = -9223372036854775807 - 1; min / -1", bigInt("9223372036854775808"), "integer overflow: -9223372036854775808 / -1"},
+		{"let min = -9223372036854775807 - 1; -min", bigInt("9223372036854775808"), "integer overflow: -(-9223372036854775808)"},
+		{"2 ** 64", bigInt("18446744073709551616"), "integer overflow: 2 ** 64"},
+		{"1 << 70", bigInt("1180591620717411303424"), "integer overflow: 1 << 70"},
+	}
+
+	for _, tt := range tests {
+		testBigIntegerObject(t, testEval(tt.input), tt.promoted)
+
+		evaluated := testEvalWith(&Evaluator{CheckedArithmetic: true}, tt.input)
+		testErrorObject(t, evaluated, tt.expectedMessage)
+	}
+
+	// results that fit are unaffected by checked arithmetic
+	exact := []struct {
+		input    string
+		expected int64
+	}{
+		{"9223372036854775806 + 1", math.MaxInt64},
+		{"-9223372036854775807 - 1", math.MinInt64},
+		{"-3037000499 * 3037000499", -9223372030926249001},
+		{"(-2) ** 63", math.MinInt64},
+		{"-(-9223372036854775807)", math.MaxInt64},
+	}
+
+	for _, tt := range exact {
+		evaluated := testEvalWith(&Evaluator{CheckedArithmetic: true}, tt.input)
+		testIntegerObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestBigIntegers(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let fact = fn(n) { if (n < 2) { 1 } else { n * fact(n - 1) } }; fact(25)", bigInt("15511210043330985984000000")},
+		{"let big = 2 ** 100; big - big + 1", 1},
+		{"2 ** 64 / 2 ** 32", 4294967296},
+		{"(2 ** 64) % 7", 2},
+		{"-(2 ** 63) == -9223372036854775807 - 1", true},
+		{"-(2 ** 63) - 1", bigInt("-9223372036854775809")},
+		{"~(2 ** 64)", bigInt("-18446744073709551617")},
+		{"(2 ** 64) >> 60", 16},
+		{"(2 ** 64 + 5) & 7", 5},
+		{"2 ** 64 > 2 ** 63", true},
+		{"2 ** 64 < 1", false},
+		{"2 ** 64 == 2 ** 64", true},
+		{"2 ** 64 != 2 ** 64 + 1", true},
+		{"2 ** 64 == 2.0 ** 64", true},
+		{"2 ** 64 * 0.5", 9223372036854775808.0},
+		{"(2 ** 64) ** -1", 1 / 18446744073709551616.0},
+		{"{2 ** 64: \"big\", 0: \"small\"}[2 ** 64]", "big"},
+		{"[1, 2][2 ** 64]", errors.New("index out of range: 18446744073709551616. array length: 2")},
+		{"2 ** 64 / 0", errors.New("division by zero: 18446744073709551616 / 0")},
+		{"str(2 ** 64)", "18446744073709551616"},
+		// literals that do not fit in an int64
+		{"100000000000000000000", bigInt("100000000000000000000")},
+		{"100000000000000000000 - 99999999999999999999", 1},
+		{"-9223372036854775808 == -9223372036854775807 - 1", true},
+		{"0x1_0000_0000_0000_0000 == 2 ** 64", true},
+		// results are limited in size
+		{"1 << 100000000000", errors.New("integer too large: result of << exceeds 16777216 bits")},
+		{"2 ** 10000000000", errors.New("integer too large: result of ** exceeds 16777216 bits")},
+		{"(2 ** 64) ** (2 ** 64)", errors.New("integer too large: result of ** exceeds 16777216 bits")},
+		{"let x = 1 << 10000000; x * x", errors.New("integer too large: result of * exceeds 16777216 bits")},
+		{"(1 << 16777215) >> 16777214", 2},
+		{"1 ** 10000000000 + (-1) ** 10000000001 + 0 << 100000000000", 0},
+	}
+
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
 func TestLetStatements(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -299,12 +539,78 @@ func TestLetStatements(t *testing.T) {
 		{"let a = 5 * 5; a;", 25},
 		{"let a = 5; let b = a; b;", 5},
 		{"let a = 5; let b = a; let c = a + b + 5; c;", 15},
+		{"let base64 = 64; let x2 = base64 / 2; x2;", 32},
+		{"let café = 3; let 变量 = café * 2; 变量;", 6},
 	}
 	for _, tt := range tests {
 		testIntegerObject(t, testEval(tt.input), tt.expected)
 	}
 }
 
+func TestAssignExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let a = 5; a = 10; a;", 10},
+		{"let a = 5; a = a + 1;", 6},
+		{"let a = 1; let b = 2; a = b = 3; a + b;", 6},
+		{"let a = 5; a += 2; a;", 7},
+		{"let a = 5; a -= 2; a;", 3},
+		{"let a = 5; a *= 2; a;", 10},
+		{"let a = 10; a /= 4; a;", 2},
+		{`let s = "foo"; s += "bar"; s;`, "foobar"},
+		{"let counter = fn() { let n = 0; fn() { n += 1 } }; let next = counter(); next(); next(); next();", 3},
+		{"let n = 0; let inc = fn() { n = n + 1 }; inc(); inc(); n;", 2},
+		{"let n = 0; let shadow = fn() { let n = 5; n = 6; }; shadow(); n;", 0},
+		{"x = 5;", errors.New("cannot assign to undeclared variable: x")},
+		{"let f = fn() { y += 1 }; f();", errors.New("cannot assign to undeclared variable: y")},
+		{"let a = 1; a += true;", errors.New("type mismatch: INTEGER + BOOLEAN")},
+		{"let a = 1; a /= 0; a;", errors.New("division by zero: 1 / 0")},
+	}
+
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestLoops(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let i = 0; while (i < 10) { i += 1 }; i", 10},
+		{"let i = 0; while (false) { i += 1 }; i", 0},
+		{"while (false) { }", nil},
+		{"let i = 0; while (true) { i += 1; if (i == 5) { break } }; i", 5},
+		{"let sum = 0; for (let i = 0; i < 5; i += 1) { sum += i }; sum", 10},
+		{"let sum = 0; for (let i = 0; i < 10; i += 1) { if (i % 2 == 0) { continue } sum += i }; sum", 25},
+		{"let i = 0; for (;;) { i += 1; if (i > 3) { break } }; i", 4},
+		{"let i = 100; for (let i = 0; i < 3; i += 1) { }; i", 100},
+		{"let sum = 0; for (x in [1, 2, 3]) { sum += x }; sum", 6},
+		{"let sum = 0; for (i, x in [10, 20, 30]) { sum += i * x }; sum", 80},
+		{`let s = ""; for (c in "héllo") { s = c + s }; s`, "olléh"},
+		{`let n = 0; for (i, c in "日本") { n = i }; n`, 1},
+		{`let s = ""; for (k in {"b": 2, "a": 1, "c": 3}) { s += k }; s`, "abc"},
+		{`let s = 0; for (k, v in {1: 10, 2: 20}) { s += k * v }; s`, 50},
+		{"let f = fn(xs) { for (x in xs) { if (x > 2) { return x } }; -1 }; f([1, 2, 3, 4])", 3},
+		{"let f = fn(xs) { for (x in xs) { if (x > 9) { return x } }; -1 }; f([1, 2, 3, 4])", -1},
+		{"let n = 0; for (x in [1, 2, 3]) { for (y in [1, 2, 3]) { if (y == 2) { break } n += 1 } }; n", 3},
+		// break and continue in expressions stop the evaluation of the enclosing expression
+		{"let s = []; for (x in [1, 2, 3]) { s = push(s, if (x == 2) { break } else { x }) }; s", []interface{}{1}},
+		{"let s = 0; for (x in [1, 2, 3]) { s += (if (x == 2) { continue } else { x }) }; s", 4},
+		{"let s = 0; for (x in [1, 2, 3]) { let y = -(if (x == 1) { continue } else { x }); s += y }; s", -5},
+		{"let n = 0; while (true) { n = [n + 1, if (n > 1) { break } else { 0 }][0] }; n", 2},
+		{"for (x in 5) { }", errors.New("cannot iterate over INTEGER")},
+		{"while (1 + true) { }", errors.New("type mismatch: INTEGER + BOOLEAN")},
+		{"for (x in [1]) { x + true }", errors.New("type mismatch: INTEGER + BOOLEAN")},
+	}
+
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
 func TestFunctionObject(t *testing.T) {
 	input := "fn(x) { x + 2; };"
 
@@ -348,6 +654,50 @@ func TestFunctionApplication(t *testing.T) {
 	}
 }
 
+func TestScopes(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let counter = fn() { let n = 0; fn() { n += 1 } }; let c = counter(); c(); c()", 2},
+		{"let f = fn() { let g = fn() { h() }; let h = fn() { 2 }; g() }; f()", 2},
+		{"let x = 1; let f = fn() { let x = x + 1; x }; [f(), x]", []interface{}{2, 1}},
+		{"let f = fn() { let g = fn() { x }; let r = g(); let x = 1; r }; f()", errors.New("identifier not found: x")},
+		{"let s = 0; for (let i = 0; i < 3; i += 1) { let j = i; s += j }; s", 3},
+		{"let fs = []; for (x in [1, 2]) { fs = push(fs, fn() { x }) }; fs[0]()", 2},
+		{"let x = 10; for (x in [1, 2]) { }; x", 10},
+		// variables are declared before they are used, so that programs with undefined variables do not run
+		{"puts(1); x", errors.New("identifier not found: x")},
+		{"let f = fn() { y = 1 };", errors.New("cannot assign to undeclared variable: y")},
+	}
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+		testObject(t, testEvalWith(&Evaluator{Stdout: &out}, tt.input), tt.expected)
+		if out.Len() != 0 {
+			t.Errorf("program with undefined variables ran for %q. output=%q", tt.input, out.String())
+		}
+	}
+
+	// programs run in the same environment share their global variables
+	env := object.NewEnvironment()
+	for _, tt := range []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let x = 1; let f = fn() { x + 1 };", nil},
+		{"f()", 2},
+		{"x = 5; f()", 6},
+		{"let g = fn() { z };", errors.New("identifier not found: z")},
+	} {
+		evaluated := Eval(parser.New(lexer.New(tt.input)).ParseProgram(), env)
+		if evaluated == nil {
+			evaluated = NULL
+		}
+		testObject(t, evaluated, tt.expected)
+	}
+}
+
 func TestStringLiteral(t *testing.T) {
 	input := `"Hello World!"`
 
@@ -385,6 +735,8 @@ func TestBuiltinFunctions(t *testing.T) {
 		{`len("")`, 0},
 		{`len("four")`, 4},
 		{`len("hello world")`, 11},
+		{`len("héllo")`, 5},
+		{`let n = 0; for (c in "日本語") { n += 1 }; n == len("日本語")`, true},
 		{`len(1)`, errors.New("type of 1st argument to `len` not supported, got INTEGER")},
 		{`len("one", "two")`, errors.New("wrong number of arguments. got=2, want=1")},
 
@@ -456,6 +808,34 @@ func TestBuiltinFunctions(t *testing.T) {
 		{`put({}, "two")`, errors.New("wrong number of arguments. got=2, want=3")},
 		{`put({})`, errors.New("wrong number of arguments. got=1, want=3")},
 		{`put({}, 1, 2, 3)`, errors.New("wrong number of arguments. got=4, want=3")},
+
+		// int(x)
+		{`int(5)`, 5},
+		{`int(2.9)`, 2},
+		{`int(-2.9)`, -2},
+		{`int("42")`, 42},
+		{`int(" -7 ")`, -7},
+		{`int("4.2")`, errors.New("could not parse \"4.2\" as an integer")},
+		{`int(1e19)`, bigInt("10000000000000000000")},
+		{`int("-123456789012345678901234567890")`, bigInt("-123456789012345678901234567890")},
+		{`int(0.0 / 0.0)`, errors.New("could not convert NaN to an integer")},
+		{`int(true)`, errors.New("type of 1st argument to `int` not supported, got BOOLEAN")},
+		{`int(1, 2)`, errors.New("wrong number of arguments. got=2, want=1")},
+
+		// float(x)
+		{`float(2)`, 2.0},
+		{`float(2.5)`, 2.5},
+		{`float("1.5e2")`, 150.0},
+		{`float(int("100000000000000000000"))`, 1e20},
+		{`float("abc")`, errors.New("could not parse \"abc\" as a float")},
+		{`float([])`, errors.New("type of 1st argument to `float` not supported, got ARRAY")},
+
+		// str(x)
+		{`str(5)`, "5"},
+		{`str(2.0)`, "2.0"},
+		{`str("hi")`, "hi"},
+		{`str([1, true])`, "[1,true]"},
+		{`str()`, errors.New("wrong number of arguments. got=0, want=1")},
 	}
 
 	for _, tt := range tests {
@@ -464,6 +844,94 @@ func TestBuiltinFunctions(t *testing.T) {
 	}
 }
 
+func TestStreamBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		stdin    string
+		expected interface{}
+		output   string
+	}{
+		{`puts("a", 1, [true])`, "", nil, "a\n1\n[true]\n"},
+		{`print("a", 1); print("b")`, "", nil, "a 1b"},
+		{`printf("%s=%d %.1f %v %d\n", "x", 1, 2.25, true, 9223372036854775807 + 1)`, "", nil, "x=1 2.2 true 9223372036854775808\n"},
+		{`printf("%v", [1, 2])`, "", nil, "[1,2]"},
+		{`printf(1)`, "", errors.New("type of 1st argument to `printf` not supported, got INTEGER"), ""},
+		{`printf()`, "", errors.New("wrong number of arguments. got=0, want at least 1"), ""},
+		{`[readline(), readline(), readline()]`, "first\r\nsecond", []interface{}{"first", "second", nil}, ""},
+		{`readline(1)`, "", errors.New("wrong number of arguments. got=1, want=0"), ""},
+		{`input("name? ") + "!"`, "monkey\n", "monkey!", "name? "},
+		{`input()`, "", nil, ""},
+		{`input(1, 2)`, "", errors.New("wrong number of arguments. got=2, want at most 1"), ""},
+	}
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+		e := &Evaluator{Stdout: &out, Stdin: strings.NewReader(tt.stdin)}
+
+		evaluated := testEvalWith(e, tt.input)
+		if tt.expected == nil {
+			testNullObject(t, evaluated)
+		} else {
+			testObject(t, evaluated, tt.expected)
+		}
+		if out.String() != tt.output {
+			t.Errorf("wrong output for %s. expected=%q, got=%q", tt.input, tt.output, out.String())
+		}
+	}
+
+	// input that programs do not read is left in a shared reader
+	stdin := bufio.NewReader(strings.NewReader("one\ntwo\n"))
+	testStringObject(t, testEvalWith(&Evaluator{Stdin: stdin}, "readline()"), "one")
+	if rest, _ := stdin.ReadString('\n'); rest != "two\n" {
+		t.Errorf("input read ahead. expected=%q, got=%q", "two\n", rest)
+	}
+}
+
+func TestBuiltinRegistry(t *testing.T) {
+	repeat := func(args ...object.Object) object.Object {
+		s := args[0].(*object.String).Value
+		n := args[1].(*object.Integer).Value
+		return &object.String{Value: strings.Repeat(s, int(n))}
+	}
+	constant := func(args ...object.Object) object.Object {
+		return &object.Integer{Value: 42}
+	}
+
+	e := New()
+	e.Builtins = e.DefaultBuiltins()
+	e.Builtins.RegisterTyped("repeat", repeat, object.STRING_OBJ, object.INTEGER_OBJ)
+	e.Builtins.Register("len", constant)
+	e.Builtins.Remove("puts")
+
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`repeat("ab", 3)`, "ababab"},
+		{`repeat("ab")`, errors.New("wrong number of arguments. got=1, want=2")},
+		{`repeat("ab", "3")`, errors.New("type of 2nd argument to `repeat` not supported, got STRING")},
+		{`len([1, 2])`, 42},
+		{`puts(1)`, errors.New("identifier not found: puts")},
+		{`first([1, 2])`, 1},
+	}
+
+	for _, tt := range tests {
+		testObject(t, testEvalWith(e, tt.input), tt.expected)
+	}
+
+	// other evaluators still use the default builtins
+	testIntegerObject(t, testEval(`len([1, 2])`), 2)
+
+	e.Builtins = NewRegistry()
+	e.Builtins.RegisterTyped("identity", func(args ...object.Object) object.Object { return args[0] }, Any)
+	testIntegerObject(t, testEvalWith(e, "identity(1)"), 1)
+	testErrorObject(t, testEvalWith(e, "len([])"), "identifier not found: len")
+
+	if names := e.Builtins.Names(); len(names) != 1 || names[0] != "identity" {
+		t.Errorf("wrong names. expected=[identity], got=%v", names)
+	}
+}
+
 func TestArrayLiteral(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -508,6 +976,10 @@ func testObject(t *testing.T, obj object.Object, expected interface{}) bool {
 		return testIntegerObject(t, obj, int64(expected))
 	case int64:
 		return testIntegerObject(t, obj, expected)
+	case *big.Int:
+		return testBigIntegerObject(t, obj, expected)
+	case float64:
+		return testFloatObject(t, obj, expected)
 	case bool:
 		return testBooleanObject(t, obj, expected)
 	case string:
@@ -647,6 +1119,9 @@ func testHash(t *testing.T, obj object.Object, expected map[interface{}]interfac
 				expectedVal, ok = expected[key.Value]
 			}
 
+		case *object.Float:
+			expectedVal, ok = expected[key.Value]
+
 		case *object.Boolean:
 			expectedVal, ok = expected[key.Value]
 
@@ -676,6 +1151,7 @@ func TestHashLiteral(t *testing.T) {
 		{`{1: 2, 2: 4, 3: 6};`, map[interface{}]interface{}{1: 2, 2: 4, 3: 6}},
 		{`{true: 1, 2: false};`, map[interface{}]interface{}{true: 1, 2: false}},
 		{`{"hi": 2, "there": 1}`, map[interface{}]interface{}{"hi": 2, "there": 1}},
+		{`{1.5: 2, 1: 3}`, map[interface{}]interface{}{1.5: 2, 1: 3}},
 		{`let x = "x"; let y = "not y"; {x: 2, y: 1}`, map[interface{}]interface{}{"x": 2, "not y": 1}},
 		{`fn(){ {2 * 2: 2, 5 == 10: 1} }();`, map[interface{}]interface{}{4: 2, false: 1}},
 
@@ -702,6 +1178,12 @@ func TestHashSubscriptExpressions(t *testing.T) {
 		{`let x = "x"; let y = "not y"; {x: 2, y: 1}["not y"]`, 1},
 		{`fn(){ {2 * 2: 2, 5 == 10: 1} }()[8/2];`, 2},
 
+		{`{0.5: "half"}[1 / 2.0]`, "half"},
+		{`{1.0: "float"}[1]`, "float"},
+		{`{1: "a"}[1.0]`, "a"},
+		{`{-0.0: "zero"}[0]`, "zero"},
+		{`{2 ** 64: "big"}[2.0 ** 64]`, "big"},
+		{`{1.5: "a"}[1]`, nil},
 		{`{}[1]`, nil},
 		{`{"hi": 2, "there": 1}["asd"]`, nil},
 
@@ -715,3 +1197,262 @@ func TestHashSubscriptExpressions(t *testing.T) {
 		testObject(t, evaluated, tt.expected)
 	}
 }
+
+func TestHashEqualNumberKeys(t *testing.T) {
+	// Pairs are evaluated in no particular order, so either key may be
+	// reported as the duplicate.
+	evaluated := testEval(`{1: "a", 1.0: "b"}`)
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+	}
+	if errObj.Message != "duplicate key: 1" && errObj.Message != "duplicate key: 1.0" {
+		t.Errorf("wrong error message. got=%q", errObj.Message)
+	}
+}
+
+func TestErrorPositions(t *testing.T) {
+	tests := []struct {
+		input            string
+		expectedPosition string
+	}{
+		{"5 + true;", "1:1"},
+		{"let x = 1;\n  foobar;", "2:3"},
+		{"let f = fn(x) {\n\tx + true\n};\nf(1)", "2:2"},
+		{"len(1)", "1:1"},
+		{"[1, 2][5]", "1:1"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+			continue
+		}
+
+		if errObj.Span.Start.String() != tt.expectedPosition {
+			t.Errorf("wrong error position for %q. expected=%s, got=%s",
+				tt.input, tt.expectedPosition, errObj.Span.Start)
+		}
+	}
+}
+
+func TestTailCalls(t *testing.T) {
+	// without tail-call optimisation, these recursions would need far more stack than this
+	defer debug.SetMaxStack(debug.SetMaxStack(8 << 20))
+
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let count = fn(n, acc) { if (n == 0) { acc } else { count(n - 1, acc + 1) } }; count(100000, 0)", 100000},
+		{"let count = fn(n, acc) { if (n == 0) { return acc } return count(n - 1, acc + 1) }; count(100000, 0)", 100000},
+		{"let count = fn(n) { while (true) { if (n == 0) { return \"done\" } return count(n - 1) } }; count(100000)", "done"},
+		{`let even = fn(n) { if (n == 0) { true } else { odd(n - 1) } };
+		  let odd = fn(n) { if (n == 0) { false } else { even(n - 1) } };
+		  even(100001)`, false},
+		{"let f = fn(xs, acc) { if (len(xs) == 0) { return acc } f(rest(xs), acc + first(xs)) }; f([1, 2, 3], 0)", 6},
+		{"let f = fn() { len([1, 2]) }; f()", 2},
+		{"let f = fn(x) { x }; return f(5);", 5},
+		{"let f = fn(x) { x }; let g = fn() { f(1, 2) }; g()", errors.New("wrong number of arguments to function. expected=1, got=2")},
+	}
+
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestMaxRecursionDepth(t *testing.T) {
+	input := "let f = fn(n) { 1 + f(n + 1) }; f(0)"
+
+	evaluated := testEvalWith(&Evaluator{MaxDepth: 50}, input)
+	if !testErrorObject(t, evaluated, "maximum recursion depth exceeded") {
+		return
+	}
+
+	// a frame for each call that was in progress, and one for the call that exceeded the limit
+	errObj := evaluated.(*object.Error)
+	if len(errObj.Stack) != 51 {
+		t.Errorf("stack has wrong length. expected=51, got=%d", len(errObj.Stack))
+	}
+	if errObj.Span.Start.String() != "1:21" {
+		t.Errorf("error has wrong position. expected=1:21, got=%s", errObj.Span.Start)
+	}
+
+	// the default limit prevents a fatal Go stack overflow
+	testErrorObject(t, testEval(input), "maximum recursion depth exceeded")
+
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let f = fn(n) { if (n == 0) { 0 } else { 1 + f(n - 1) } }; f(49)", 49},
+		{"let f = fn(n) { if (n == 0) { 0 } else { 1 + f(n - 1) } }; f(50)", errors.New("maximum recursion depth exceeded")},
+		{"let f = fn(n) { if (n == 0) { 0 } else { f(n - 1) } }; f(1000)", 0},
+		{"let f = fn(n) { if (n == 0) { 0 } else { 1 + f(n - 1) } }; f(49); f(49)", 49},
+	}
+
+	for _, tt := range tests {
+		testObject(t, testEvalWith(&Evaluator{MaxDepth: 50}, tt.input), tt.expected)
+	}
+}
+
+func TestEvalContext(t *testing.T) {
+	tests := []struct {
+		input string
+		err   error
+	}{
+		{"while (true) { }", context.DeadlineExceeded},
+		{"for (;;) { }", context.DeadlineExceeded},
+		{"let f = fn() { f() }; f()", context.DeadlineExceeded},
+		{"let f = fn(xs) { for (x in xs) { f(xs) } }; f([1])", context.DeadlineExceeded},
+	}
+
+	for _, tt := range tests {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+		evaluated := EvalContext(ctx, program, object.NewEnvironment())
+		cancel()
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned for %q. got=%T(%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if errObj.Err != tt.err {
+			t.Errorf("wrong cause for %q. expected=%v, got=%v", tt.input, tt.err, errObj.Err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	program := parser.New(lexer.New("let f = fn(x) { x }; f(1)")).ParseProgram()
+	evaluated := EvalContext(ctx, program, object.NewEnvironment())
+	if testErrorObject(t, evaluated, "evaluation stopped: context canceled") {
+		if err := evaluated.(*object.Error).Err; err != context.Canceled {
+			t.Errorf("wrong cause. expected=%v, got=%v", context.Canceled, err)
+		}
+	}
+
+	// evaluation without function calls or loops is not interrupted
+	program = parser.New(lexer.New("1 + 2")).ParseProgram()
+	testIntegerObject(t, EvalContext(ctx, program, object.NewEnvironment()), 3)
+}
+
+func TestBudgets(t *testing.T) {
+	e := New()
+	testStringObject(t, testEvalWith(e, `"a" + "bc"`), "abc")
+
+	// program, statement, infix expression and two string literals;
+	// "a", "bc" and "abc" with one allocation each plus their bytes
+	expected := Usage{Steps: 5, Allocations: 9}
+	if e.Usage() != expected {
+		t.Errorf("wrong usage. expected=%+v, got=%+v", expected, e.Usage())
+	}
+
+	e.ResetUsage()
+	if e.Usage() != (Usage{}) {
+		t.Errorf("usage not reset. got=%+v", e.Usage())
+	}
+
+	tests := []struct {
+		evaluator *Evaluator
+		input     string
+		expected  string
+		err       error
+	}{
+		{&Evaluator{MaxSteps: 1000}, "while (true) { }", "step limit exceeded: limit is 1000 steps", ErrStepLimit},
+		{&Evaluator{MaxSteps: 1000}, "let f = fn() { f() }; f()", "step limit exceeded: limit is 1000 steps", ErrStepLimit},
+		{&Evaluator{MaxAllocations: 1000}, "let a = []; while (true) { a = push(a, 1) }", "allocation limit exceeded: limit is 1000 allocations", ErrAllocationLimit},
+		{&Evaluator{MaxAllocations: 1000}, `let s = "x"; while (true) { s += s }`, "allocation limit exceeded: limit is 1000 allocations", ErrAllocationLimit},
+		{&Evaluator{MaxAllocations: 1000}, `let h = {}; for (let i = 0; true; i += 1) { h = put(h, i, i) }`, "allocation limit exceeded: limit is 1000 allocations", ErrAllocationLimit},
+		{&Evaluator{MaxAllocations: 1000}, "let x = 3; while (true) { x = x * x }", "allocation limit exceeded: limit is 1000 allocations", ErrAllocationLimit},
+		{&Evaluator{MaxAllocations: 1000}, "let x = 1; while (true) { x = -(x << 1000) }", "allocation limit exceeded: limit is 1000 allocations", ErrAllocationLimit},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEvalWith(tt.evaluator, tt.input)
+		if !testErrorObject(t, evaluated, tt.expected) {
+			continue
+		}
+		if err := evaluated.(*object.Error).Err; err != tt.err {
+			t.Errorf("wrong cause for %q. expected=%v, got=%v", tt.input, tt.err, err)
+		}
+
+		// the totals include the step or allocation that exceeded the budget
+		usage := tt.evaluator.Usage()
+		if (tt.err == ErrStepLimit && usage.Steps != tt.evaluator.MaxSteps+1) ||
+			(tt.err == ErrAllocationLimit && usage.Allocations <= tt.evaluator.MaxAllocations) {
+			t.Errorf("usage within budget for %q. got=%+v", tt.input, usage)
+		}
+	}
+
+	// programs within their budgets are unaffected
+	testIntegerObject(t, testEvalWith(&Evaluator{MaxSteps: 1000, MaxAllocations: 1000}, "let a = [1, 2, 3]; len(a)"), 3)
+}
+
+func TestTailCallStackTrace(t *testing.T) {
+	input := `let fail = fn(x) { x + true };
+let loop = fn(n) { if (n == 0) { fail(n) } else { loop(n - 1) } };
+loop(3)`
+
+	errObj, ok := testEval(input).(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned")
+	}
+
+	// the chain of tail calls is replaced by its innermost call
+	expected := []string{"fail at 2:34", "loop at 3:1"}
+
+	if len(errObj.Stack) != len(expected) {
+		t.Fatalf("stack has wrong length. expected=%d, got=%d (%+v)", len(expected), len(errObj.Stack), errObj.Stack)
+	}
+
+	for i, frame := range errObj.Stack {
+		actual := frame.Function + " at " + frame.Call.Start.String()
+		if actual != expected[i] {
+			t.Errorf("stack[%d] wrong. expected=%q, got=%q", i, expected[i], actual)
+		}
+	}
+}
+
+func TestErrorStackTrace(t *testing.T) {
+	input := `let inner = fn(x) { x + true };
+let outer = fn(x) {
+	let r = inner(x); r
+};
+let apply = fn(f, x) { let r = f(x); r };
+apply(outer, 1)`
+
+	evaluated := testEval(input)
+
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+	}
+
+	expected := []struct {
+		function string
+		position string
+	}{
+		{"inner", "3:10"},
+		{"outer", "5:32"},
+		{"apply", "6:1"},
+	}
+
+	if len(errObj.Stack) != len(expected) {
+		t.Fatalf("stack has wrong length. expected=%d, got=%d (%+v)", len(expected), len(errObj.Stack), errObj.Stack)
+	}
+
+	for i, frame := range expected {
+		if errObj.Stack[i].Function != frame.function {
+			t.Errorf("stack[%d] has wrong function. expected=%q, got=%q", i, frame.function, errObj.Stack[i].Function)
+		}
+		if errObj.Stack[i].Call.Start.String() != frame.position {
+			t.Errorf("stack[%d] has wrong position. expected=%s, got=%s", i, frame.position, errObj.Stack[i].Call.Start)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package evaluator
+
+import (
+	"math"
+	"math/big"
+
+	"github.com/GenericEntity/interpreter-go/monkey/object"
+)
+
+// The following functions return the wrapped-around result of an int64 operation,
+// and whether it is exact (i.e. did not overflow).
+
+func addInt64(a, b int64) (int64, bool) {
+	result := a + b
+	// overflow iff both operands have the same sign, and the result has the other sign
+	return result, (a^result)&(b^result) >= 0
+}
+
+func subInt64(a, b int64) (int64, bool) {
+	result := a - b
+	return result, (a^b)&(a^result) >= 0
+}
+
+func mulInt64(a, b int64) (int64, bool) {
+	result := a * b
+	if a == 0 || b == 0 {
+		return result, true
+	}
+	// result/b wraps around too when dividing math.MinInt64 by -1
+	return result, result/b == a && !(a == math.MinInt64 && b == -1)
+}
+
+// intPow computes base**exp for a non-negative exp by repeated squaring.
+func intPow(base, exp int64) (int64, bool) {
+	result, exact := int64(1), true
+	for exp > 0 {
+		var ok bool
+		if exp&1 == 1 {
+			result, ok = mulInt64(result, base)
+			exact = exact && ok
+		}
+		exp >>= 1
+		if exp > 0 {
+			base, ok = mulInt64(base, base)
+			exact = exact && ok
+		}
+	}
+	return result, exact
+}
+
+// maxIntegerBits bounds the size of the results of multiplications, powers and left shifts,
+// which can otherwise exhaust memory in a single operation.
+const maxIntegerBits = 1 << 24
+
+func newIntegerTooLargeError(operator string) *object.Error {
+	return newError("integer too large: result of %s exceeds %d bits", operator, maxIntegerBits)
+}
+
+// evalBigIntegerInfixExpression evaluates an operation on integers with arbitrary precision.
+func evalBigIntegerInfixExpression(operator string, lValue, rValue *big.Int) object.Object {
+	switch operator {
+	case "+":
+		return object.NewInteger(new(big.Int).Add(lValue, rValue))
+	case "-":
+		return object.NewInteger(new(big.Int).Sub(lValue, rValue))
+	case "*":
+		if lValue.BitLen()+rValue.BitLen() > maxIntegerBits {
+			return newIntegerTooLargeError(operator)
+		}
+		return object.NewInteger(new(big.Int).Mul(lValue, rValue))
+	case "/", "%":
+		if rValue.Sign() == 0 {
+			return newError("division by zero: %s %s %s", lValue, operator, rValue)
+		}
+		// Quo and Rem truncate towards zero, like int64 division
+		if operator == "%" {
+			return object.NewInteger(new(big.Int).Rem(lValue, rValue))
+		}
+		return object.NewInteger(new(big.Int).Quo(lValue, rValue))
+	case "**":
+		if rValue.Sign() < 0 {
+			return &object.Float{Value: math.Pow(bigToFloat(lValue), bigToFloat(rValue))}
+		}
+		// the result has at most rValue times as many bits as lValue, unless lValue is 0, 1 or -1
+		if lValue.BitLen() > 1 && (!rValue.IsInt64() || rValue.Int64() > int64(maxIntegerBits/lValue.BitLen())) {
+			return newIntegerTooLargeError(operator)
+		}
+		return object.NewInteger(new(big.Int).Exp(lValue, rValue, nil))
+	case "&":
+		return object.NewInteger(new(big.Int).And(lValue, rValue))
+	case "|":
+		return object.NewInteger(new(big.Int).Or(lValue, rValue))
+	case "^":
+		return object.NewInteger(new(big.Int).Xor(lValue, rValue))
+	case "<<", ">>":
+		if rValue.Sign() < 0 {
+			return newError("negative shift count: %s", rValue)
+		}
+		if !rValue.IsInt64() {
+			return newError("shift count too large: %s", rValue)
+		}
+		if operator == "<<" {
+			if lValue.Sign() != 0 && rValue.Int64() > int64(maxIntegerBits-lValue.BitLen()) {
+				return newIntegerTooLargeError(operator)
+			}
+			return object.NewInteger(new(big.Int).Lsh(lValue, uint(rValue.Int64())))
+		}
+		return object.NewInteger(new(big.Int).Rsh(lValue, uint(rValue.Int64())))
+	case ">":
+		return nativeBoolToBooleanObject(lValue.Cmp(rValue) > 0)
+	case "<":
+		return nativeBoolToBooleanObject(lValue.Cmp(rValue) < 0)
+	case ">=":
+		return nativeBoolToBooleanObject(lValue.Cmp(rValue) >= 0)
+	case "<=":
+		return nativeBoolToBooleanObject(lValue.Cmp(rValue) <= 0)
+	case "==":
+		return nativeBoolToBooleanObject(lValue.Cmp(rValue) == 0)
+	case "!=":
+		return nativeBoolToBooleanObject(lValue.Cmp(rValue) != 0)
+	default:
+		return newError("unknown operator: %s %s %s",
+			object.INTEGER_OBJ, operator, object.INTEGER_OBJ)
+	}
+}
+
+// toBigInt converts an Integer or a BigInteger to a *big.Int.
+func toBigInt(obj object.Object) (*big.Int, bool) {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		return big.NewInt(obj.Value), true
+	case *object.BigInteger:
+		return obj.Value, true
+	default:
+		return nil, false
+	}
+}
+
+// bigToFloat returns the float64 nearest to value (or ±Inf if it is too large).
+func bigToFloat(value *big.Int) float64 {
+	f, _ := new(big.Float).SetInt(value).Float64()
+	return f
+}
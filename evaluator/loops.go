@@ -0,0 +1,177 @@
+package evaluator
+
+import (
+	"sort"
+
+	"github.com/GenericEntity/interpreter-go/monkey/ast"
+	"github.com/GenericEntity/interpreter-go/monkey/object"
+)
+
+// Loops evaluate to NULL, unless their body returns from the enclosing function or fails.
+
+func (e *Evaluator) evalWhileStatement(ws *ast.WhileStatement, env *object.Environment) object.Object {
+	for {
+		if err := e.checkContext(); err != nil {
+			return err
+		}
+
+		condition := e.Eval(ws.Condition, env)
+		if isSignal(condition) {
+			return condition
+		}
+		if !isTruthy(condition) {
+			return NULL
+		}
+
+		if result, done := loopBodyResult(e.Eval(ws.Body, env)); done {
+			return result
+		}
+	}
+}
+
+// evalForStatement evaluates a C-style for loop.
+// Variables declared in its initializer are scoped to the loop by the resolver,
+// which stores them in slots of the current frame.
+func (e *Evaluator) evalForStatement(fs *ast.ForStatement, env *object.Environment) object.Object {
+
+	if fs.Init != nil {
+		if init := e.Eval(fs.Init, env); isSignal(init) {
+			return init
+		}
+	}
+
+	for {
+		if err := e.checkContext(); err != nil {
+			return err
+		}
+
+		if fs.Condition != nil {
+			condition := e.Eval(fs.Condition, env)
+			if isSignal(condition) {
+				return condition
+			}
+			if !isTruthy(condition) {
+				return NULL
+			}
+		}
+
+		if result, done := loopBodyResult(e.Eval(fs.Body, env)); done {
+			return result
+		}
+
+		if fs.Post != nil {
+			if post := e.Eval(fs.Post, env); isSignal(post) {
+				return post
+			}
+		}
+	}
+}
+
+// evalForInStatement evaluates a for-in loop over the elements of an array,
+// the characters of a string, or the pairs of a hash (in the order of their keys).
+func (e *Evaluator) evalForInStatement(fs *ast.ForInStatement, env *object.Environment) object.Object {
+	iterable := e.Eval(fs.Iterable, env)
+	if isSignal(iterable) {
+		return iterable
+	}
+
+	iterate := func(key, value object.Object) (object.Object, bool) {
+		if err := e.checkContext(); err != nil {
+			return err, true
+		}
+
+		if fs.Key != nil {
+			define(fs.Key, key, env)
+		}
+		define(fs.Value, value, env)
+
+		return loopBodyResult(e.Eval(fs.Body, env))
+	}
+
+	switch iterable := iterable.(type) {
+	case *object.Array:
+		for i, element := range iterable.Elements {
+			if result, done := iterate(&object.Integer{Value: int64(i)}, element); done {
+				return result
+			}
+		}
+
+	case *object.String:
+		i := 0
+		for _, ch := range iterable.Value {
+			if result, done := iterate(&object.Integer{Value: int64(i)}, &object.String{Value: string(ch)}); done {
+				return result
+			}
+			i++
+		}
+
+	case *object.Hash:
+		for _, pair := range SortedHashPairs(iterable) {
+			// a single loop variable is bound to the keys
+			value := pair.Key
+			if fs.Key != nil {
+				value = pair.Value
+			}
+			if result, done := iterate(pair.Key, value); done {
+				return result
+			}
+		}
+
+	default:
+		return newError("cannot iterate over %s", iterable.Type())
+	}
+
+	return NULL
+}
+
+// loopBodyResult reports whether a loop must stop after its body evaluated to result,
+// and if so, what the loop evaluates to.
+func loopBodyResult(result object.Object) (object.Object, bool) {
+	switch result.(type) {
+	case *object.Break:
+		return NULL, true
+	case *object.ReturnValue, *object.Error:
+		return result, true
+	default:
+		return nil, false
+	}
+}
+
+// SortedHashPairs returns the pairs of hash ordered by key, so that iteration is deterministic.
+// Keys are grouped by type, then numbers, strings and booleans are ordered by value.
+func SortedHashPairs(hash *object.Hash) []object.HashPair {
+	pairs := make([]object.HashPair, 0, len(hash.Pairs))
+	for _, pair := range hash.Pairs {
+		pairs = append(pairs, pair)
+	}
+
+	sort.Slice(pairs, func(i, j int) bool {
+		return lessHashKey(pairs[i].Key, pairs[j].Key)
+	})
+
+	return pairs
+}
+
+func lessHashKey(a, b object.Object) bool {
+	if aNum, ok := toFloat(a); ok {
+		if bNum, ok := toFloat(b); ok {
+			return aNum < bNum
+		}
+		return true
+	}
+	if isNumber(b) {
+		return false
+	}
+
+	switch a := a.(type) {
+	case *object.String:
+		if b, ok := b.(*object.String); ok {
+			return a.Value < b.Value
+		}
+	case *object.Boolean:
+		if b, ok := b.(*object.Boolean); ok {
+			return !a.Value && b.Value
+		}
+	}
+	return a.Type() < b.Type()
+}
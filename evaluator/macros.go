@@ -0,0 +1,130 @@
+package evaluator
+
+import (
+	"context"
+
+	"github.com/GenericEntity/interpreter-go/monkey/ast"
+	"github.com/GenericEntity/interpreter-go/monkey/object"
+	"github.com/GenericEntity/interpreter-go/monkey/resolver"
+)
+
+// DefineMacros removes the let statements at the top level of program that define macros,
+// e.g. let unless = macro(cond, then) { ... };, and defines the macros in env instead.
+func DefineMacros(program *ast.Program, env *object.Environment) {
+	stmts := program.Statements[:0]
+
+	for _, stmt := range program.Statements {
+		let, ok := stmt.(*ast.LetStatement)
+		if !ok {
+			stmts = append(stmts, stmt)
+			continue
+		}
+		macro, ok := let.Value.(*ast.MacroLiteral)
+		if !ok {
+			stmts = append(stmts, stmt)
+			continue
+		}
+
+		env.Set(let.Name.Value, newMacro(macro, env))
+	}
+
+	program.Statements = stmts
+}
+
+// newMacro resolves the variables of the body of a macro literal like those of a function.
+func newMacro(macro *ast.MacroLiteral, env *object.Environment) *object.Macro {
+	fl := &ast.FunctionLiteral{Token: macro.Token, Parameters: macro.Parameters, Body: macro.Body}
+	resolver.Resolve(&ast.Program{Statements: []ast.Statement{&ast.ExpressionStatement{Expression: fl}}}, nil)
+
+	return &object.Macro{
+		Parameters: macro.Parameters,
+		Body:       macro.Body,
+		Env:        env,
+		Slots:      fl.Slots,
+	}
+}
+
+// ExpandMacros expands the calls in program to macros defined in env using an Evaluator
+// with the default settings (see Evaluator.ExpandMacros).
+func ExpandMacros(program ast.Node, env *object.Environment) (ast.Node, *object.Error) {
+	return New().ExpandMacros(program, env)
+}
+
+// ExpandMacrosContext is like ExpandMacros, but stops expanding macros once ctx is done,
+// like EvalContext.
+func (e *Evaluator) ExpandMacrosContext(ctx context.Context, program ast.Node, env *object.Environment) (ast.Node, *object.Error) {
+	outer := e.ctx
+	e.ctx = ctx
+	defer func() { e.ctx = outer }()
+
+	return e.ExpandMacros(program, env)
+}
+
+// ExpandMacros returns a copy of program in which the calls to macros defined in env are replaced by
+// their expansions. A macro is expanded by evaluating its body with its parameters set to the quoted
+// arguments of the call, which must result in a quote, whose syntax tree replaces the call.
+// It returns the error that occurred in the first expansion that failed, if any.
+func (e *Evaluator) ExpandMacros(program ast.Node, env *object.Environment) (ast.Node, *object.Error) {
+	var err *object.Error
+
+	expanded := ast.Modify(program, func(node ast.Node) ast.Node {
+		call, ok := node.(*ast.CallExpression)
+		if !ok || err != nil {
+			return node
+		}
+		macro, ok := macroCalled(call, env)
+		if !ok {
+			return node
+		}
+
+		result := e.expandMacro(macro, call)
+		quote, ok := result.(*object.Quote)
+		if !ok {
+			if err, ok = result.(*object.Error); !ok {
+				err = newError("macro %s must return a quote. got=%s", call.Function, result.Type())
+			}
+			withSpan(err, call)
+			return node
+		}
+		return quote.Node
+	})
+
+	return expanded, err
+}
+
+// macroCalled returns the macro defined in env that node calls, if any.
+func macroCalled(node *ast.CallExpression, env *object.Environment) (*object.Macro, bool) {
+	ident, ok := node.Function.(*ast.Identifier)
+	if !ok {
+		return nil, false
+	}
+
+	obj, ok := env.Get(ident.Value)
+	if !ok {
+		return nil, false
+	}
+	macro, ok := obj.(*object.Macro)
+	return macro, ok
+}
+
+// expandMacro evaluates the body of macro like a function called by node with quoted arguments.
+func (e *Evaluator) expandMacro(macro *object.Macro, node *ast.CallExpression) object.Object {
+	args := make([]object.Object, len(node.Arguments))
+	for i, arg := range node.Arguments {
+		args[i] = &object.Quote{Node: arg}
+	}
+
+	fn := &object.Function{
+		Parameters: macro.Parameters,
+		Body:       macro.Body,
+		Env:        macro.Env,
+		Name:       node.Function.String(),
+		Slots:      macro.Slots,
+	}
+	result := e.callFunction(&tailCall{fn: fn, args: args, node: node})
+	if result == nil {
+		// the body is empty or ends with a let statement
+		return NULL
+	}
+	return result
+}
@@ -0,0 +1,219 @@
+package evaluator
+
+import (
+	"testing"
+
+	"github.com/GenericEntity/interpreter-go/monkey/ast"
+	"github.com/GenericEntity/interpreter-go/monkey/lexer"
+	"github.com/GenericEntity/interpreter-go/monkey/object"
+	"github.com/GenericEntity/interpreter-go/monkey/parser"
+)
+
+func TestQuote(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`quote(5)`, `5`},
+		{`quote(5 + 8)`, `(5 + 8)`},
+		{`quote(foobar)`, `foobar`},
+		{`quote(foobar + barfoo)`, `(foobar + barfoo)`},
+		{`quote(unquote(4))`, `4`},
+		{`quote(unquote(4 + 4))`, `8`},
+		{`quote(8 + unquote(4 + 4))`, `(8 + 8)`},
+		{`quote(unquote(4 + 4) + 8)`, `(8 + 8)`},
+		{`let foobar = 8; quote(foobar)`, `foobar`},
+		{`let foobar = 8; quote(unquote(foobar))`, `8`},
+		{`quote(unquote(true))`, `true`},
+		{`quote(unquote(true == false))`, `false`},
+		{`quote(unquote(1.5))`, `1.5`},
+		{`quote(unquote(2 ** 64))`, `18446744073709551616`},
+		{`quote(unquote("a" + "b"))`, `ab`},
+		{`quote(unquote(quote(4 + 4)))`, `(4 + 4)`},
+		{`let quotedInfixExpression = quote(4 + 4);
+		quote(unquote(4 + 4) + unquote(quotedInfixExpression))`, `(8 + (4 + 4))`},
+		// unquote refers to the variables where quote is called
+		{`let f = fn(x) { quote(unquote(x) * y) }; f(3)`, `(3 * y)`},
+		{`let f = fn(x) { fn() { quote(unquote(x)) } }; f(3)()`, `3`},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		quote, ok := evaluated.(*object.Quote)
+		if !ok {
+			t.Errorf("expected *object.Quote for %q. got=%T (%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if quote.Node == nil {
+			t.Errorf("quote.Node is nil for %q", tt.input)
+			continue
+		}
+		if quote.Node.String() != tt.expected {
+			t.Errorf("not equal for %q. got=%q, want=%q", tt.input, quote.Node.String(), tt.expected)
+		}
+	}
+}
+
+func TestQuoteErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`quote(1, 2)`, "ERROR: 1:1: wrong number of arguments to quote. expected=1, got=2"},
+		{`quote(unquote())`, "ERROR: 1:7: wrong number of arguments to unquote. expected=1, got=0"},
+		{`quote(unquote([1]))`, "ERROR: 1:7: cannot unquote ARRAY"},
+		{`quote(unquote(1 / 0))`, "ERROR: 1:15: division by zero: 1 / 0"},
+		{`unquote(1)`, "ERROR: 1:1: identifier not found: unquote"},
+		{`macro(x) { x }`, "ERROR: 1:1: macros can only be defined by let statements at the top level of a program"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. got=%q, want=%q", tt.input, evaluated.Inspect(), tt.expected)
+		}
+	}
+}
+
+func TestDefineMacros(t *testing.T) {
+	input := `
+	let number = 1;
+	let function = fn(x, y) { x + y };
+	let mymacro = macro(x, y) { x + y; };
+	`
+
+	env := object.NewEnvironment()
+	program := testParseProgram(input)
+
+	DefineMacros(program, env)
+
+	if len(program.Statements) != 2 {
+		t.Fatalf("wrong number of statements. got=%d", len(program.Statements))
+	}
+
+	if _, ok := env.Get("number"); ok {
+		t.Fatalf("number should not be defined")
+	}
+	if _, ok := env.Get("function"); ok {
+		t.Fatalf("function should not be defined")
+	}
+
+	obj, ok := env.Get("mymacro")
+	if !ok {
+		t.Fatalf("macro not in environment.")
+	}
+	macro, ok := obj.(*object.Macro)
+	if !ok {
+		t.Fatalf("object is not Macro. got=%T (%+v)", obj, obj)
+	}
+
+	if len(macro.Parameters) != 2 {
+		t.Fatalf("wrong number of macro parameters. got=%d", len(macro.Parameters))
+	}
+	if macro.Parameters[0].String() != "x" || macro.Parameters[1].String() != "y" {
+		t.Fatalf("wrong parameters. got=%s, %s", macro.Parameters[0], macro.Parameters[1])
+	}
+	if macro.Body.String() != "{(x + y)}" {
+		t.Fatalf("body is not %q. got=%q", "{(x + y)}", macro.Body.String())
+	}
+	if macro.Slots != 2 {
+		t.Fatalf("wrong number of slots. got=%d", macro.Slots)
+	}
+}
+
+func TestExpandMacros(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			`let infixExpression = macro() { quote(1 + 2); };
+			infixExpression();`,
+			`(1 + 2)`,
+		},
+		{
+			`let reverse = macro(a, b) { quote(unquote(b) - unquote(a)); };
+			reverse(2 + 2, 10 - 5);`,
+			`(10 - 5) - (2 + 2)`,
+		},
+		{
+			`let unless = macro(condition, consequence, alternative) {
+				quote(if (!(unquote(condition))) {
+					unquote(consequence);
+				} else {
+					unquote(alternative);
+				});
+			};
+			unless(10 > 5, puts("not greater"), puts("greater"));`,
+			`if (!(10 > 5)) { puts("not greater") } else { puts("greater") }`,
+		},
+		// a macro can be expanded more than once
+		{
+			`let double = macro(x) { quote(unquote(x) * 2) };
+			double(1); double(a + b);`,
+			`(1 * 2); ((a + b) * 2)`,
+		},
+		// the body of a macro can compute its expansion
+		{
+			`let triple = macro(x) {
+				let result = x;
+				for (let i = 1; i < 3; i += 1) {
+					result = quote(unquote(result) + unquote(x));
+				}
+				result
+			};
+			triple(a);`,
+			`a + a + a`,
+		},
+	}
+
+	for _, tt := range tests {
+		expected := testParseProgram(tt.expected)
+		program := testParseProgram(tt.input)
+
+		env := object.NewEnvironment()
+		DefineMacros(program, env)
+		expanded, err := ExpandMacros(program, env)
+		if err != nil {
+			t.Errorf("unexpected error for %q: %s", tt.input, err.Inspect())
+			continue
+		}
+
+		if expanded.String() != expected.String() {
+			t.Errorf("not equal for %q. want=%q, got=%q", tt.input, expected.String(), expanded.String())
+		}
+	}
+}
+
+func TestExpandMacrosErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let m = macro() { 1 }; m()", "ERROR: 1:24: macro m must return a quote. got=INTEGER"},
+		{"let m = macro() { }; m()", "ERROR: 1:22: macro m must return a quote. got=NULL"},
+		{"let m = macro(x) { quote(x) }; m(1, 2)", "ERROR: 1:32: wrong number of arguments to function. expected=1, got=2"},
+		{"let m = macro() { quote(1 + true) + 1 }; m()", "ERROR: 1:19: type mismatch: QUOTE + INTEGER"},
+	}
+
+	for _, tt := range tests {
+		program := testParseProgram(tt.input)
+		env := object.NewEnvironment()
+		DefineMacros(program, env)
+
+		_, err := ExpandMacros(program, env)
+		if err == nil {
+			t.Errorf("no error for %q", tt.input)
+			continue
+		}
+		if err.Inspect() != tt.expected {
+			t.Errorf("wrong error for %q. want=%q, got=%q", tt.input, tt.expected, err.Inspect())
+		}
+	}
+}
+
+func testParseProgram(input string) *ast.Program {
+	l := lexer.New(input)
+	p := parser.New(l)
+	return p.ParseProgram()
+}
@@ -0,0 +1,85 @@
+package evaluator
+
+import (
+	"github.com/GenericEntity/interpreter-go/monkey/ast"
+	"github.com/GenericEntity/interpreter-go/monkey/object"
+	"github.com/GenericEntity/interpreter-go/monkey/token"
+)
+
+// isCallTo reports whether node calls the function name, e.g. quote or unquote,
+// which are not functions but take their arguments unevaluated.
+func isCallTo(node *ast.CallExpression, name string) bool {
+	ident, ok := node.Function.(*ast.Identifier)
+	return ok && ident.Value == name
+}
+
+// quote evaluates quote(exp) to the syntax tree of exp, without evaluating it,
+// except for the arguments of calls to unquote in exp, which are replaced by their values.
+func (e *Evaluator) quote(node *ast.CallExpression, env *object.Environment) object.Object {
+	if len(node.Arguments) != 1 {
+		return newError("wrong number of arguments to quote. expected=1, got=%d", len(node.Arguments))
+	}
+
+	var err object.Object
+	quoted := ast.Modify(node.Arguments[0], func(node ast.Node) ast.Node {
+		call, ok := node.(*ast.CallExpression)
+		if !ok || !isCallTo(call, "unquote") || err != nil {
+			return node
+		}
+
+		if len(call.Arguments) != 1 {
+			err = withSpan(newError("wrong number of arguments to unquote. expected=1, got=%d",
+				len(call.Arguments)), call)
+			return node
+		}
+		value := e.Eval(call.Arguments[0], env)
+		if isSignal(value) {
+			err = value
+			return node
+		}
+
+		unquoted, ok := unquotedNode(value, call.Span())
+		if !ok {
+			err = withSpan(newError("cannot unquote %s", value.Type()), call)
+			return node
+		}
+		return unquoted
+	})
+	if err != nil {
+		return err
+	}
+
+	return &object.Quote{Node: quoted}
+}
+
+// unquotedNode returns the syntax tree that evaluates to value, which is at span,
+// if value is a quote or has a literal.
+func unquotedNode(value object.Object, span token.Span) (ast.Node, bool) {
+	tok := token.Token{Literal: value.Inspect(), Span: span}
+
+	switch value := value.(type) {
+	case *object.Quote:
+		// a copy, since a quote can be unquoted more than once
+		return ast.Modify(value.Node, func(node ast.Node) ast.Node { return node }), true
+	case *object.Integer:
+		tok.Type = token.INT
+		return &ast.IntegerLiteral{Token: tok, Value: value.Value}, true
+	case *object.BigInteger:
+		tok.Type = token.INT
+		return &ast.IntegerLiteral{Token: tok, Big: value.Value}, true
+	case *object.Float:
+		tok.Type = token.FLOAT
+		return &ast.FloatLiteral{Token: tok, Value: value.Value}, true
+	case *object.String:
+		tok.Type, tok.Literal = token.STRING, value.Value
+		return &ast.StringLiteral{Token: tok, Value: value.Value}, true
+	case *object.Boolean:
+		tok.Type = token.FALSE
+		if value.Value {
+			tok.Type = token.TRUE
+		}
+		return &ast.Boolean{Token: tok, Value: value.Value}, true
+	default:
+		return nil, false
+	}
+}
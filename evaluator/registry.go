@@ -0,0 +1,73 @@
+package evaluator
+
+import (
+	"sort"
+
+	"github.com/GenericEntity/interpreter-go/monkey/object"
+)
+
+// Registry is a set of named builtin functions available to programs.
+type Registry struct {
+	builtins map[string]*object.Builtin
+}
+
+// NewRegistry returns an empty Registry, for programs that must not use any default builtin.
+func NewRegistry() *Registry {
+	return &Registry{builtins: map[string]*object.Builtin{}}
+}
+
+// DefaultBuiltins returns a new Registry with the default builtins.
+// Builtins that write output or read input use the streams of e.
+func (e *Evaluator) DefaultBuiltins() *Registry {
+	r := NewRegistry()
+	for name, builtin := range builtins {
+		r.builtins[name] = builtin
+	}
+	for name, builtin := range e.streamBuiltins() {
+		r.builtins[name] = builtin
+	}
+	return r
+}
+
+// Register adds fn as the builtin function name, replacing any builtin with that name.
+func (r *Registry) Register(name string, fn object.BuiltinFunction) {
+	r.builtins[name] = &object.Builtin{Fn: fn}
+}
+
+// RegisterTyped is like Register, but fn is only called with arguments of the given types (see Typed).
+func (r *Registry) RegisterTyped(name string, fn object.BuiltinFunction, types ...object.ObjectType) {
+	r.Register(name, Typed(name, fn, types...))
+}
+
+// Remove removes the builtin function name, if any.
+func (r *Registry) Remove(name string) {
+	delete(r.builtins, name)
+}
+
+// Lookup returns the builtin function name.
+func (r *Registry) Lookup(name string) (*object.Builtin, bool) {
+	builtin, ok := r.builtins[name]
+	return builtin, ok
+}
+
+// Names returns the names of the builtin functions in alphabetical order.
+func (r *Registry) Names() []string {
+	names := make([]string, 0, len(r.builtins))
+	for name := range r.builtins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LookupBuiltin returns the builtin function name available to programs evaluated by e.
+func (e *Evaluator) LookupBuiltin(name string) (*object.Builtin, bool) {
+	if e.Builtins != nil {
+		return e.Builtins.Lookup(name)
+	}
+
+	if e.defaults == nil {
+		e.defaults = e.DefaultBuiltins()
+	}
+	return e.defaults.Lookup(name)
+}
@@ -0,0 +1,157 @@
+package evaluator
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"strings"
+
+	"github.com/GenericEntity/interpreter-go/monkey/object"
+)
+
+func (e *Evaluator) stdout() io.Writer {
+	if e.Stdout == nil {
+		return os.Stdout
+	}
+	return e.Stdout
+}
+
+// stdin returns Stdin buffered for reading lines. A *bufio.Reader is used as it is,
+// so that the host can keep reading from it without losing buffered input.
+func (e *Evaluator) stdin() *bufio.Reader {
+	var in io.Reader = os.Stdin
+	if e.Stdin != nil {
+		in = e.Stdin
+	}
+
+	if e.stdinReader == nil || e.stdinSource != in {
+		reader, ok := in.(*bufio.Reader)
+		if !ok {
+			reader = bufio.NewReader(in)
+		}
+		e.stdinReader = reader
+		e.stdinSource = in
+	}
+	return e.stdinReader
+}
+
+// write writes s to Stdout, returning an error object if that fails.
+func (e *Evaluator) write(s string) object.Object {
+	if _, err := io.WriteString(e.stdout(), s); err != nil {
+		return &object.Error{Message: "cannot write output: " + err.Error(), Err: err}
+	}
+	return NULL
+}
+
+// readLine reads a line from Stdin without its line ending. It returns NULL at the end of the input.
+func (e *Evaluator) readLine() object.Object {
+	line, err := e.stdin().ReadString('\n')
+	if err == io.EOF && line == "" {
+		return NULL
+	}
+	if err != nil && err != io.EOF {
+		return &object.Error{Message: "cannot read input: " + err.Error(), Err: err}
+	}
+
+	line = strings.TrimSuffix(line, "\n")
+	line = strings.TrimSuffix(line, "\r")
+	return &object.String{Value: line}
+}
+
+// formatArg converts obj to the Go value that printf formats it as.
+func formatArg(obj object.Object) interface{} {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		return obj.Value
+	case *object.BigInteger:
+		return new(big.Int).Set(obj.Value)
+	case *object.Float:
+		return obj.Value
+	case *object.Boolean:
+		return obj.Value
+	case *object.String:
+		return obj.Value
+	default:
+		return obj.Inspect()
+	}
+}
+
+func inspectAll(args []object.Object) []string {
+	strs := make([]string, len(args))
+	for i, arg := range args {
+		strs[i] = arg.Inspect()
+	}
+	return strs
+}
+
+// streamBuiltins returns the builtins that write to Stdout or read from Stdin.
+// They are bound to e, so that each Evaluator can use its own streams.
+func (e *Evaluator) streamBuiltins() map[string]*object.Builtin {
+	return map[string]*object.Builtin{
+		// puts writes each argument on its own line
+		"puts": {
+			Fn: func(args ...object.Object) object.Object {
+				var out strings.Builder
+				for _, arg := range args {
+					out.WriteString(arg.Inspect())
+					out.WriteString("\n")
+				}
+				return e.write(out.String())
+			},
+		},
+
+		// print writes its arguments separated by spaces, without a line ending
+		"print": {
+			Fn: func(args ...object.Object) object.Object {
+				return e.write(strings.Join(inspectAll(args), " "))
+			},
+		},
+
+		// printf writes its arguments formatted like fmt.Printf,
+		// e.g. printf("%s is %d\n", "x", 1)
+		"printf": {
+			Fn: func(args ...object.Object) object.Object {
+				if len(args) == 0 {
+					return newError("wrong number of arguments. got=0, want at least 1")
+				}
+				format, ok := args[0].(*object.String)
+				if !ok {
+					return newTypeNotSupportedError("printf", 1, args[0])
+				}
+
+				formatArgs := make([]interface{}, len(args)-1)
+				for i, arg := range args[1:] {
+					formatArgs[i] = formatArg(arg)
+				}
+				return e.write(fmt.Sprintf(format.Value, formatArgs...))
+			},
+		},
+
+		// readline reads a line, returning null at the end of the input
+		"readline": {
+			Fn: func(args ...object.Object) object.Object {
+				if err := checkArgsLen(0, args...); err != nil {
+					return err
+				}
+				return e.readLine()
+			},
+		},
+
+		// input writes an optional prompt, then reads a line like readline
+		"input": {
+			Fn: func(args ...object.Object) object.Object {
+				if len(args) > 1 {
+					return newError("wrong number of arguments. got=%d, want at most 1", len(args))
+				}
+				if len(args) == 1 {
+					if err := e.write(args[0].Inspect()); isError(err) {
+						return err
+					}
+				}
+				return e.readLine()
+			},
+		},
+	}
+}
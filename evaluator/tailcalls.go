@@ -0,0 +1,63 @@
+package evaluator
+
+import (
+	"github.com/GenericEntity/interpreter-go/monkey/ast"
+	"github.com/GenericEntity/interpreter-go/monkey/object"
+)
+
+// tailCall is a call whose function and arguments have been evaluated, but which has not been made yet.
+// Calls in tail position evaluate to a tailCall, which applyFunction makes after the calling function
+// has returned.
+type tailCall struct {
+	fn   object.Object
+	args []object.Object
+	node *ast.CallExpression
+}
+
+func (tc *tailCall) Type() object.ObjectType { return "TAIL_CALL" }
+func (tc *tailCall) Inspect() string         { return "tail call to " + tc.node.String() }
+
+// evalTail evaluates node in tail position, i.e. where its value is returned from the enclosing function.
+// A call in tail position evaluates to a *tailCall instead of being made.
+func (e *Evaluator) evalTail(node ast.Node, env *object.Environment) object.Object {
+	if err := e.step(); err != nil {
+		return withSpan(err, node)
+	}
+
+	switch node := node.(type) {
+	case *ast.BlockStatement:
+		return e.evalBlockStatement(node.Statements, env, true)
+
+	case *ast.ExpressionStatement:
+		return e.evalTail(node.Expression, env)
+
+	case *ast.IfExpression:
+		return e.evalIfExpression(node, env, true)
+
+	case *ast.CallExpression:
+		return e.evalCall(node, env)
+
+	default:
+		return withSpan(e.eval(node, env), node)
+	}
+}
+
+// evalCall evaluates the function and arguments of a call,
+// returning a *tailCall to make it, or the error that occurred.
+func (e *Evaluator) evalCall(node *ast.CallExpression, env *object.Environment) object.Object {
+	if isCallTo(node, "quote") {
+		return e.quote(node, env)
+	}
+
+	fn := e.Eval(node.Function, env)
+	if isSignal(fn) {
+		return fn
+	}
+
+	args := e.evalExpressions(node.Arguments, env)
+	if len(args) == 1 && isSignal(args[0]) {
+		return args[0]
+	}
+
+	return &tailCall{fn: fn, args: args, node: node}
+}
@@ -0,0 +1,63 @@
+package interpreter
+
+import (
+	"fmt"
+
+	"github.com/GenericEntity/interpreter-go/monkey/object"
+	"github.com/GenericEntity/interpreter-go/monkey/parser"
+)
+
+// ParseError is returned when a program has syntax errors. It is not run.
+type ParseError struct {
+	Diagnostics []parser.Diagnostic // the errors found in the program, in the order they were found
+}
+
+func newParseError(diagnostics []parser.Diagnostic) *ParseError {
+	err := &ParseError{}
+	for _, d := range diagnostics {
+		if d.Severity == parser.SeverityError {
+			err.Diagnostics = append(err.Diagnostics, d)
+		}
+	}
+	return err
+}
+
+func (e *ParseError) Error() string {
+	msg := e.Messages()[0]
+	if len(e.Diagnostics) > 1 {
+		msg += fmt.Sprintf(" (and %d more errors)", len(e.Diagnostics)-1)
+	}
+	return msg
+}
+
+// Messages returns the message of each error, prefixed by its position.
+func (e *ParseError) Messages() []string {
+	messages := make([]string, len(e.Diagnostics))
+	for i, d := range e.Diagnostics {
+		messages[i] = fmt.Sprintf("%s: %s", d.Span.Start, d.Message)
+	}
+	return messages
+}
+
+// RuntimeError is returned when a program fails while running.
+type RuntimeError struct {
+	Object *object.Error // the error the program evaluated to
+}
+
+func (e *RuntimeError) Error() string {
+	if e.Object.Span.Start.IsValid() {
+		return fmt.Sprintf("%s: %s", e.Object.Span.Start, e.Object.Message)
+	}
+	return e.Object.Message
+}
+
+// Traceback returns the error with the calls that led to it, as shown to users.
+func (e *RuntimeError) Traceback() string {
+	return e.Object.Traceback()
+}
+
+// Unwrap returns the Go error that caused the error, if any,
+// so that errors.Is can test for causes such as evaluator.ErrStepLimit or context.Canceled.
+func (e *RuntimeError) Unwrap() error {
+	return e.Object.Err
+}
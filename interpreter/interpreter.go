@@ -1,28 +1,179 @@
 package interpreter
 
 import (
+	"context"
 	"io"
 
+	"github.com/GenericEntity/interpreter-go/monkey/ast"
+	"github.com/GenericEntity/interpreter-go/monkey/compiler"
 	"github.com/GenericEntity/interpreter-go/monkey/evaluator"
 	"github.com/GenericEntity/interpreter-go/monkey/lexer"
 	"github.com/GenericEntity/interpreter-go/monkey/object"
+	"github.com/GenericEntity/interpreter-go/monkey/optimizer"
 	"github.com/GenericEntity/interpreter-go/monkey/parser"
+	"github.com/GenericEntity/interpreter-go/monkey/resolver"
+	"github.com/GenericEntity/interpreter-go/monkey/vm"
 )
 
-func Interpret(code string, out io.Writer) {
-	env := object.NewEnvironment()
-	lex := lexer.New(code)
-	p := parser.New(lex)
+// Interpreter runs Monkey programs for a Go program.
+// Programs run by the same Interpreter share their global variables.
+// An Interpreter must not be used by multiple goroutines at once.
+type Interpreter struct {
+	evaluator *evaluator.Evaluator
+	env       *object.Environment
+	macros    *object.Environment // the macros defined by programs, which are expanded before they run
 
+	compile  bool         // whether programs run on the vm (see WithCompiler)
+	optimize bool         // whether programs are optimised before they run (see WithOptimizer)
+	machine  machineState // the globals of programs run on the vm, like env for the evaluator
+}
+
+// machineState is the state that programs run on the vm share.
+type machineState struct {
+	globals   *compiler.Globals
+	constants []object.Object
+	values    []object.Object
+}
+
+// New returns an Interpreter configured with the given options.
+func New(options ...Option) *Interpreter {
+	in := &Interpreter{
+		evaluator: evaluator.New(),
+		env:       object.NewEnvironment(),
+		macros:    object.NewEnvironment(),
+		machine:   machineState{globals: compiler.NewGlobals()},
+	}
+	for _, option := range options {
+		option(in)
+	}
+	return in
+}
+
+// Eval runs code and returns the value of its last statement, which is nil if code has none,
+// e.g. because it ends with a let statement, like for evaluator.Eval.
+func (in *Interpreter) Eval(code string) (object.Object, error) {
+	return in.Run("", code)
+}
+
+// Run is like Eval, but positions in errors refer to the given filename.
+// It returns a *ParseError if code has syntax errors, or a *RuntimeError if it fails.
+// With WithCompiler, it also returns an error if code cannot be compiled, e.g. because it is too large.
+func (in *Interpreter) Run(filename, code string) (object.Object, error) {
+	return in.RunContext(context.Background(), filename, code)
+}
+
+// RunContext is like Run, but stops the program once ctx is done.
+// The RuntimeError returned then unwraps to ctx.Err().
+func (in *Interpreter) RunContext(ctx context.Context, filename, code string) (object.Object, error) {
+	p := parser.New(lexer.NewWithFilename(filename, code))
 	program := p.ParseProgram()
 	if len(p.Errors()) != 0 {
-		printParserErrors(out, p.Errors())
-		return
+		return nil, newParseError(p.Diagnostics())
+	}
+
+	evaluator.DefineMacros(program, in.macros)
+	expanded, errObj := in.evaluator.ExpandMacrosContext(ctx, program, in.macros)
+	if errObj != nil {
+		return nil, &RuntimeError{Object: errObj}
+	}
+	program = expanded.(*ast.Program)
+
+	if in.optimize {
+		optimizer.OptimizeFor(program, in.evaluator)
+	}
+
+	var evaluated object.Object
+	if in.compile {
+		var err error
+		if evaluated, err = in.runCompiled(ctx, program); err != nil {
+			return nil, err
+		}
+	} else {
+		evaluated = in.evaluator.EvalContext(ctx, program, in.env)
+	}
+
+	if errObj, ok := evaluated.(*object.Error); ok {
+		return nil, &RuntimeError{Object: errObj}
+	}
+	return evaluated, nil
+}
+
+// runCompiled compiles program and runs it on the vm.
+func (in *Interpreter) runCompiled(ctx context.Context, program *ast.Program) (object.Object, error) {
+	// report undefined variables before running the program, like the evaluator
+	defined := func(name string) bool {
+		if _, ok := in.Global(name); ok {
+			return true
+		}
+		_, ok := in.evaluator.LookupBuiltin(name)
+		return ok
+	}
+	if errs := resolver.Resolve(program, defined); len(errs) != 0 {
+		return &object.Error{Message: errs[0].Message, Span: errs[0].Span}, nil
 	}
 
-	evaluated := evaluator.Eval(program, env)
-	if evaluated != nil {
-		io.WriteString(out, evaluated.Inspect())
+	c := compiler.NewWithState(in.machine.globals, in.machine.constants)
+	if err := c.CompileResolved(program); err != nil {
+		return nil, err
+	}
+	bytecode := c.Bytecode()
+	in.machine.constants = bytecode.Constants
+
+	machine := vm.NewWithGlobals(bytecode, in.evaluator, in.machine.values)
+	result := machine.RunContext(ctx)
+	in.machine.values = machine.Globals()
+	return result, nil
+}
+
+// Global returns the value of the global variable name.
+func (in *Interpreter) Global(name string) (object.Object, bool) {
+	if !in.compile {
+		return in.env.Get(name)
+	}
+
+	i, ok := in.machine.globals.Lookup(name)
+	if !ok || i >= len(in.machine.values) || in.machine.values[i] == nil {
+		return nil, false
+	}
+	return in.machine.values[i], true
+}
+
+// setGlobal defines the global variable name, for both the evaluator and the vm.
+func (in *Interpreter) setGlobal(name string, value object.Object) {
+	in.env.Set(name, value)
+
+	i := in.machine.globals.Define(name)
+	for len(in.machine.values) <= i {
+		in.machine.values = append(in.machine.values, nil)
+	}
+	in.machine.values[i] = value
+}
+
+// Usage returns the resources consumed by all programs run so far.
+func (in *Interpreter) Usage() evaluator.Usage {
+	return in.evaluator.Usage()
+}
+
+func Interpret(code string, out io.Writer, options ...Option) {
+	InterpretFile("", code, out, options...)
+}
+
+// InterpretFile is like Interpret, but error positions refer to the given filename.
+func InterpretFile(filename, code string, out io.Writer, options ...Option) {
+	evaluated, err := New(append([]Option{WithStdout(out)}, options...)...).Run(filename, code)
+	switch err := err.(type) {
+	case nil:
+		if evaluated != nil {
+			io.WriteString(out, evaluated.Inspect())
+			io.WriteString(out, "\n")
+		}
+	case *ParseError:
+		printParserErrors(out, err.Messages())
+	case *RuntimeError:
+		io.WriteString(out, err.Traceback())
+		io.WriteString(out, "\n")
+	default:
+		io.WriteString(out, err.Error())
 		io.WriteString(out, "\n")
 	}
 }
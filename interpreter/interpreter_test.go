@@ -0,0 +1,275 @@
+package interpreter
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GenericEntity/interpreter-go/monkey/evaluator"
+	"github.com/GenericEntity/interpreter-go/monkey/object"
+)
+
+func TestEval(t *testing.T) {
+	in := New()
+
+	result, err := in.Eval("let x = 5; x * 2")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Inspect() != "10" {
+		t.Errorf("wrong result. expected=10, got=%s", result.Inspect())
+	}
+
+	// globals persist between programs
+	result, err = in.Eval("x + 1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Inspect() != "6" {
+		t.Errorf("wrong result. expected=6, got=%s", result.Inspect())
+	}
+
+	result, err = in.Eval("let y = 1;")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result != nil {
+		t.Errorf("program without a value is not nil. got=%s", result.Inspect())
+	}
+	if y, ok := in.Global("y"); !ok || y.Inspect() != "1" {
+		t.Errorf("global y not defined. got=%v", y)
+	}
+}
+
+func TestParseError(t *testing.T) {
+	_, err := New().Run("test.monkey", "let = 1; let x 2;")
+
+	parseErr, ok := err.(*ParseError)
+	if !ok {
+		t.Fatalf("err is not *ParseError. got=%T (%v)", err, err)
+	}
+	if len(parseErr.Diagnostics) != 2 {
+		t.Fatalf("wrong number of diagnostics. expected=2, got=%d", len(parseErr.Diagnostics))
+	}
+	if !strings.HasPrefix(err.Error(), "test.monkey:1:5: ") || !strings.HasSuffix(err.Error(), " (and 1 more errors)") {
+		t.Errorf("wrong error message. got=%q", err.Error())
+	}
+}
+
+func TestRuntimeError(t *testing.T) {
+	_, err := New().Run("test.monkey", "let f = fn() { 1 + true }; f()")
+
+	runtimeErr, ok := err.(*RuntimeError)
+	if !ok {
+		t.Fatalf("err is not *RuntimeError. got=%T (%v)", err, err)
+	}
+	if err.Error() != "test.monkey:1:16: type mismatch: INTEGER + BOOLEAN" {
+		t.Errorf("wrong error message. got=%q", err.Error())
+	}
+	if len(runtimeErr.Object.Stack) != 1 {
+		t.Errorf("wrong stack length. expected=1, got=%d", len(runtimeErr.Object.Stack))
+	}
+	if errors.Unwrap(err) != nil {
+		t.Errorf("error has a cause. got=%v", errors.Unwrap(err))
+	}
+}
+
+func TestOptions(t *testing.T) {
+	var out bytes.Buffer
+	double := func(args ...object.Object) object.Object {
+		return &object.Integer{Value: args[0].(*object.Integer).Value * 2}
+	}
+
+	in := New(
+		WithStdout(&out),
+		WithBuiltin("double", double),
+		WithGlobal("answer", &object.Integer{Value: 21}),
+	)
+	if _, err := in.Eval("puts(double(answer))"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if out.String() != "42\n" {
+		t.Errorf("wrong output. expected=%q, got=%q", "42\n", out.String())
+	}
+
+	if _, err := New(WithoutBuiltin("puts")).Eval("puts(1)"); err == nil || err.Error() != "1:1: identifier not found: puts" {
+		t.Errorf("puts not removed. got=%v", err)
+	}
+
+	in = New(WithBuiltins(evaluator.NewRegistry()), WithBuiltin("double", double))
+	if result, err := in.Eval("double(2)"); err != nil || result.Inspect() != "4" {
+		t.Errorf("wrong result for double(2). got=%v, %v", result, err)
+	}
+	if _, err := in.Eval("len([])"); err == nil || err.Error() != "1:1: identifier not found: len" {
+		t.Errorf("len not removed. got=%v", err)
+	}
+
+	tests := []struct {
+		option Option
+		input  string
+		err    error
+	}{
+		{WithMaxSteps(100), "while (true) { }", evaluator.ErrStepLimit},
+		{WithMaxAllocations(100), `let s = "x"; while (true) { s += s }`, evaluator.ErrAllocationLimit},
+		{WithMaxAllocations(100), "let a = []; for (let i = 0; i < 1000; i += 1) { a = push(a, i) }", evaluator.ErrAllocationLimit},
+		{WithMaxAllocations(100), "let a = []; while (true) { a = [a, a] }", evaluator.ErrAllocationLimit},
+		{WithMaxAllocations(100), "let h = {}; while (true) { h = {1: h, 2: h} }", evaluator.ErrAllocationLimit},
+		{WithMaxDepth(10), "let f = fn() { 1 + f() }; f()", evaluator.ErrMaxDepth},
+	}
+
+	for _, tt := range tests {
+		for _, options := range [][]Option{{tt.option}, {tt.option, WithCompiler()}} {
+			_, err := New(options...).Eval(tt.input)
+			if !errors.Is(err, tt.err) {
+				t.Errorf("wrong error for %q with %d options. expected=%v, got=%v", tt.input, len(options), tt.err, err)
+			}
+		}
+	}
+
+	for _, options := range [][]Option{nil, {WithCompiler()}} {
+		in = New(options...)
+		if _, err := in.Eval(`let a = [1, 2]; let s = "ab"; len(a)`); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if usage := in.Usage(); usage.Steps == 0 || usage.Allocations != 6 {
+			t.Errorf("wrong usage with %d options. got=%+v", len(options), usage)
+		}
+	}
+
+	_, err := New(WithCheckedArithmetic()).Eval("9223372036854775807 + 1")
+	if err == nil || err.Error() != "1:1: integer overflow: 9223372036854775807 + 1" {
+		t.Errorf("wrong error for checked overflow. got=%v", err)
+	}
+}
+
+func TestCompiler(t *testing.T) {
+	var out bytes.Buffer
+	in := New(WithCompiler(), WithStdout(&out), WithGlobal("answer", &object.Integer{Value: 21}))
+
+	for _, tt := range []struct{ input, expected string }{
+		{"let double = fn(x) { x * 2 }; double(0)", "0"},
+		{"puts(double(answer)); double(1)", "2"},
+		{"answer = 1; answer", "1"},
+	} {
+		result, err := in.Eval(tt.input)
+		if err != nil {
+			t.Fatalf("unexpected error for %q: %v", tt.input, err)
+		}
+		if result.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%s, got=%s", tt.input, tt.expected, result.Inspect())
+		}
+	}
+
+	if out.String() != "42\n" {
+		t.Errorf("wrong output. expected=%q, got=%q", "42\n", out.String())
+	}
+	if answer, ok := in.Global("answer"); !ok || answer.Inspect() != "1" {
+		t.Errorf("global answer not updated. got=%v", answer)
+	}
+	if _, ok := in.Global("missing"); ok {
+		t.Errorf("undefined global found")
+	}
+
+	_, err := New(WithCompiler()).Run("test.monkey", "let f = fn() { 1 + true }; f()")
+	if err == nil || err.Error() != "test.monkey:1:16: type mismatch: INTEGER + BOOLEAN" {
+		t.Errorf("wrong error. got=%v", err)
+	}
+}
+
+func TestCompilerRunsRepeatedly(t *testing.T) {
+	// programs share their constants, which must not run out when the same programs run again and again
+	in := New(WithCompiler())
+	input := "let x = 1; let f = fn(y) { y + 2 }; f(x)"
+	for i := 0; i <= 1<<16; i++ {
+		result, err := in.Eval(input)
+		if err != nil {
+			t.Fatalf("unexpected error in run %d: %v", i, err)
+		}
+		if result.Inspect() != "3" {
+			t.Fatalf("wrong result in run %d. expected=3, got=%s", i, result.Inspect())
+		}
+	}
+}
+
+func TestMacros(t *testing.T) {
+	for _, options := range [][]Option{nil, {WithCompiler()}} {
+		var out bytes.Buffer
+		in := New(append(options, WithStdout(&out))...)
+
+		for _, code := range []string{
+			`let unless = macro(cond, then) { quote(if (!(unquote(cond))) { unquote(then) }) };`,
+			`unless(1 > 2, puts("expanded"));`,
+		} {
+			if _, err := in.Eval(code); err != nil {
+				t.Fatalf("unexpected error for %q: %v", code, err)
+			}
+		}
+		if out.String() != "expanded\n" {
+			t.Errorf("wrong output. expected=%q, got=%q", "expanded\n", out.String())
+		}
+
+		_, err := in.Run("test.monkey", "let bad = macro() { 1 }; bad()")
+		if err == nil || err.Error() != "test.monkey:1:26: macro bad must return a quote. got=INTEGER" {
+			t.Errorf("wrong error. got=%v", err)
+		}
+
+		// macros are expanded with the context of the run
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		_, err = in.RunContext(ctx, "", "let m = macro() { while (true) { } quote(1) }; m()")
+		cancel()
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("wrong error. expected=%v, got=%v", context.DeadlineExceeded, err)
+		}
+	}
+}
+
+func TestOptimizer(t *testing.T) {
+	for _, options := range [][]Option{{WithOptimizer()}, {WithOptimizer(), WithCompiler()}} {
+		in := New(options...)
+
+		result, err := in.Eval("let x = 2 * 3 + 1; if (x > 5 && true) { x } else { 0 }")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if result.Inspect() != "7" {
+			t.Errorf("wrong result. expected=7, got=%s", result.Inspect())
+		}
+
+		_, err = in.Run("test.monkey", "if (true) { 10 / (2 - 2) }")
+		if err == nil || err.Error() != "test.monkey:1:13: division by zero: 10 / 0" {
+			t.Errorf("wrong error. got=%v", err)
+		}
+
+		// expressions are folded with the arithmetic of the interpreter
+		checked := New(append(options, WithCheckedArithmetic())...)
+		_, err = checked.Run("test.monkey", "9223372036854775807 + 1")
+		if err == nil || err.Error() != "test.monkey:1:1: integer overflow: 9223372036854775807 + 1" {
+			t.Errorf("wrong error. got=%v", err)
+		}
+	}
+}
+
+func TestInterpret(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"puts(1); 2", "1\n2\n"},
+		{"let x = 1;", ""},
+		{"puts(1)", "1\nnull\n"},
+		{"if (false) { 1 }", "null\n"},
+		{"let = 1;", "Parser errors:\n\t1:5: expected next token to be IDENT, got = instead\n"},
+		{"-true", "ERROR: 1:1: unknown operator: -BOOLEAN\n"},
+	}
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+		Interpret(tt.input, &out)
+		if out.String() != tt.expected {
+			t.Errorf("wrong output for %q. expected=%q, got=%q", tt.input, tt.expected, out.String())
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package interpreter
+
+import (
+	"io"
+
+	"github.com/GenericEntity/interpreter-go/monkey/evaluator"
+	"github.com/GenericEntity/interpreter-go/monkey/object"
+)
+
+// Option configures an Interpreter.
+type Option func(*Interpreter)
+
+// WithStdout makes output builtins such as puts write to w instead of os.Stdout.
+func WithStdout(w io.Writer) Option {
+	return func(in *Interpreter) {
+		in.evaluator.Stdout = w
+	}
+}
+
+// WithStdin makes input builtins read from r instead of os.Stdin.
+func WithStdin(r io.Reader) Option {
+	return func(in *Interpreter) {
+		in.evaluator.Stdin = r
+	}
+}
+
+// WithBuiltin makes fn available to programs as the builtin function name,
+// replacing any default builtin with that name.
+func WithBuiltin(name string, fn object.BuiltinFunction) Option {
+	return func(in *Interpreter) {
+		in.builtins().Register(name, fn)
+	}
+}
+
+// WithoutBuiltin makes the default builtin function name unavailable to programs.
+func WithoutBuiltin(name string) Option {
+	return func(in *Interpreter) {
+		in.builtins().Remove(name)
+	}
+}
+
+// WithBuiltins makes exactly the builtin functions in r available to programs,
+// e.g. evaluator.NewRegistry() for none at all. Later WithBuiltin and WithoutBuiltin options modify r.
+func WithBuiltins(r *evaluator.Registry) Option {
+	return func(in *Interpreter) {
+		in.evaluator.Builtins = r
+	}
+}
+
+// builtins returns the builtin functions available to programs, starting from the default builtins.
+func (in *Interpreter) builtins() *evaluator.Registry {
+	if in.evaluator.Builtins == nil {
+		in.evaluator.Builtins = in.evaluator.DefaultBuiltins()
+	}
+	return in.evaluator.Builtins
+}
+
+// WithGlobal defines the global variable name with the given value.
+func WithGlobal(name string, value object.Object) Option {
+	return func(in *Interpreter) {
+		in.setGlobal(name, value)
+	}
+}
+
+// WithMaxDepth limits the depth of nested function calls (see evaluator.Evaluator.MaxDepth).
+func WithMaxDepth(depth int) Option {
+	return func(in *Interpreter) {
+		in.evaluator.MaxDepth = depth
+	}
+}
+
+// WithMaxSteps limits the number of AST nodes evaluated, or instructions run with WithCompiler,
+// over all programs (see evaluator.Evaluator.MaxSteps).
+func WithMaxSteps(steps int) Option {
+	return func(in *Interpreter) {
+		in.evaluator.MaxSteps = steps
+	}
+}
+
+// WithMaxAllocations limits the size of the arrays, hashes, strings and big integers allocated over all programs
+// (see evaluator.Evaluator.MaxAllocations).
+func WithMaxAllocations(allocations int) Option {
+	return func(in *Interpreter) {
+		in.evaluator.MaxAllocations = allocations
+	}
+}
+
+// WithCheckedArithmetic makes integer overflow an error instead of promoting to big integers.
+func WithCheckedArithmetic() Option {
+	return func(in *Interpreter) {
+		in.evaluator.CheckedArithmetic = true
+	}
+}
+
+// WithCompiler makes programs run faster by compiling them to bytecode for a virtual machine
+// instead of evaluating their syntax tree. The limit of WithMaxSteps then counts the instructions
+// they run instead of the nodes they evaluate.
+func WithCompiler() Option {
+	return func(in *Interpreter) {
+		in.compile = true
+	}
+}
+
+// WithOptimizer makes programs simplify their constant expressions and remove code that never runs
+// before they run (see package optimizer).
+func WithOptimizer() Option {
+	return func(in *Interpreter) {
+		in.optimize = true
+	}
+}
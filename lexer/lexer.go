@@ -3,25 +3,33 @@ package lexer
 import (
 	"fmt"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/GenericEntity/interpreter-go/monkey/token"
 )
 
 type Lexer struct {
+	filename     string
 	input        string
 	position     int  // current position in input (after ch)
 	readPosition int  // current reading position in input (after ch)
-	ch           byte // current character under examination
+	ch           rune // current character under examination
+	line         int  // line of ch, starting at 1
+	column       int  // column of ch, starting at 1
+	errors       []Error
+}
+
+// Error describes why a token is ILLEGAL.
+type Error struct {
+	Span    token.Span
+	Message string
 }
 
 // TODO:
-//  floating point numbers
-//  hex notation, octal notation, binary notation
-//  identifiers with digits
 //  comments
-//  &&, ||
 
-var escapeCharacterMap = map[byte]byte{
+var escapeCharacterMap = map[rune]rune{
 	'\'': '\'',
 	'"':  '"',
 	'\\': '\\',
@@ -35,8 +43,15 @@ var escapeCharacterMap = map[byte]byte{
 }
 
 func New(input string) *Lexer {
+	return NewWithFilename("", input)
+}
+
+// NewWithFilename creates a lexer whose token positions refer to the given filename.
+func NewWithFilename(filename, input string) *Lexer {
 	lex := &Lexer{
-		input: input,
+		filename: filename,
+		input:    input,
+		line:     1,
 	}
 
 	// initialize lexer to prep first char
@@ -45,6 +60,11 @@ func New(input string) *Lexer {
 	return lex
 }
 
+// Errors returns a description of every ILLEGAL token produced so far.
+func (lex *Lexer) Errors() []Error {
+	return lex.errors
+}
+
 func (lex *Lexer) NextToken() token.Token {
 	var tok token.Token
 
@@ -56,6 +76,8 @@ func (lex *Lexer) NextToken() token.Token {
 		lex.skipWhitespace()
 	}
 
+	start := lex.currentPosition()
+
 	switch lex.ch {
 	case '=':
 		if lex.peekChar() == '=' {
@@ -67,7 +89,7 @@ func (lex *Lexer) NextToken() token.Token {
 			tok = newToken(token.ASSIGN, lex.ch)
 		}
 	case '+':
-		tok = newToken(token.PLUS, lex.ch)
+		tok = lex.readOperator(token.PLUS, '=', token.PLUS_ASSIGN)
 	case ';':
 		tok = newToken(token.SEMICOLON, lex.ch)
 	case '(':
@@ -90,22 +112,50 @@ func (lex *Lexer) NextToken() token.Token {
 			tok = newToken(token.BANG, lex.ch)
 		}
 	case '-':
-		tok = newToken(token.MINUS, lex.ch)
+		tok = lex.readOperator(token.MINUS, '=', token.MINUS_ASSIGN)
 	case '/':
-		tok = newToken(token.SLASH, lex.ch)
+		tok = lex.readOperator(token.SLASH, '=', token.SLASH_ASSIGN)
+	case '%':
+		tok = newToken(token.PERCENT, lex.ch)
 	case '*':
-		tok = newToken(token.ASTERISK, lex.ch)
+		switch lex.peekChar() {
+		case '=':
+			tok = lex.readOperator(token.ASTERISK, '=', token.ASTERISK_ASSIGN)
+		default:
+			tok = lex.readOperator(token.ASTERISK, '*', token.POWER)
+		}
 	case '<':
-		tok = newToken(token.LT, lex.ch)
+		switch lex.peekChar() {
+		case '=':
+			tok = lex.readOperator(token.LT, '=', token.LT_EQ)
+		default:
+			tok = lex.readOperator(token.LT, '<', token.SHL)
+		}
 	case '>':
-		tok = newToken(token.GT, lex.ch)
+		switch lex.peekChar() {
+		case '=':
+			tok = lex.readOperator(token.GT, '=', token.GT_EQ)
+		default:
+			tok = lex.readOperator(token.GT, '>', token.SHR)
+		}
+	case '&':
+		tok = lex.readOperator(token.BIT_AND, '&', token.AND)
+	case '|':
+		tok = lex.readOperator(token.BIT_OR, '|', token.OR)
+	case '^':
+		tok = newToken(token.BIT_XOR, lex.ch)
+	case '~':
+		tok = newToken(token.BIT_NOT, lex.ch)
 
 	case '"':
 		var err error
 		tok.Type = token.STRING
 		tok.Literal, err = lex.readString()
 		if err != nil {
-			tok.Type = token.ILLEGAL
+			if lex.ch != 0 {
+				lex.readChar()
+			}
+			return lex.illegalToken(start, err)
 		}
 
 	case '[':
@@ -117,16 +167,27 @@ func (lex *Lexer) NextToken() token.Token {
 		tok = newToken(token.COLON, lex.ch)
 
 	case 0:
+		// don't advance past the end of the input
 		tok.Literal = ""
 		tok.Type = token.EOF
+		tok.Span = lex.spanFrom(start)
+		return tok
 	default:
-		if isIdentifierChar(lex.ch) {
+		if lex.isInvalidUTF8() {
+			lex.readChar()
+			return lex.illegalToken(start, fmt.Errorf("invalid UTF-8 encoding"))
+		} else if isIdentifierStart(lex.ch) {
 			tok.Literal = lex.readIdentifier()
 			tok.Type = token.LookupIdent(tok.Literal)
+			tok.Span = lex.spanFrom(start)
 			return tok
 		} else if isDigit(lex.ch) {
-			tok.Literal = lex.readInteger()
-			tok.Type = token.INT
+			var err error
+			tok.Type, tok.Literal, err = lex.readNumber()
+			if err != nil {
+				return lex.illegalToken(start, err)
+			}
+			tok.Span = lex.spanFrom(start)
 			return tok
 		} else {
 			tok = newToken(token.ILLEGAL, lex.ch)
@@ -134,29 +195,81 @@ func (lex *Lexer) NextToken() token.Token {
 	}
 
 	lex.readChar()
+	tok.Span = lex.spanFrom(start)
 	return tok
 }
 
-func (lex *Lexer) peekChar() byte {
+// illegalToken returns an ILLEGAL token for the input from start up to lex.ch,
+// and records err as the reason.
+func (lex *Lexer) illegalToken(start token.Position, err error) token.Token {
+	span := lex.spanFrom(start)
+	lex.errors = append(lex.errors, Error{Span: span, Message: err.Error()})
+
+	return token.Token{
+		Type:    token.ILLEGAL,
+		Literal: lex.input[start.Offset:lex.position],
+		Span:    span,
+	}
+}
+
+// currentPosition returns the position of lex.ch in the input.
+func (lex *Lexer) currentPosition() token.Position {
+	return token.Position{
+		Filename: lex.filename,
+		Offset:   lex.position,
+		Line:     lex.line,
+		Column:   lex.column,
+	}
+}
+
+// spanFrom returns the span from start up to (but excluding) lex.ch.
+func (lex *Lexer) spanFrom(start token.Position) token.Span {
+	return token.Span{Start: start, End: lex.currentPosition()}
+}
+
+// readOperator returns a token of type twoCharType if the next character is second,
+// consuming it, and a token of type oneCharType for lex.ch alone otherwise.
+func (lex *Lexer) readOperator(oneCharType token.TokenType, second rune, twoCharType token.TokenType) token.Token {
+	if lex.peekChar() != second {
+		return newToken(oneCharType, lex.ch)
+	}
+	first := lex.ch
+	lex.readChar()
+	return token.Token{Type: twoCharType, Literal: string(first) + string(lex.ch)}
+}
+
+func (lex *Lexer) peekChar() rune {
 	if lex.readPosition >= len(lex.input) {
 		return 0
 	}
-	return lex.input[lex.readPosition]
+	ch, _ := utf8.DecodeRuneInString(lex.input[lex.readPosition:])
+	return ch
 }
 
+// readChar advances to the next character, decoding the input as UTF-8.
+// An invalid encoding is read as a single byte, with lex.ch set to utf8.RuneError.
 func (lex *Lexer) readChar() {
-	// current implementation only supports ASCII chars
-	// to extend to unicode and UTF-8
-	//	1. change from byte to rune
-	//	2. change way of reading characters (to support multi-byte runes)
+	if lex.ch == '\n' {
+		lex.line++
+		lex.column = 1
+	} else {
+		lex.column++
+	}
 
+	width := 1
 	if lex.readPosition >= len(lex.input) {
 		lex.ch = 0 // NUL byte to indicate end of file
 	} else {
-		lex.ch = lex.input[lex.readPosition]
+		lex.ch, width = utf8.DecodeRuneInString(lex.input[lex.readPosition:])
 	}
 	lex.position = lex.readPosition
-	lex.readPosition++
+	lex.readPosition += width
+}
+
+// isInvalidUTF8 reports whether lex.ch was decoded from an invalid UTF-8 sequence
+// (as opposed to a correctly encoded U+FFFD).
+func (lex *Lexer) isInvalidUTF8() bool {
+	return lex.ch == utf8.RuneError && lex.readPosition-lex.position == 1
 }
 
 func (lex *Lexer) readIdentifier() string {
@@ -167,19 +280,27 @@ func (lex *Lexer) readIdentifier() string {
 	return lex.input[start:lex.position]
 }
 
-func isIdentifierChar(ch byte) bool {
+// isIdentifierStart reports whether an identifier can start with ch: a letter or underscore.
+func isIdentifierStart(ch rune) bool {
 	return isLetter(ch) || ch == '_'
 }
 
-func isLetter(ch byte) bool {
-	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z'
+// isIdentifierChar reports whether ch can appear after the start of an identifier:
+// a letter, digit or underscore.
+func isIdentifierChar(ch rune) bool {
+	return isLetter(ch) || unicode.IsDigit(ch) || ch == '_'
+}
+
+func isLetter(ch rune) bool {
+	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' ||
+		ch >= utf8.RuneSelf && unicode.IsLetter(ch)
 }
 
-func newToken(tokenType token.TokenType, ch byte) token.Token {
+func newToken(tokenType token.TokenType, ch rune) token.Token {
 	return token.Token{Type: tokenType, Literal: string(ch)}
 }
 
-func isWhitespace(ch byte) bool {
+func isWhitespace(ch rune) bool {
 	return ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r'
 }
 
@@ -189,24 +310,147 @@ func (lex *Lexer) skipWhitespace() {
 	}
 }
 
-func isDigit(ch byte) bool {
+func isDigit(ch rune) bool {
 	return '0' <= ch && ch <= '9'
 }
 
-func (lex *Lexer) readInteger() string {
+// readNumber reads an integer or floating point literal, e.g. 12, 1.5, 2e10 or 1.5E-3.
+// A floating point literal needs digits on both sides of the decimal point.
+// Integers may also be written in hexadecimal (0x), octal (0o) or binary (0b) notation,
+// and digits may be separated by underscores, e.g. 1_000_000.
+func (lex *Lexer) readNumber() (token.TokenType, string, error) {
+	if lex.ch == '0' && isBasePrefix(lex.peekChar()) {
+		return lex.readPrefixedInteger()
+	}
+
 	start := lex.position
-	for isDigit(lex.ch) {
+	var tokType token.TokenType = token.INT
+
+	lex.readDigits(isDigit)
+
+	if lex.ch == '.' && isDigit(lex.peekChar()) {
+		tokType = token.FLOAT
+		lex.readChar()
+		lex.readDigits(isDigit)
+	}
+
+	if lex.ch == 'e' || lex.ch == 'E' {
+		tokType = token.FLOAT
+		lex.readChar()
+		if lex.ch == '+' || lex.ch == '-' {
+			lex.readChar()
+		}
+		if !isDigit(lex.ch) {
+			lex.skipAlphanumeric()
+			return token.ILLEGAL, "", fmt.Errorf("exponent has no digits")
+		}
+		lex.readDigits(isDigit)
+	}
+
+	if isIdentifierChar(lex.ch) {
+		invalid := lex.ch
+		lex.skipAlphanumeric()
+		return token.ILLEGAL, "", fmt.Errorf("invalid character %q in number literal", invalid)
+	}
+
+	literal := lex.input[start:lex.position]
+	if !underscoresOK(literal, isDigit) {
+		return token.ILLEGAL, "", fmt.Errorf("'_' must separate successive digits")
+	}
+
+	return tokType, literal, nil
+}
+
+// readPrefixedInteger reads an integer literal with a base prefix, e.g. 0x1F, 0o17 or 0b1111.
+func (lex *Lexer) readPrefixedInteger() (token.TokenType, string, error) {
+	start := lex.position
+	lex.readChar() // the leading 0
+	prefix := lex.ch
+	lex.readChar()
+
+	// also read any invalid digits, so the whole malformed literal becomes one ILLEGAL token
+	lex.skipAlphanumeric()
+	literal := lex.input[start:lex.position]
+	digits := literal[2:]
+
+	var isValidDigit func(rune) bool
+	var name string
+	switch prefix {
+	case 'x', 'X':
+		isValidDigit, name = isHexDigit, "hexadecimal"
+	case 'o', 'O':
+		isValidDigit, name = isOctalDigit, "octal"
+	default:
+		isValidDigit, name = isBinaryDigit, "binary"
+	}
+
+	if strings.Trim(digits, "_") == "" {
+		return token.ILLEGAL, "", fmt.Errorf("%s literal has no digits", name)
+	}
+
+	for _, digit := range digits {
+		if digit != '_' && !isValidDigit(digit) {
+			return token.ILLEGAL, "", fmt.Errorf("invalid digit %q in %s literal", digit, name)
+		}
+	}
+
+	// an underscore may directly follow the base prefix, e.g. 0x_FF
+	if !underscoresOK(strings.TrimPrefix(digits, "_"), isValidDigit) {
+		return token.ILLEGAL, "", fmt.Errorf("'_' must separate successive digits")
+	}
+
+	return token.INT, literal, nil
+}
+
+// readDigits reads digits (as defined by isValidDigit) and underscores.
+func (lex *Lexer) readDigits(isValidDigit func(rune) bool) {
+	for isValidDigit(lex.ch) || lex.ch == '_' {
 		lex.readChar()
 	}
-	return lex.input[start:lex.position]
 }
 
-func isEscapeCharacter(ch byte) bool {
+func (lex *Lexer) skipAlphanumeric() {
+	for isIdentifierChar(lex.ch) {
+		lex.readChar()
+	}
+}
+
+func isBasePrefix(ch rune) bool {
+	return strings.ContainsRune("xXoObB", ch)
+}
+
+func isHexDigit(ch rune) bool {
+	return isDigit(ch) || 'a' <= ch && ch <= 'f' || 'A' <= ch && ch <= 'F'
+}
+
+func isOctalDigit(ch rune) bool {
+	return '0' <= ch && ch <= '7'
+}
+
+func isBinaryDigit(ch rune) bool {
+	return ch == '0' || ch == '1'
+}
+
+// underscoresOK reports whether every underscore in s is between two digits.
+func underscoresOK(s string, isValidDigit func(rune) bool) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] != '_' {
+			continue
+		}
+		if i == 0 || i == len(s)-1 || !isValidDigit(rune(s[i-1])) || !isValidDigit(rune(s[i+1])) {
+			return false
+		}
+	}
+	return true
+}
+
+func isEscapeCharacter(ch rune) bool {
 	return ch == '\\'
 }
 
 func (lex *Lexer) readString() (string, error) {
 	var str strings.Builder
+	var err error // keep reading to the end of the string after an invalid escape sequence
 	for {
 		lex.readChar()
 		ch := lex.ch
@@ -221,17 +465,27 @@ func (lex *Lexer) readString() (string, error) {
 			break
 		}
 
+		if lex.isInvalidUTF8() && err == nil {
+			err = fmt.Errorf("invalid UTF-8 encoding in string literal")
+		}
+
 		// handle escape sequences AFTER testing for EOF or end of string
 		if isEscapeCharacter(lex.ch) {
+			if lex.peekChar() == 0 {
+				continue
+			}
 			lex.readChar()
 			escChar, ok := escapeCharacterMap[lex.ch]
-			if !ok {
-				return "", fmt.Errorf("unknown escape sequence: '\\%v'", lex.ch)
+			if !ok && err == nil {
+				err = fmt.Errorf("unknown escape sequence: '\\%c'", lex.ch)
 			}
 			ch = escChar
 		}
 
-		str.WriteByte(ch)
+		str.WriteRune(ch)
+	}
+	if err != nil {
+		return "", err
 	}
 	return str.String(), nil
 }
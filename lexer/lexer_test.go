@@ -36,7 +36,12 @@ func TestNextToken(t *testing.T) {
 
 	/* I'm a comment */
 	/**//**//**/
-	/**/`
+	/**/
+	a && b || c
+	<= >= % ** & | ^ ~ << >> < > *
+	+= -= *= /=
+	while for in break continue
+	macro(x, y) { x + y; };`
 
 	tests := []struct {
 		expectedType    token.TokenType
@@ -159,6 +164,51 @@ func TestNextToken(t *testing.T) {
 		{token.STRING, "value2"},
 		{token.RBRACE, "}"},
 
+		{token.IDENT, "a"},
+		{token.AND, "&&"},
+		{token.IDENT, "b"},
+		{token.OR, "||"},
+		{token.IDENT, "c"},
+
+		{token.LT_EQ, "<="},
+		{token.GT_EQ, ">="},
+		{token.PERCENT, "%"},
+		{token.POWER, "**"},
+		{token.BIT_AND, "&"},
+		{token.BIT_OR, "|"},
+		{token.BIT_XOR, "^"},
+		{token.BIT_NOT, "~"},
+		{token.SHL, "<<"},
+		{token.SHR, ">>"},
+		{token.LT, "<"},
+		{token.GT, ">"},
+		{token.ASTERISK, "*"},
+
+		{token.PLUS_ASSIGN, "+="},
+		{token.MINUS_ASSIGN, "-="},
+		{token.ASTERISK_ASSIGN, "*="},
+		{token.SLASH_ASSIGN, "/="},
+
+		{token.WHILE, "while"},
+		{token.FOR, "for"},
+		{token.IN, "in"},
+		{token.BREAK, "break"},
+		{token.CONTINUE, "continue"},
+
+		{token.MACRO, "macro"},
+		{token.LPAREN, "("},
+		{token.IDENT, "x"},
+		{token.COMMA, ","},
+		{token.IDENT, "y"},
+		{token.RPAREN, ")"},
+		{token.LBRACE, "{"},
+		{token.IDENT, "x"},
+		{token.PLUS, "+"},
+		{token.IDENT, "y"},
+		{token.SEMICOLON, ";"},
+		{token.RBRACE, "}"},
+		{token.SEMICOLON, ";"},
+
 		{token.EOF, ""},
 	}
 
@@ -176,3 +226,216 @@ func TestNextToken(t *testing.T) {
 		}
 	}
 }
+
+func TestTokenPositions(t *testing.T) {
+	input := "let x = 5;\n  \"hi\" /* c */ != y\n"
+
+	pos := func(offset, line, column int) token.Position {
+		return token.Position{Filename: "test.monkey", Offset: offset, Line: line, Column: column}
+	}
+
+	tests := []struct {
+		expectedType  token.TokenType
+		expectedStart token.Position
+		expectedEnd   token.Position
+	}{
+		{token.LET, pos(0, 1, 1), pos(3, 1, 4)},
+		{token.IDENT, pos(4, 1, 5), pos(5, 1, 6)},
+		{token.ASSIGN, pos(6, 1, 7), pos(7, 1, 8)},
+		{token.INT, pos(8, 1, 9), pos(9, 1, 10)},
+		{token.SEMICOLON, pos(9, 1, 10), pos(10, 1, 11)},
+		{token.STRING, pos(13, 2, 3), pos(17, 2, 7)},
+		{token.NOT_EQ, pos(26, 2, 16), pos(28, 2, 18)},
+		{token.IDENT, pos(29, 2, 19), pos(30, 2, 20)},
+		{token.EOF, pos(31, 3, 1), pos(31, 3, 1)},
+	}
+
+	lex := NewWithFilename("test.monkey", input)
+
+	for i, tt := range tests {
+		tok := lex.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Span.Start != tt.expectedStart {
+			t.Errorf("tests[%d] - start position wrong. expected=%+v, got=%+v", i, tt.expectedStart, tok.Span.Start)
+		}
+
+		if tok.Span.End != tt.expectedEnd {
+			t.Errorf("tests[%d] - end position wrong. expected=%+v, got=%+v", i, tt.expectedEnd, tok.Span.End)
+		}
+	}
+}
+
+func TestIdentifiers(t *testing.T) {
+	input := `base64 utf8_decode _x1 x__ café 变量 αβγ2 π 2x`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.IDENT, "base64"},
+		{token.IDENT, "utf8_decode"},
+		{token.IDENT, "_x1"},
+		{token.IDENT, "x__"},
+		{token.IDENT, "café"},
+		{token.IDENT, "变量"},
+		{token.IDENT, "αβγ2"},
+		{token.IDENT, "π"},
+		{token.ILLEGAL, "2x"},
+		{token.EOF, ""},
+	}
+
+	lex := New(input)
+
+	for i, tt := range tests {
+		tok := lex.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestUnicodeInput(t *testing.T) {
+	input := "let 名前 = \"héllo, 世界 \\t\";\n€ ü"
+
+	pos := func(offset, line, column int) token.Position {
+		return token.Position{Offset: offset, Line: line, Column: column}
+	}
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+		expectedStart   token.Position
+	}{
+		{token.LET, "let", pos(0, 1, 1)},
+		{token.IDENT, "名前", pos(4, 1, 5)},
+		{token.ASSIGN, "=", pos(11, 1, 8)},
+		{token.STRING, "héllo, 世界 \t", pos(13, 1, 10)},
+		{token.SEMICOLON, ";", pos(32, 1, 24)},
+		{token.ILLEGAL, "€", pos(34, 2, 1)},
+		{token.IDENT, "ü", pos(38, 2, 3)},
+		{token.EOF, "", pos(40, 2, 4)},
+	}
+
+	lex := New(input)
+
+	for i, tt := range tests {
+		tok := lex.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Errorf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+
+		if tok.Span.Start != tt.expectedStart {
+			t.Errorf("tests[%d] - start position wrong. expected=%#v, got=%#v", i, tt.expectedStart, tok.Span.Start)
+		}
+	}
+}
+
+func TestNumberLiterals(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{"0", token.INT, "0"},
+		{"1234", token.INT, "1234"},
+		{"1.5", token.FLOAT, "1.5"},
+		{"0.25", token.FLOAT, "0.25"},
+		{"1e10", token.FLOAT, "1e10"},
+		{"2.5E-3", token.FLOAT, "2.5E-3"},
+		{"6e+2", token.FLOAT, "6e+2"},
+		{"1e", token.ILLEGAL, "1e"},
+		{"1e+", token.ILLEGAL, "1e+"},
+		{"0x1F", token.INT, "0x1F"},
+		{"0XdeadBEEF", token.INT, "0XdeadBEEF"},
+		{"0o17", token.INT, "0o17"},
+		{"0b1010", token.INT, "0b1010"},
+		{"1_000_000", token.INT, "1_000_000"},
+		{"0b_1111_0000", token.INT, "0b_1111_0000"},
+		{"1_000.000_1", token.FLOAT, "1_000.000_1"},
+		{"0xZZ", token.ILLEGAL, "0xZZ"},
+		{"0o8", token.ILLEGAL, "0o8"},
+		{"0b", token.ILLEGAL, "0b"},
+		{"1__000", token.ILLEGAL, "1__000"},
+		{"1000_", token.ILLEGAL, "1000_"},
+		{"12abc", token.ILLEGAL, "12abc"},
+	}
+
+	for i, tt := range tests {
+		tok := New(tt.input).NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Errorf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Errorf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestIllegalTokenErrors(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{"0xZZ", "invalid digit 'Z' in hexadecimal literal"},
+		{"0o19", "invalid digit '9' in octal literal"},
+		{"0b102", "invalid digit '2' in binary literal"},
+		{"0x", "hexadecimal literal has no digits"},
+		{"0b__", "binary literal has no digits"},
+		{"0x__1", "'_' must separate successive digits"},
+		{"1_.5", "'_' must separate successive digits"},
+		{"1e_5", "exponent has no digits"},
+		{"7up", "invalid character 'u' in number literal"},
+		{`"unterminated`, "unexpected EOF encountered while reading string"},
+		{`"bad \q escape"`, `unknown escape sequence: '\q'`},
+		{"\xff", "invalid UTF-8 encoding"},
+		{"\"a\xffb\"", "invalid UTF-8 encoding in string literal"},
+	}
+
+	for _, tt := range tests {
+		lex := New(tt.input)
+		tok := lex.NextToken()
+
+		if tok.Type != token.ILLEGAL {
+			t.Errorf("token for %q is not ILLEGAL. got=%q", tt.input, tok.Type)
+			continue
+		}
+
+		if tok.Literal != tt.input {
+			t.Errorf("literal wrong. expected=%q, got=%q", tt.input, tok.Literal)
+		}
+
+		errors := lex.Errors()
+		if len(errors) != 1 {
+			t.Errorf("expected 1 error for %q. got=%+v", tt.input, errors)
+			continue
+		}
+
+		if errors[0].Message != tt.expectedMessage {
+			t.Errorf("wrong error message for %q. expected=%q, got=%q", tt.input, tt.expectedMessage, errors[0].Message)
+		}
+
+		if errors[0].Span != tok.Span {
+			t.Errorf("error span %+v does not match token span %+v", errors[0].Span, tok.Span)
+		}
+
+		if next := lex.NextToken(); next.Type != token.EOF {
+			t.Errorf("malformed literal %q was not read completely. next token=%+v", tt.input, next)
+		}
+	}
+}
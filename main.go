@@ -14,11 +14,26 @@ import (
 
 var (
 	flagScriptFile = flag.String("f", "", "path to file to interpret. if blank, opens a REPL")
+	flagEngine     = flag.String("engine", "eval", "how to run programs: eval (tree-walking evaluator) or vm (bytecode compiler)")
+	flagOptimize   = flag.Bool("optimize", false, "fold constant expressions and remove unreachable code before running programs")
 )
 
 func main() {
 	flag.Parse()
 
+	var options []interpreter.Option
+	switch *flagEngine {
+	case "eval":
+	case "vm":
+		options = append(options, interpreter.WithCompiler())
+	default:
+		fmt.Printf("Unknown engine %q. Use eval or vm.\n", *flagEngine)
+		os.Exit(2)
+	}
+	if *flagOptimize {
+		options = append(options, interpreter.WithOptimizer())
+	}
+
 	switch strings.TrimSpace(*flagScriptFile) {
 	case "":
 		u, err := user.Current()
@@ -26,7 +41,7 @@ func main() {
 			panic(err)
 		}
 		repl.Greet(os.Stdout, u.Username)
-		repl.Start(os.Stdin, os.Stdout)
+		repl.Start(os.Stdin, os.Stdout, options...)
 
 	default:
 		contents, err := ioutil.ReadFile(*flagScriptFile)
@@ -34,6 +49,6 @@ func main() {
 			fmt.Printf("Error when reading file. %v", err)
 			return
 		}
-		interpreter.Interpret(string(contents), os.Stdout)
+		interpreter.InterpretFile(*flagScriptFile, string(contents), os.Stdout, options...)
 	}
 }
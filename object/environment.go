@@ -1,19 +1,31 @@
 package object
 
+// Environment holds variables. Global variables, and variables that were not resolved,
+// are stored by name. The environment of a function call or program, its frame, also stores
+// resolved local variables in slots (see ast.Identifier).
 type Environment struct {
-	store map[string]Object
-	outer *Environment
+	store   map[string]Object
+	outer   *Environment
+	slots   []Object
+	globals *Environment // the environment holding the global variables
 }
 
 func NewEnvironment() *Environment {
 	s := make(map[string]Object)
-	return &Environment{store: s, outer: nil}
+	env := &Environment{store: s, outer: nil}
+	env.globals = env
+	return env
 }
 
+// ExtendEnvironment returns an environment enclosed by outer, which shares its global variables.
 func ExtendEnvironment(outer *Environment) *Environment {
-	env := NewEnvironment()
-	env.outer = outer
-	return env
+	return &Environment{store: make(map[string]Object), outer: outer, globals: outer.globals}
+}
+
+// NewFrame returns the environment of a function call or program with the given number of slots,
+// enclosed by outer.
+func NewFrame(outer *Environment, slots int) *Environment {
+	return &Environment{outer: outer, slots: make([]Object, slots), globals: outer.globals}
 }
 
 func (e *Environment) Get(name string) (Object, bool) {
@@ -25,7 +37,37 @@ func (e *Environment) Get(name string) (Object, bool) {
 
 }
 
+// Assign updates the innermost existing binding of name, searching through the outer environments.
+// It returns false if name is not bound in any of them.
+func (e *Environment) Assign(name string, value Object) bool {
+	for env := e; env != nil; env = env.outer {
+		if _, ok := env.store[name]; ok {
+			env.store[name] = value
+			return true
+		}
+	}
+	return false
+}
+
 func (e *Environment) Set(name string, value Object) Object {
+	if e.store == nil {
+		e.store = make(map[string]Object)
+	}
 	e.store[name] = value
 	return value
 }
+
+// Slot returns the slot at index in the frame depth frames out from e.
+// The slot is nil until its variable is set.
+func (e *Environment) Slot(depth, index int) *Object {
+	env := e
+	for ; depth > 0; depth-- {
+		env = env.outer
+	}
+	return &env.slots[index]
+}
+
+// Globals returns the environment holding the global variables.
+func (e *Environment) Globals() *Environment {
+	return e.globals
+}
@@ -4,24 +4,33 @@ import (
 	"bytes"
 	"fmt"
 	"hash/fnv"
+	"math"
+	"math/big"
+	"strconv"
 	"strings"
 
 	"github.com/GenericEntity/interpreter-go/monkey/ast"
+	"github.com/GenericEntity/interpreter-go/monkey/token"
 )
 
 type ObjectType string
 
 const (
 	INTEGER_OBJ      = "INTEGER"
+	FLOAT_OBJ        = "FLOAT"
 	BOOLEAN_OBJ      = "BOOLEAN"
 	NULL_OBJ         = "NULL"
 	RETURN_VALUE_OBJ = "RETURN_VALUE"
+	BREAK_OBJ        = "BREAK"
+	CONTINUE_OBJ     = "CONTINUE"
 	ERROR_OBJ        = "ERROR"
 	FUNCTION_OBJ     = "FUNCTION"
 	STRING_OBJ       = "STRING"
 	BUILTIN_OBJ      = "BUILTIN"
 	ARRAY_OBJ        = "ARRAY"
 	HASH_OBJ         = "HASH"
+	QUOTE_OBJ        = "QUOTE"
+	MACRO_OBJ        = "MACRO"
 )
 
 type Object interface {
@@ -36,6 +45,45 @@ type Integer struct {
 func (i *Integer) Type() ObjectType { return INTEGER_OBJ }
 func (i *Integer) Inspect() string  { return fmt.Sprintf("%d", i.Value) }
 
+// BigInteger is an integer outside the range of int64.
+// It has the same type as Integer, and a value that fits in an int64 is always an Integer,
+// so each integer has exactly one representation (see NewInteger).
+type BigInteger struct {
+	Value *big.Int
+}
+
+func (b *BigInteger) Type() ObjectType { return INTEGER_OBJ }
+func (b *BigInteger) Inspect() string  { return b.Value.String() }
+
+// NewInteger returns value as an *Integer if it fits in an int64, or as a *BigInteger otherwise.
+func NewInteger(value *big.Int) Object {
+	if value.IsInt64() {
+		return &Integer{Value: value.Int64()}
+	}
+	return &BigInteger{Value: value}
+}
+
+type Float struct {
+	Value float64
+}
+
+func (f *Float) Type() ObjectType { return FLOAT_OBJ }
+func (f *Float) Inspect() string {
+	var s string
+	abs := math.Abs(f.Value)
+	if abs == 0 || (1e-4 <= abs && abs < 1e16) {
+		s = strconv.FormatFloat(f.Value, 'f', -1, 64)
+	} else {
+		s = strconv.FormatFloat(f.Value, 'g', -1, 64)
+	}
+
+	// make sure floats with integral values don't look like integers
+	if !strings.ContainsAny(s, ".eIN") {
+		s += ".0"
+	}
+	return s
+}
+
 type Boolean struct {
 	Value bool
 }
@@ -55,20 +103,80 @@ type ReturnValue struct {
 func (rv *ReturnValue) Type() ObjectType { return RETURN_VALUE_OBJ }
 func (rv *ReturnValue) Inspect() string  { return rv.Value.Inspect() }
 
-// A full-fledged interpreter would attach line numbers, column numbers,
-// stack trace info, etc. to an error. But the lexer would need to provide that
-// info.
+// Break is the result of a break statement, propagated up to the enclosing loop.
+type Break struct{}
+
+func (b *Break) Type() ObjectType { return BREAK_OBJ }
+func (b *Break) Inspect() string  { return "break" }
+
+// Continue is the result of a continue statement, propagated up to the enclosing loop.
+type Continue struct{}
+
+func (c *Continue) Type() ObjectType { return CONTINUE_OBJ }
+func (c *Continue) Inspect() string  { return "continue" }
+
 type Error struct {
 	Message string
+	Span    token.Span   // the source code that caused the error, if known
+	Stack   []StackFrame // the calls that led to the error, innermost first
+	Err     error        // the Go error that caused the error, if any, e.g. context.Canceled
+}
+
+// StackFrame is a function call that was in progress when an error occurred.
+type StackFrame struct {
+	Function string     // name of the called function
+	Call     token.Span // the call expression
 }
 
+// minRepeatedFrames is the number of identical consecutive frames from which
+// Traceback collapses them into a single line, e.g. in deep recursion.
+const minRepeatedFrames = 4
+
 func (e *Error) Type() ObjectType { return ERROR_OBJ }
-func (e *Error) Inspect() string  { return "ERROR: " + e.Message }
+func (e *Error) Inspect() string {
+	if e.Span.Start.IsValid() {
+		return fmt.Sprintf("ERROR: %s: %s", e.Span.Start, e.Message)
+	}
+	return "ERROR: " + e.Message
+}
+
+// Traceback formats the error like Inspect, preceded by the calls that led to it
+// (most recent call last).
+func (e *Error) Traceback() string {
+	if len(e.Stack) == 0 {
+		return e.Inspect()
+	}
+
+	var out bytes.Buffer
+
+	out.WriteString("Traceback (most recent call last):\n")
+	for i := len(e.Stack) - 1; i >= 0; {
+		frame := e.Stack[i]
+
+		repeats := 1
+		for i-repeats >= 0 && e.Stack[i-repeats] == frame {
+			repeats++
+		}
+
+		fmt.Fprintf(&out, "  %s: in call to %s\n", frame.Call.Start, frame.Function)
+		if repeats >= minRepeatedFrames {
+			fmt.Fprintf(&out, "  [previous call repeated %d more times]\n", repeats-1)
+			i -= repeats
+		} else {
+			i--
+		}
+	}
+	out.WriteString(e.Inspect())
+
+	return out.String()
+}
 
 type Function struct {
 	Parameters []*ast.Identifier
 	Body       *ast.BlockStatement
 	Env        *Environment
+	Name       string // empty for anonymous functions
+	Slots      int    // number of local variables of a call (see ast.FunctionLiteral)
 }
 
 func (fn *Function) Type() ObjectType { return FUNCTION_OBJ }
@@ -90,6 +198,43 @@ func (fn *Function) Inspect() string {
 	return out.String()
 }
 
+// Quote is the unevaluated syntax tree of an expression, which quote returns.
+type Quote struct {
+	Node ast.Node
+}
+
+func (q *Quote) Type() ObjectType { return QUOTE_OBJ }
+func (q *Quote) Inspect() string {
+	return "QUOTE(" + q.Node.String() + ")"
+}
+
+// Macro is a macro defined by a program, whose calls are expanded before the program runs.
+type Macro struct {
+	Parameters []*ast.Identifier
+	Body       *ast.BlockStatement
+	Env        *Environment
+	Slots      int // number of local variables of an expansion (see ast.FunctionLiteral)
+}
+
+func (m *Macro) Type() ObjectType { return MACRO_OBJ }
+func (m *Macro) Inspect() string {
+	var out bytes.Buffer
+
+	params := []string{}
+	for _, param := range m.Parameters {
+		params = append(params, param.String())
+	}
+
+	out.WriteString("macro")
+	out.WriteString("(")
+	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(") {\n")
+	out.WriteString(m.Body.String())
+	out.WriteString("\n}")
+
+	return out.String()
+}
+
 type String struct {
 	Value string
 }
@@ -150,6 +295,30 @@ func (i *Integer) HashKey() HashKey {
 	return HashKey{Type: INTEGER_OBJ, Value: uint64(i.Value)}
 }
 
+func (f *Float) HashKey() HashKey {
+	// whole numbers, including -0.0, are equal to integers, so they must have the same hash keys
+	if f.Value == math.Trunc(f.Value) && !math.IsInf(f.Value, 0) {
+		if f.Value >= -(1<<63) && f.Value < 1<<63 {
+			return (&Integer{Value: int64(f.Value)}).HashKey()
+		}
+		value, _ := big.NewFloat(f.Value).Int(nil)
+		return (&BigInteger{Value: value}).HashKey()
+	}
+	return HashKey{Type: FLOAT_OBJ, Value: math.Float64bits(f.Value)}
+}
+
+// bigIntegerKey is the HashKey type of big integers,
+// which must not share hash keys with integers that fit in an int64.
+const bigIntegerKey ObjectType = "BIG_INTEGER"
+
+func (b *BigInteger) HashKey() HashKey {
+	h := fnv.New64a()
+	h.Write([]byte{byte(b.Value.Sign() + 1)})
+	h.Write(b.Value.Bytes())
+
+	return HashKey{Type: bigIntegerKey, Value: h.Sum64()}
+}
+
 func (s *String) HashKey() HashKey {
 	h := fnv.New64a()
 	h.Write([]byte(s.Value))
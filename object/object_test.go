@@ -1,6 +1,12 @@
 package object
 
-import "testing"
+import (
+	"math"
+	"math/big"
+	"testing"
+
+	"github.com/GenericEntity/interpreter-go/monkey/token"
+)
 
 func TestStringHashKey(t *testing.T) {
 	hello1 := &String{Value: "Hello World"}
@@ -52,3 +58,136 @@ func TestIntegerHashKey(t *testing.T) {
 		t.Errorf("integers with different content have same hash keys")
 	}
 }
+
+func TestErrorTraceback(t *testing.T) {
+	pos := func(line, column int) token.Span {
+		return token.Span{Start: token.Position{Filename: "f.monkey", Line: line, Column: column}}
+	}
+
+	recursive := StackFrame{Function: "loop", Call: pos(2, 5)}
+	err := &Error{
+		Message: "type mismatch: INTEGER + STRING",
+		Span:    pos(2, 12),
+		Stack: []StackFrame{
+			{Function: "add", Call: pos(2, 10)},
+			recursive, recursive, recursive, recursive,
+			{Function: "loop", Call: pos(5, 1)},
+		},
+	}
+
+	expected := `Traceback (most recent call last):
+  f.monkey:5:1: in call to loop
+  f.monkey:2:5: in call to loop
+  [previous call repeated 3 more times]
+  f.monkey:2:10: in call to add
+ERROR: f.monkey:2:12: type mismatch: INTEGER + STRING`
+
+	if err.Traceback() != expected {
+		t.Errorf("wrong traceback. expected=\n%s\ngot=\n%s", expected, err.Traceback())
+	}
+}
+
+func TestFloatHashKey(t *testing.T) {
+	a1 := &Float{Value: 1.5}
+	a2 := &Float{Value: 1.5}
+	b1 := &Float{Value: 2.5}
+	zero := &Float{Value: 0}
+	negZero := &Float{Value: math.Copysign(0, -1)}
+
+	if a1.HashKey() != a2.HashKey() {
+		t.Errorf("floats with same content have different hash keys")
+	}
+	if a1.HashKey() == b1.HashKey() {
+		t.Errorf("floats with different content have same hash keys")
+	}
+	if zero.HashKey() != negZero.HashKey() {
+		t.Errorf("0.0 and -0.0 have different hash keys")
+	}
+	if (&Float{Value: 1}).HashKey() != (&Integer{Value: 1}).HashKey() {
+		t.Errorf("1.0 and 1 have different hash keys")
+	}
+	if (&Float{Value: -1 << 63}).HashKey() != (&Integer{Value: math.MinInt64}).HashKey() {
+		t.Errorf("-2.0 ** 63 and -2 ** 63 have different hash keys")
+	}
+	twoTo64 := new(big.Int).Lsh(big.NewInt(1), 64)
+	if (&Float{Value: 1 << 64}).HashKey() != (&BigInteger{Value: twoTo64}).HashKey() {
+		t.Errorf("2.0 ** 64 and 2 ** 64 have different hash keys")
+	}
+	if (&Float{Value: math.Inf(1)}).HashKey() == (&Float{Value: math.Inf(-1)}).HashKey() {
+		t.Errorf("+Inf and -Inf have same hash keys")
+	}
+}
+
+func TestBigIntegerHashKey(t *testing.T) {
+	twoTo64 := new(big.Int).Lsh(big.NewInt(1), 64)
+	a1 := &BigInteger{Value: twoTo64}
+	a2 := &BigInteger{Value: new(big.Int).Set(twoTo64)}
+	negA := &BigInteger{Value: new(big.Int).Neg(twoTo64)}
+
+	if a1.HashKey() != a2.HashKey() {
+		t.Errorf("big integers with same content have different hash keys")
+	}
+	if a1.HashKey() == negA.HashKey() {
+		t.Errorf("big integers with different signs have same hash keys")
+	}
+	if a1.HashKey() == (&Integer{Value: 0}).HashKey() {
+		t.Errorf("big integer and integer have same hash keys")
+	}
+}
+
+func TestNewInteger(t *testing.T) {
+	small := NewInteger(big.NewInt(math.MinInt64))
+	if integer, ok := small.(*Integer); !ok || integer.Value != math.MinInt64 {
+		t.Errorf("NewInteger(MinInt64) is not an Integer with the same value. got=%T (%+v)", small, small)
+	}
+
+	large := NewInteger(new(big.Int).Add(big.NewInt(math.MaxInt64), big.NewInt(1)))
+	if _, ok := large.(*BigInteger); !ok {
+		t.Errorf("NewInteger(MaxInt64 + 1) is not a BigInteger. got=%T (%+v)", large, large)
+	}
+	if large.Type() != INTEGER_OBJ || large.Inspect() != "9223372036854775808" {
+		t.Errorf("big integer has wrong type or representation. got=%s %s", large.Type(), large.Inspect())
+	}
+}
+
+func TestFloatInspect(t *testing.T) {
+	tests := []struct {
+		value    float64
+		expected string
+	}{
+		{1.5, "1.5"},
+		{-2, "-2.0"},
+		{0, "0.0"},
+		{100000000, "100000000.0"},
+		{1e21, "1e+21"},
+		{0.00001, "1e-05"},
+		{math.Inf(1), "+Inf"},
+		{math.NaN(), "NaN"},
+	}
+
+	for _, tt := range tests {
+		f := &Float{Value: tt.value}
+		if f.Inspect() != tt.expected {
+			t.Errorf("wrong Inspect() for %g. expected=%q, got=%q", tt.value, tt.expected, f.Inspect())
+		}
+	}
+}
+
+func TestExtendEnvironment(t *testing.T) {
+	globals := NewEnvironment()
+	globals.Set("x", &Integer{Value: 1})
+	frame := NewFrame(globals, 0)
+
+	env := ExtendEnvironment(frame)
+	env.Set("y", &Integer{Value: 2})
+
+	if env.Globals() != globals {
+		t.Errorf("extended environment does not share the globals of its outer environment")
+	}
+	if x, ok := env.Get("x"); !ok || x.Inspect() != "1" {
+		t.Errorf("outer variable not found. got=%v", x)
+	}
+	if _, ok := frame.Get("y"); ok {
+		t.Errorf("variable of extended environment found in outer environment")
+	}
+}
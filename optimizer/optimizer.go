@@ -0,0 +1,301 @@
+// Package optimizer simplifies programs before they run, without changing what they do.
+//
+// Prefix and infix expressions on literals are folded into the literal of their value, branches of if
+// expressions with a literal condition that are never taken are removed, and so are statements after a
+// return, break or continue statement. Expressions that fail, like 1 / 0, are left as they are, so that
+// they fail when they are evaluated, as if the program had not been optimised. So are expressions whose
+// values are too large, which are computed only if they are evaluated.
+package optimizer
+
+import (
+	"github.com/GenericEntity/interpreter-go/monkey/ast"
+	"github.com/GenericEntity/interpreter-go/monkey/evaluator"
+	"github.com/GenericEntity/interpreter-go/monkey/object"
+	"github.com/GenericEntity/interpreter-go/monkey/token"
+)
+
+// maxFoldedSize bounds the size of the values of folded expressions (see evaluator.Usage.Allocations).
+// Larger values are left to be computed at run time, within the limits of the program.
+const maxFoldedSize = 1 << 10
+
+// optimizer holds the state of the optimisation of a program.
+type optimizer struct {
+	folder *evaluator.Evaluator // evaluates operators on constants like at run time
+}
+
+// Optimize optimises program in place, for an Evaluator with the default settings.
+func Optimize(program *ast.Program) {
+	OptimizeFor(program, evaluator.New())
+}
+
+// OptimizeFor optimises program in place, for e or a vm running with e: expressions are folded
+// with the arithmetic of e, e.g. overflowing ones are left as they are with e.CheckedArithmetic.
+func OptimizeFor(program *ast.Program, e *evaluator.Evaluator) {
+	o := &optimizer{folder: &evaluator.Evaluator{
+		CheckedArithmetic: e.CheckedArithmetic,
+		MaxAllocations:    maxFoldedSize,
+	}}
+	program.Statements = o.optimizeStatements(program.Statements)
+}
+
+// optimizeStatements optimises a list of statements, which share the scope of the enclosing block.
+// The statements of an if expression whose branch is known are inlined, as they share it too.
+func (o *optimizer) optimizeStatements(stmts []ast.Statement) []ast.Statement {
+	optimized := make([]ast.Statement, 0, len(stmts))
+
+	for i, stmt := range stmts {
+		stmt = o.optimizeStatement(stmt)
+
+		if branch, ok := knownBranch(stmt); ok {
+			last := i == len(stmts)-1
+			switch {
+			case branch != nil && len(branch.Statements) > 0:
+				// the value of the if expression is that of the last statement of the branch
+				optimized = append(optimized, branch.Statements...)
+				stmt = branch.Statements[len(branch.Statements)-1]
+			case !last:
+				// the value of an if expression that is not the last statement is discarded
+				continue
+			default:
+				optimized = append(optimized, stmt)
+			}
+		} else {
+			optimized = append(optimized, stmt)
+		}
+
+		switch stmt.(type) {
+		case *ast.ReturnStatement, *ast.BreakStatement, *ast.ContinueStatement:
+			// later statements are unreachable
+			return optimized
+		}
+	}
+
+	return optimized
+}
+
+// knownBranch returns the branch that stmt takes if it is an if expression with a literal condition,
+// which is nil if it takes none.
+func knownBranch(stmt ast.Statement) (*ast.BlockStatement, bool) {
+	es, ok := stmt.(*ast.ExpressionStatement)
+	if !ok {
+		return nil, false
+	}
+	ie, ok := es.Expression.(*ast.IfExpression)
+	if !ok {
+		return nil, false
+	}
+
+	truthy, ok := isTruthyLiteral(ie.Condition)
+	if !ok {
+		return nil, false
+	}
+	if truthy {
+		return ie.Consequence, true
+	}
+	return ie.Alternative, true
+}
+
+func (o *optimizer) optimizeBlock(block *ast.BlockStatement) *ast.BlockStatement {
+	if block != nil {
+		block.Statements = o.optimizeStatements(block.Statements)
+	}
+	return block
+}
+
+func (o *optimizer) optimizeStatement(stmt ast.Statement) ast.Statement {
+	switch stmt := stmt.(type) {
+	case *ast.ExpressionStatement:
+		stmt.Expression = o.optimizeExpression(stmt.Expression)
+
+	case *ast.LetStatement:
+		stmt.Value = o.optimizeExpression(stmt.Value)
+
+	case *ast.ReturnStatement:
+		stmt.ReturnValue = o.optimizeExpression(stmt.ReturnValue)
+
+	case *ast.BlockStatement:
+		o.optimizeBlock(stmt)
+
+	case *ast.WhileStatement:
+		stmt.Condition = o.optimizeExpression(stmt.Condition)
+		o.optimizeBlock(stmt.Body)
+
+	case *ast.ForStatement:
+		if stmt.Init != nil {
+			stmt.Init = o.optimizeStatement(stmt.Init)
+		}
+		if stmt.Condition != nil {
+			stmt.Condition = o.optimizeExpression(stmt.Condition)
+		}
+		if stmt.Post != nil {
+			stmt.Post = o.optimizeExpression(stmt.Post)
+		}
+		o.optimizeBlock(stmt.Body)
+
+	case *ast.ForInStatement:
+		stmt.Iterable = o.optimizeExpression(stmt.Iterable)
+		o.optimizeBlock(stmt.Body)
+	}
+
+	return stmt
+}
+
+func (o *optimizer) optimizeExpression(exp ast.Expression) ast.Expression {
+	switch exp := exp.(type) {
+	case *ast.PrefixExpression:
+		exp.Right = o.optimizeExpression(exp.Right)
+		if right, ok := constant(exp.Right); ok {
+			o.folder.ResetUsage()
+			return fold(exp, o.folder.Prefix(exp.Operator, right))
+		}
+
+	case *ast.InfixExpression:
+		exp.Left = o.optimizeExpression(exp.Left)
+		exp.Right = o.optimizeExpression(exp.Right)
+		if exp.Operator == "&&" || exp.Operator == "||" {
+			return optimizeLogicalExpression(exp)
+		}
+
+		left, ok := constant(exp.Left)
+		if !ok {
+			break
+		}
+		if right, ok := constant(exp.Right); ok {
+			o.folder.ResetUsage()
+			return fold(exp, o.folder.Infix(exp.Operator, left, right))
+		}
+
+	case *ast.AssignExpression:
+		exp.Value = o.optimizeExpression(exp.Value)
+
+	case *ast.IfExpression:
+		exp.Condition = o.optimizeExpression(exp.Condition)
+		if truthy, ok := isTruthyLiteral(exp.Condition); ok {
+			// keep the condition, which decides which branch is taken, but not the other branch
+			if truthy {
+				exp.Alternative = nil
+			} else {
+				exp.Consequence = &ast.BlockStatement{Token: exp.Consequence.Token, RBrace: exp.Consequence.RBrace}
+			}
+		}
+		o.optimizeBlock(exp.Consequence)
+		o.optimizeBlock(exp.Alternative)
+
+	case *ast.FunctionLiteral:
+		o.optimizeBlock(exp.Body)
+
+	case *ast.CallExpression:
+		if ident, ok := exp.Function.(*ast.Identifier); ok && ident.Value == "quote" {
+			// the syntax tree of the argument is the value of the call
+			break
+		}
+		exp.Function = o.optimizeExpression(exp.Function)
+		o.optimizeExpressions(exp.Arguments)
+
+	case *ast.ArrayLiteral:
+		o.optimizeExpressions(exp.Elements)
+
+	case *ast.SubscriptExpression:
+		exp.Left = o.optimizeExpression(exp.Left)
+		exp.Index = o.optimizeExpression(exp.Index)
+
+	case *ast.HashLiteral:
+		pairs := make(map[ast.Expression]ast.Expression, len(exp.Pairs))
+		for key, value := range exp.Pairs {
+			pairs[o.optimizeExpression(key)] = o.optimizeExpression(value)
+		}
+		exp.Pairs = pairs
+	}
+
+	return exp
+}
+
+func (o *optimizer) optimizeExpressions(exps []ast.Expression) {
+	for i, exp := range exps {
+		exps[i] = o.optimizeExpression(exp)
+	}
+}
+
+// optimizeLogicalExpression folds && and || if their left operand decides the result,
+// or both operands are literals.
+func optimizeLogicalExpression(exp *ast.InfixExpression) ast.Expression {
+	left, ok := isTruthyLiteral(exp.Left)
+	if !ok {
+		return exp
+	}
+
+	if exp.Operator == "&&" && !left {
+		return newBoolean(exp, false)
+	}
+	if exp.Operator == "||" && left {
+		return newBoolean(exp, true)
+	}
+	if right, ok := isTruthyLiteral(exp.Right); ok {
+		return newBoolean(exp, right)
+	}
+	return exp
+}
+
+// constant returns the value of a literal.
+func constant(exp ast.Expression) (object.Object, bool) {
+	switch exp := exp.(type) {
+	case *ast.IntegerLiteral:
+		if exp.Big != nil {
+			return &object.BigInteger{Value: exp.Big}, true
+		}
+		return &object.Integer{Value: exp.Value}, true
+	case *ast.FloatLiteral:
+		return &object.Float{Value: exp.Value}, true
+	case *ast.StringLiteral:
+		return &object.String{Value: exp.Value}, true
+	case *ast.Boolean:
+		if exp.Value {
+			return evaluator.TRUE, true
+		}
+		return evaluator.FALSE, true
+	default:
+		return nil, false
+	}
+}
+
+// isTruthyLiteral reports whether exp is truthy, if it is a literal.
+func isTruthyLiteral(exp ast.Expression) (bool, bool) {
+	value, ok := constant(exp)
+	if !ok {
+		return false, false
+	}
+	return evaluator.IsTruthy(value), true
+}
+
+// fold returns the literal of the value of exp, or exp itself if the value has no literal,
+// e.g. because evaluating exp fails.
+func fold(exp ast.Expression, value object.Object) ast.Expression {
+	tok := token.Token{Literal: value.Inspect(), Span: exp.Span()}
+
+	switch value := value.(type) {
+	case *object.Integer:
+		tok.Type = token.INT
+		return &ast.IntegerLiteral{Token: tok, Value: value.Value}
+	case *object.BigInteger:
+		tok.Type = token.INT
+		return &ast.IntegerLiteral{Token: tok, Big: value.Value}
+	case *object.Float:
+		tok.Type = token.FLOAT
+		return &ast.FloatLiteral{Token: tok, Value: value.Value}
+	case *object.String:
+		tok.Type = token.STRING
+		return &ast.StringLiteral{Token: tok, Value: value.Value}
+	case *object.Boolean:
+		return newBoolean(exp, value.Value)
+	default:
+		return exp
+	}
+}
+
+func newBoolean(exp ast.Expression, value bool) *ast.Boolean {
+	tok := token.Token{Type: token.FALSE, Literal: "false", Span: exp.Span()}
+	if value {
+		tok.Type, tok.Literal = token.TRUE, "true"
+	}
+	return &ast.Boolean{Token: tok, Value: value}
+}
@@ -0,0 +1,176 @@
+package optimizer
+
+import (
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/GenericEntity/interpreter-go/monkey/ast"
+	"github.com/GenericEntity/interpreter-go/monkey/evaluator"
+	"github.com/GenericEntity/interpreter-go/monkey/lexer"
+	"github.com/GenericEntity/interpreter-go/monkey/object"
+	"github.com/GenericEntity/interpreter-go/monkey/parser"
+)
+
+func parse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors for %q: %v", input, p.Errors())
+	}
+	return program
+}
+
+func TestOptimize(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		// folding
+		{"1 + 2 * 3", "7"},
+		{"-(5 - 10)", "5"},
+		{"!true", "false"},
+		{"1.5 * 2", "3.0"},
+		{`"a" + "b"`, "ab"},
+		{`"a" == "a"`, "true"},
+		{"1 < 2 == true", "true"},
+		{"x + 1 * 2", "(x + 2)"},
+		{"let x = 2 * 3;", "let x = 6;"},
+		{"fn(x) { return x * (2 + 2); }", "fn(x){return (x * 4);}"},
+		{"f(1 + 1, [2 * 2])", "f(2, [4])"},
+		{"a[0 + 1]", "(a[1])"},
+		{"x = 10 / 2", "(x = 5)"},
+		{"9223372036854775807 + 1", "9223372036854775808"},
+		{"-(18446744073709551616 / 2)", "-9223372036854775808"},
+		{"quote(1 + unquote(2 * 3))", "quote((1 + unquote((2 * 3))))"},
+		// logical operators
+		{"false && f()", "false"},
+		{"true || f()", "true"},
+		{"true && false", "false"},
+		{"1 && x", "(1 && x)"},
+		{"x || true", "(x || true)"},
+		// errors remain
+		{"1 / 0", "(1 / 0)"},
+		{"1 + true", "(1 + true)"},
+		{"-true", "(-true)"},
+		{"fn() { 1 << 100000000000 }", "fn(){(1 << 100000000000)}"},
+		// unreachable branches
+		{"if (true) { 1 } else { 2 }", "1"},
+		{"if (1 > 2) { 1 } else { 2 }", "2"},
+		{"if (0) { let a = 1; a }", "let a = 1;a"},
+		{"if (false) { 1 }; 2", "2"},
+		{"if (false) { 1 }", "iffalse {}"},
+		{"if (x) { 1 } else { 2 }", "ifx {1}else {2}"},
+		{"let a = if (true) { 1 } else { 2 };", "let a = iftrue {1};"},
+		{"let a = if (false) { 1 } else { 2 };", "let a = iffalse {}else {2};"},
+		// unreachable statements
+		{"fn() { return 1; 2; 3 }", "fn(){return 1;}"},
+		{"fn() { if (true) { return 1 }; 2 }", "fn(){return 1;}"},
+		{"while (x) { break; x = 1 }", "whilex {break;}"},
+		{"for (i in a) { continue; f(i) }", "for (i in a) {continue;}"},
+		{"return 1; 2", "return 1;"},
+	}
+
+	for _, tt := range tests {
+		program := parse(t, tt.input)
+		Optimize(program)
+		if program.String() != tt.expected {
+			t.Errorf("wrong optimisation of %q. expected=%q, got=%q", tt.input, tt.expected, program.String())
+		}
+	}
+}
+
+func TestOptimizeForCheckedArithmetic(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"9223372036854775807 - 1", "9223372036854775806"},
+		{"9223372036854775807 + 1", "(9223372036854775807 + 1)"},
+		{"-(-9223372036854775807 - 1)", "(--9223372036854775808)"},
+		{"2 ** 63", "(2 ** 63)"},
+	}
+
+	for _, tt := range tests {
+		program := parse(t, tt.input)
+		OptimizeFor(program, &evaluator.Evaluator{CheckedArithmetic: true})
+		if program.String() != tt.expected {
+			t.Errorf("wrong optimisation of %q. expected=%q, got=%q", tt.input, tt.expected, program.String())
+		}
+	}
+}
+
+func TestOptimizeLeavesLargeValues(t *testing.T) {
+	small := strings.Repeat("a", maxFoldedSize/4)
+	large := strings.Repeat("a", maxFoldedSize/2)
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`"` + small + `" + "` + small + `"`, small + small},
+		{`"` + large + `" + "` + large + `"`, "(" + large + " + " + large + ")"},
+	}
+
+	for _, tt := range tests {
+		program := parse(t, tt.input)
+		Optimize(program)
+		if program.String() != tt.expected {
+			t.Errorf("wrong optimisation of %q. expected=%q, got=%q", tt.input, tt.expected, program.String())
+		}
+	}
+}
+
+func TestOptimizeConcurrently(t *testing.T) {
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			program := parser.New(lexer.New(`let s = "a" + "b"; s`)).ParseProgram()
+			Optimize(program)
+		}()
+	}
+	wg.Wait()
+}
+
+func TestOptimizePreservesResults(t *testing.T) {
+	tests := []string{
+		"1 + 2 * 3 - 4 / 2",
+		"if (1 < 2) { 10 } else { 20 }",
+		"if (false) { 10 }",
+		"let f = fn(n) { if (true) { return n * (1 + 1) } n }; f(3)",
+		"10 / (5 - 5)",
+		"let x = 1; if (true) { x + true }",
+		"-(\"a\" + \"b\")",
+		"9223372036854775807 + 1",
+		"-(-9223372036854775807 - 1)",
+		`{"a" + "b": 1 + 1}["ab"]`,
+		"let s = 0; for (let i = 0; i < 3; i += 1) { if (false) { continue } s += i * (2 - 1) } s",
+	}
+
+	for _, checked := range []bool{false, true} {
+		for _, input := range tests {
+			e := &evaluator.Evaluator{CheckedArithmetic: checked}
+			expected := e.Eval(parse(t, input), object.NewEnvironment())
+
+			program := parse(t, input)
+			OptimizeFor(program, e)
+			got := e.Eval(program, object.NewEnvironment())
+
+			if got.Inspect() != expected.Inspect() {
+				t.Errorf("wrong result of optimised %q (checked=%t). expected=%s, got=%s",
+					input, checked, expected.Inspect(), got.Inspect())
+			}
+			if gotErr, ok := got.(*object.Error); ok {
+				expectedErr := expected.(*object.Error)
+				if gotErr.Span != expectedErr.Span {
+					t.Errorf("wrong position of error of optimised %q (checked=%t). expected=%v, got=%v",
+						input, checked, expectedErr.Span, gotErr.Span)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package parser
+
+import (
+	"fmt"
+
+	"github.com/GenericEntity/interpreter-go/monkey/token"
+)
+
+// Severity indicates how serious a Diagnostic is.
+type Severity int
+
+const (
+	SeverityError Severity = iota
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityError:
+		return "error"
+	default:
+		return fmt.Sprintf("Severity(%d)", int(s))
+	}
+}
+
+// Diagnostic describes a problem found in the source code while parsing.
+type Diagnostic struct {
+	Severity Severity
+	Span     token.Span
+	Message  string
+	Expected []token.TokenType // the token types that would have been accepted, if known
+}
+
+// String formats the diagnostic as "position: severity: message".
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s: %s: %s", d.Span.Start, d.Severity, d.Message)
+}
@@ -2,6 +2,7 @@ package parser
 
 import (
 	"fmt"
+	"math/big"
 	"strconv"
 
 	"github.com/GenericEntity/interpreter-go/monkey/ast"
@@ -19,34 +20,63 @@ type (
 const (
 	_ int = iota
 	LOWEST
+	ASSIGN      // = or +=
+	OR          // ||
+	AND         // &&
+	BITOR       // |
+	BITXOR      // ^
+	BITAND      // &
 	EQUALS      // ==
 	LESSGREATER // > or <
+	SHIFT       // << or >>
 	SUM         // +
 	PRODUCT     // *
 	PREFIX      // -X or !X
+	POWER       // **
 	CALL        // myFn(X)
 )
 
 var precedences = map[token.TokenType]int{
-	token.EQ:       EQUALS,
-	token.NOT_EQ:   EQUALS,
-	token.LT:       LESSGREATER,
-	token.GT:       LESSGREATER,
-	token.PLUS:     SUM,
-	token.MINUS:    SUM,
-	token.SLASH:    PRODUCT,
-	token.ASTERISK: PRODUCT,
-	token.LPAREN:   CALL,
-	token.LBRACKET: CALL,
+	token.ASSIGN:          ASSIGN,
+	token.PLUS_ASSIGN:     ASSIGN,
+	token.MINUS_ASSIGN:    ASSIGN,
+	token.ASTERISK_ASSIGN: ASSIGN,
+	token.SLASH_ASSIGN:    ASSIGN,
+	token.OR:              OR,
+	token.AND:             AND,
+	token.BIT_OR:          BITOR,
+	token.BIT_XOR:         BITXOR,
+	token.BIT_AND:         BITAND,
+	token.EQ:              EQUALS,
+	token.NOT_EQ:          EQUALS,
+	token.LT:              LESSGREATER,
+	token.GT:              LESSGREATER,
+	token.LT_EQ:           LESSGREATER,
+	token.GT_EQ:           LESSGREATER,
+	token.SHL:             SHIFT,
+	token.SHR:             SHIFT,
+	token.PLUS:            SUM,
+	token.MINUS:           SUM,
+	token.SLASH:           PRODUCT,
+	token.ASTERISK:        PRODUCT,
+	token.PERCENT:         PRODUCT,
+	token.POWER:           POWER,
+	token.LPAREN:          CALL,
+	token.LBRACKET:        CALL,
 }
 
 type Parser struct {
 	lex *lexer.Lexer
 
+	prevToken token.Token
 	currToken token.Token
 	peekToken token.Token
+	pending   []token.Token // tokens pushed back by backup, read before the lexer's
 
-	errors []string
+	diagnostics []Diagnostic
+	panicking   bool // an error was reported and the parser has not resynchronized yet
+	blockDepth  int  // number of block statements currently being parsed
+	loopDepth   int  // number of loop bodies currently being parsed, reset inside function literals
 
 	prefixParseFns map[token.TokenType]prefixParseFn
 	infixParseFns  map[token.TokenType]infixParseFn
@@ -54,23 +84,27 @@ type Parser struct {
 
 func New(lex *lexer.Lexer) *Parser {
 	p := &Parser{
-		lex:    lex,
-		errors: []string{},
+		lex:         lex,
+		diagnostics: []Diagnostic{},
 	}
 
 	p.prefixParseFns = make(map[token.TokenType]prefixParseFn)
 	p.registerPrefix(token.IDENT, p.parseIdentifier)
 	p.registerPrefix(token.INT, p.parseIntegerLiteral)
+	p.registerPrefix(token.FLOAT, p.parseFloatLiteral)
 	p.registerPrefix(token.BANG, p.parsePrefixExpression)
 	p.registerPrefix(token.MINUS, p.parsePrefixExpression)
+	p.registerPrefix(token.BIT_NOT, p.parsePrefixExpression)
 	p.registerPrefix(token.TRUE, p.parseBooleanLiteral)
 	p.registerPrefix(token.FALSE, p.parseBooleanLiteral)
 	p.registerPrefix(token.LPAREN, p.parseGroupExpression)
 	p.registerPrefix(token.IF, p.parseIfExpression)
 	p.registerPrefix(token.FUNCTION, p.parseFunctionLiteral)
+	p.registerPrefix(token.MACRO, p.parseMacroLiteral)
 	p.registerPrefix(token.STRING, p.parseStringLiteral)
 	p.registerPrefix(token.LBRACKET, p.parseArrayLiteral)
 	p.registerPrefix(token.LBRACE, p.parseHashLiteral)
+	p.registerPrefix(token.ILLEGAL, p.parseIllegal)
 
 	p.infixParseFns = make(map[token.TokenType]infixParseFn)
 	p.registerInfix(token.PLUS, p.parseInfixExpression)
@@ -81,6 +115,22 @@ func New(lex *lexer.Lexer) *Parser {
 	p.registerInfix(token.NOT_EQ, p.parseInfixExpression)
 	p.registerInfix(token.LT, p.parseInfixExpression)
 	p.registerInfix(token.GT, p.parseInfixExpression)
+	p.registerInfix(token.LT_EQ, p.parseInfixExpression)
+	p.registerInfix(token.GT_EQ, p.parseInfixExpression)
+	p.registerInfix(token.PERCENT, p.parseInfixExpression)
+	p.registerInfix(token.POWER, p.parseInfixExpression)
+	p.registerInfix(token.BIT_AND, p.parseInfixExpression)
+	p.registerInfix(token.BIT_OR, p.parseInfixExpression)
+	p.registerInfix(token.BIT_XOR, p.parseInfixExpression)
+	p.registerInfix(token.SHL, p.parseInfixExpression)
+	p.registerInfix(token.SHR, p.parseInfixExpression)
+	p.registerInfix(token.AND, p.parseInfixExpression)
+	p.registerInfix(token.OR, p.parseInfixExpression)
+	p.registerInfix(token.ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.PLUS_ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.MINUS_ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.ASTERISK_ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.SLASH_ASSIGN, p.parseAssignExpression)
 	p.registerInfix(token.LPAREN, p.parseCallExpression)
 	p.registerInfix(token.LBRACKET, p.parseSubscriptExpression)
 
@@ -91,19 +141,95 @@ func New(lex *lexer.Lexer) *Parser {
 	return p
 }
 
+// Errors returns the messages of all error diagnostics, each prefixed by its position.
 func (p *Parser) Errors() []string {
-	return p.errors
+	errors := []string{}
+	for _, d := range p.diagnostics {
+		if d.Severity == SeverityError {
+			errors = append(errors, fmt.Sprintf("%s: %s", d.Span.Start, d.Message))
+		}
+	}
+	return errors
+}
+
+// Diagnostics returns all problems found while parsing, in the order they were found.
+func (p *Parser) Diagnostics() []Diagnostic {
+	return p.diagnostics
+}
+
+// errorAt records a parser error located at the given span.
+// Errors are suppressed while the parser is recovering from a previous error,
+// since they are most likely caused by it.
+func (p *Parser) errorAt(span token.Span, expected []token.TokenType, format string, args ...interface{}) {
+	if p.panicking {
+		return
+	}
+	p.panicking = true
+
+	p.diagnostics = append(p.diagnostics, Diagnostic{
+		Severity: SeverityError,
+		Span:     span,
+		Message:  fmt.Sprintf(format, args...),
+		Expected: expected,
+	})
 }
 
 func (p *Parser) peekError(t token.TokenType) {
-	msg := fmt.Sprintf("expected next token to be %s, got %s instead",
+	p.errorAt(p.peekToken.Span, []token.TokenType{t}, "expected next token to be %s, got %s instead",
 		t, p.peekToken.Type)
-	p.errors = append(p.errors, msg)
 }
 
 func (p *Parser) nextToken() {
+	p.prevToken = p.currToken
 	p.currToken = p.peekToken
-	p.peekToken = p.lex.NextToken()
+
+	if n := len(p.pending); n > 0 {
+		p.peekToken = p.pending[n-1]
+		p.pending = p.pending[:n-1]
+	} else {
+		p.peekToken = p.lex.NextToken()
+	}
+}
+
+// backup undoes the last call to nextToken. It can only undo a single call.
+func (p *Parser) backup() {
+	p.pending = append(p.pending, p.peekToken)
+	p.peekToken = p.currToken
+	p.currToken = p.prevToken
+}
+
+// synchronize skips the rest of a malformed statement that started with start,
+// so that parsing can resume at the next statement.
+// It stops so that the next token is the start of a new statement (or closes the current block),
+// as the statement loops advance past the end of each statement.
+func (p *Parser) synchronize(start token.Token) {
+	p.panicking = false
+
+	// the error may have been found at a token which should not be skipped
+	switch p.currToken.Type {
+	case token.LET, token.RETURN, token.WHILE, token.FOR, token.BREAK, token.CONTINUE, token.FUNCTION, token.IF:
+		if p.currToken.Span.Start != start.Span.Start {
+			p.backup()
+			return
+		}
+	case token.RBRACE:
+		if p.blockDepth > 0 {
+			p.backup()
+			return
+		}
+	}
+
+	for !p.currTokenIs(token.EOF) && !p.currTokenIs(token.SEMICOLON) {
+		switch p.peekToken.Type {
+		case token.LET, token.RETURN, token.WHILE, token.FOR, token.BREAK, token.CONTINUE, token.FUNCTION, token.IF, token.EOF:
+			return
+		case token.RBRACE:
+			if p.blockDepth > 0 {
+				return
+			}
+		}
+		p.nextToken()
+	}
 }
 
 func (p *Parser) ParseProgram() *ast.Program {
@@ -121,15 +247,33 @@ func (p *Parser) ParseProgram() *ast.Program {
 	return program
 }
 
+// parseStatement parses the statement starting at currToken.
+// If the statement is malformed, it returns nil and skips to the start of the next statement.
 func (p *Parser) parseStatement() ast.Statement {
+	start := p.currToken
+
+	var stmt ast.Statement
 	switch p.currToken.Type {
 	case token.LET:
-		return p.parseLetStatement()
+		stmt = p.parseLetStatement()
 	case token.RETURN:
-		return p.parseReturnStatement()
+		stmt = p.parseReturnStatement()
+	case token.WHILE:
+		stmt = p.parseWhileStatement()
+	case token.FOR:
+		stmt = p.parseForStatement()
+	case token.BREAK, token.CONTINUE:
+		stmt = p.parseLoopControlStatement()
 	default:
-		return p.parseExpressionStatement()
+		stmt = p.parseExpressionStatement()
+	}
+
+	if p.panicking {
+		p.synchronize(start)
+		return nil
 	}
+
+	return stmt
 }
 
 func (p *Parser) parseLetStatement() *ast.LetStatement {
@@ -148,6 +292,10 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 	p.nextToken()
 	stmt.Value = p.parseExpression(LOWEST)
 
+	if fnLiteral, ok := stmt.Value.(*ast.FunctionLiteral); ok {
+		fnLiteral.Name = stmt.Name.Value
+	}
+
 	if p.peekTokenIs(token.SEMICOLON) {
 		p.nextToken()
 	}
@@ -172,8 +320,11 @@ func (p *Parser) currTokenIs(t token.TokenType) bool {
 	return p.currToken.Type == t
 }
 
+// peekTokenIs checks the type of the next token.
+// While recovering from an error, it always returns false (and peekPrecedence returns LOWEST),
+// so that the rest of the malformed statement is left for synchronize to skip.
 func (p *Parser) peekTokenIs(t token.TokenType) bool {
-	return p.peekToken.Type == t
+	return !p.panicking && p.peekToken.Type == t
 }
 
 func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
@@ -197,6 +348,156 @@ func (p *Parser) registerInfix(tokenType token.TokenType, fn infixParseFn) {
 	p.infixParseFns[tokenType] = fn
 }
 
+func (p *Parser) parseWhileStatement() *ast.WhileStatement {
+	stmt := &ast.WhileStatement{Token: p.currToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	p.nextToken()
+	stmt.Condition = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	stmt.Body = p.parseLoopBody()
+	if stmt.Body == nil {
+		return nil
+	}
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+// parseForStatement parses either a C-style for loop or a for-in loop,
+// depending on whether the opening parenthesis is followed by "name in" or "name, name in".
+func (p *Parser) parseForStatement() ast.Statement {
+	forToken := p.currToken
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+	p.nextToken()
+
+	if p.currTokenIs(token.IDENT) && (p.peekTokenIs(token.IN) || p.peekTokenIs(token.COMMA)) {
+		return p.parseForInStatement(forToken)
+	}
+
+	stmt := &ast.ForStatement{Token: forToken}
+
+	if !p.currTokenIs(token.SEMICOLON) {
+		if p.currTokenIs(token.LET) {
+			stmt.Init = p.parseLetStatement()
+		} else {
+			stmt.Init = p.parseExpressionStatement()
+		}
+		if p.panicking {
+			return nil
+		}
+		if !p.currTokenIs(token.SEMICOLON) {
+			p.peekError(token.SEMICOLON)
+			return nil
+		}
+	}
+
+	p.nextToken()
+	if !p.currTokenIs(token.SEMICOLON) {
+		stmt.Condition = p.parseExpression(LOWEST)
+		if !p.expectPeek(token.SEMICOLON) {
+			return nil
+		}
+	}
+
+	p.nextToken()
+	if !p.currTokenIs(token.RPAREN) {
+		stmt.Post = p.parseExpression(LOWEST)
+		if !p.expectPeek(token.RPAREN) {
+			return nil
+		}
+	}
+
+	stmt.Body = p.parseLoopBody()
+	if stmt.Body == nil {
+		return nil
+	}
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+func (p *Parser) parseForInStatement(forToken token.Token) ast.Statement {
+	stmt := &ast.ForInStatement{Token: forToken}
+
+	stmt.Value = &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal}
+	if p.peekTokenIs(token.COMMA) {
+		p.nextToken()
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		stmt.Key = stmt.Value
+		stmt.Value = &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal}
+	}
+
+	if !p.expectPeek(token.IN) {
+		return nil
+	}
+
+	p.nextToken()
+	stmt.Iterable = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	stmt.Body = p.parseLoopBody()
+	if stmt.Body == nil {
+		return nil
+	}
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+// parseLoopBody parses the block after the head of a loop, in which break and continue are allowed.
+func (p *Parser) parseLoopBody() *ast.BlockStatement {
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	p.loopDepth++
+	defer func() { p.loopDepth-- }()
+
+	return p.parseBlockStatement()
+}
+
+func (p *Parser) parseLoopControlStatement() ast.Statement {
+	tok := p.currToken
+	if p.loopDepth == 0 {
+		p.errorAt(tok.Span, nil, "%s outside loop", tok.Literal)
+		return nil
+	}
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	if tok.Type == token.BREAK {
+		return &ast.BreakStatement{Token: tok}
+	}
+	return &ast.ContinueStatement{Token: tok}
+}
+
 func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
 	stmt := &ast.ExpressionStatement{Token: p.currToken}
 	stmt.Expression = p.parseExpression(LOWEST)
@@ -239,9 +540,29 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 	literal := &ast.IntegerLiteral{Token: p.currToken}
 
 	value, err := strconv.ParseInt(p.currToken.Literal, 0, 64)
+	if err == nil {
+		literal.Value = value
+		return literal
+	}
+
+	// integers that do not fit in an int64 have arbitrary precision, like the results of arithmetic
+	bigValue, ok := new(big.Int).SetString(p.currToken.Literal, 0)
+	if !ok {
+		p.errorAt(p.currToken.Span, nil, "could not parse %q as an integer", p.currToken.Literal)
+		return nil
+	}
+
+	literal.Big = bigValue
+
+	return literal
+}
+
+func (p *Parser) parseFloatLiteral() ast.Expression {
+	literal := &ast.FloatLiteral{Token: p.currToken}
+
+	value, err := strconv.ParseFloat(p.currToken.Literal, 64)
 	if err != nil {
-		msg := fmt.Sprintf("could not parse %q as an integer", p.currToken.Literal)
-		p.errors = append(p.errors, msg)
+		p.errorAt(p.currToken.Span, nil, "could not parse %q as a float", p.currToken.Literal)
 		return nil
 	}
 
@@ -250,9 +571,21 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 	return literal
 }
 
+// parseIllegal reports an ILLEGAL token, with the reason given by the lexer if there is one.
+func (p *Parser) parseIllegal() ast.Expression {
+	for _, err := range p.lex.Errors() {
+		if err.Span == p.currToken.Span {
+			p.errorAt(p.currToken.Span, nil, "%s: %q", err.Message, p.currToken.Literal)
+			return nil
+		}
+	}
+
+	p.errorAt(p.currToken.Span, nil, "illegal token %q", p.currToken.Literal)
+	return nil
+}
+
 func (p *Parser) noPrefixParseFnError(t token.TokenType) {
-	msg := fmt.Sprintf("no prefix parse function for type %s found", t)
-	p.errors = append(p.errors, msg)
+	p.errorAt(p.currToken.Span, nil, "expected an expression, got %s instead", t)
 }
 
 func (p *Parser) parsePrefixExpression() ast.Expression {
@@ -269,6 +602,10 @@ func (p *Parser) parsePrefixExpression() ast.Expression {
 }
 
 func (p *Parser) peekPrecedence() int {
+	if p.panicking {
+		return LOWEST
+	}
+
 	if prec, ok := precedences[p.peekToken.Type]; ok {
 		return prec
 	}
@@ -304,12 +641,37 @@ func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 		a + b + c + d = a + (b + (c + d))
 
 		Simply decreasing the right-binding power of + by 1 here would work. Try it!
+
+		This is exactly what we do for **, which is right-associative: 2 ** 3 ** 2 = 2 ** (3 ** 2)
 	*/
+	if expr.Token.Type == token.POWER {
+		precedence--
+	}
 	expr.Right = p.parseExpression(precedence)
 
 	return expr
 }
 
+func (p *Parser) parseAssignExpression(left ast.Expression) ast.Expression {
+	name, ok := left.(*ast.Identifier)
+	if !ok {
+		p.errorAt(left.Span(), nil, "cannot assign to %s", left.String())
+		return nil
+	}
+
+	expr := &ast.AssignExpression{
+		Token:    p.currToken,
+		Name:     name,
+		Operator: p.currToken.Literal,
+	}
+
+	// assignment is right-associative: a = b = c is a = (b = c)
+	p.nextToken()
+	expr.Value = p.parseExpression(ASSIGN - 1)
+
+	return expr
+}
+
 func (p *Parser) parseBooleanLiteral() ast.Expression {
 	return &ast.Boolean{Token: p.currToken, Value: p.currTokenIs(token.TRUE)}
 }
@@ -365,6 +727,9 @@ func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 	block := &ast.BlockStatement{Token: p.currToken}
 	block.Statements = []ast.Statement{}
 
+	p.blockDepth++
+	defer func() { p.blockDepth-- }()
+
 	p.nextToken()
 
 	for !p.currTokenIs(token.RBRACE) && !p.currTokenIs(token.EOF) {
@@ -374,6 +739,7 @@ func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 		}
 		p.nextToken()
 	}
+	block.RBrace = p.currToken
 
 	return block
 }
@@ -391,11 +757,36 @@ func (p *Parser) parseFunctionLiteral() ast.Expression {
 		return nil
 	}
 
+	// break and continue cannot jump out of a function
+	loopDepth := p.loopDepth
+	p.loopDepth = 0
 	fnLiteral.Body = p.parseBlockStatement()
+	p.loopDepth = loopDepth
 
 	return fnLiteral
 }
 
+func (p *Parser) parseMacroLiteral() ast.Expression {
+	macro := &ast.MacroLiteral{Token: p.currToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	macro.Parameters = p.parseFunctionParameters()
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	loopDepth := p.loopDepth
+	p.loopDepth = 0
+	macro.Body = p.parseBlockStatement()
+	p.loopDepth = loopDepth
+
+	return macro
+}
+
 func (p *Parser) parseFunctionParameters() []*ast.Identifier {
 	params := []*ast.Identifier{}
 
@@ -404,14 +795,18 @@ func (p *Parser) parseFunctionParameters() []*ast.Identifier {
 		return params
 	}
 
-	p.nextToken()
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
 
 	param := p.parseIdentifier().(*ast.Identifier)
 	params = append(params, param)
 
 	for p.peekTokenIs(token.COMMA) {
 		p.nextToken()
-		p.nextToken()
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
 		param := p.parseIdentifier().(*ast.Identifier)
 		params = append(params, param)
 	}
@@ -426,6 +821,7 @@ func (p *Parser) parseFunctionParameters() []*ast.Identifier {
 func (p *Parser) parseCallExpression(fn ast.Expression) ast.Expression {
 	callExpr := &ast.CallExpression{Token: p.currToken, Function: fn}
 	callExpr.Arguments = p.parseSeparatedExpressions(token.COMMA, token.RPAREN)
+	callExpr.RParen = p.currToken
 	return callExpr
 }
 
@@ -460,6 +856,7 @@ func (p *Parser) parseStringLiteral() ast.Expression {
 func (p *Parser) parseArrayLiteral() ast.Expression {
 	arr := &ast.ArrayLiteral{Token: p.currToken}
 	arr.Elements = p.parseSeparatedExpressions(token.COMMA, token.RBRACKET)
+	arr.RBracket = p.currToken
 	return arr
 }
 
@@ -471,6 +868,7 @@ func (p *Parser) parseSubscriptExpression(arr ast.Expression) ast.Expression {
 	if !p.expectPeek(token.RBRACKET) {
 		return nil
 	}
+	subscriptExpr.RBracket = p.currToken
 
 	return subscriptExpr
 }
@@ -478,6 +876,7 @@ func (p *Parser) parseSubscriptExpression(arr ast.Expression) ast.Expression {
 func (p *Parser) parseHashLiteral() ast.Expression {
 	hash := &ast.HashLiteral{Token: p.currToken}
 	hash.Pairs = p.parseHashPairs()
+	hash.RBrace = p.currToken
 	return hash
 }
 
@@ -2,10 +2,12 @@ package parser
 
 import (
 	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/GenericEntity/interpreter-go/monkey/ast"
 	"github.com/GenericEntity/interpreter-go/monkey/lexer"
+	"github.com/GenericEntity/interpreter-go/monkey/token"
 )
 
 type id struct {
@@ -152,6 +154,129 @@ func TestIntegerLiteralExpression(t *testing.T) {
 	testIntegerLiteral(t, stmt.Expression, 5)
 }
 
+func TestPrefixedIntegerLiteralExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"0x1F", 31},
+		{"0o17", 15},
+		{"0b1010", 10},
+		{"1_000_000", 1000000},
+		{"0xFF_FF", 65535},
+	}
+
+	for _, tt := range tests {
+		program := testParse(t, tt.input)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		literal, ok := stmt.Expression.(*ast.IntegerLiteral)
+		if !ok {
+			t.Fatalf("exp not *ast.IntegerLiteral. got=%T", stmt.Expression)
+		}
+
+		if literal.Value != tt.expected {
+			t.Errorf("literal.Value not %d. got=%d", tt.expected, literal.Value)
+		}
+	}
+}
+
+func TestBigIntegerLiteralExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"9223372036854775808", "9223372036854775808"},
+		{"100000000000000000000", "100000000000000000000"},
+		{"0xFFFF_FFFF_FFFF_FFFF_FFFF", "1208925819614629174706175"},
+		{"0b1" + strings.Repeat("0", 64), "18446744073709551616"},
+	}
+
+	for _, tt := range tests {
+		program := testParse(t, tt.input)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		literal, ok := stmt.Expression.(*ast.IntegerLiteral)
+		if !ok {
+			t.Fatalf("exp not *ast.IntegerLiteral. got=%T", stmt.Expression)
+		}
+
+		if literal.Big == nil || literal.Big.String() != tt.expected || literal.Value != 0 {
+			t.Errorf("literal.Big not %s. got=%v (value %d)", tt.expected, literal.Big, literal.Value)
+		}
+		if literal.String() != tt.input {
+			t.Errorf("literal.String() not %q. got=%q", tt.input, literal.String())
+		}
+	}
+
+	// literals that fit in an int64 have no big value
+	literal := testParse(t, "9223372036854775807").Statements[0].(*ast.ExpressionStatement).Expression.(*ast.IntegerLiteral)
+	if literal.Big != nil || literal.Value != 9223372036854775807 {
+		t.Errorf("wrong literal for the largest int64. got=%v (big %v)", literal.Value, literal.Big)
+	}
+}
+
+func TestIllegalTokenErrors(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{"let flags = 0xZZ;", `1:13: invalid digit 'Z' in hexadecimal literal: "0xZZ"`},
+		{"1 + 0b;", `1:5: binary literal has no digits: "0b"`},
+		{"1 $ 2", `1:3: illegal token "$"`},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) != 1 {
+			t.Errorf("expected exactly 1 error for %q. got=%q", tt.input, errors)
+			continue
+		}
+
+		if errors[0] != tt.expectedMessage {
+			t.Errorf("wrong error for %q. expected=%q, got=%q", tt.input, tt.expectedMessage, errors[0])
+		}
+	}
+}
+
+func TestFloatLiteralExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected float64
+	}{
+		{"1.5;", 1.5},
+		{"0.125", 0.125},
+		{"3e2", 300},
+		{"2.5e-1", 0.25},
+	}
+
+	for _, tt := range tests {
+		program := testParse(t, tt.input)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program has wrong number of statements. got=%d", len(program.Statements))
+		}
+
+		stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+		if !ok {
+			t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T",
+				program.Statements[0])
+		}
+
+		literal, ok := stmt.Expression.(*ast.FloatLiteral)
+		if !ok {
+			t.Fatalf("exp not *ast.FloatLiteral. got=%T", stmt.Expression)
+		}
+
+		if literal.Value != tt.expected {
+			t.Errorf("literal.Value not %g. got=%g", tt.expected, literal.Value)
+		}
+	}
+}
+
 func TestPrefixExpressions(t *testing.T) {
 	prefixTests := []struct {
 		input         string
@@ -162,6 +287,7 @@ func TestPrefixExpressions(t *testing.T) {
 		{"-15;", "-", 15},
 		{"!true", "!", true},
 		{"!false", "!", false},
+		{"~7", "~", 7},
 	}
 
 	for _, tt := range prefixTests {
@@ -293,6 +419,17 @@ func TestInfixExpressions(t *testing.T) {
 		{"true == true", true, "==", true},
 		{"true != false", true, "!=", false},
 		{"false == false", false, "==", false},
+		{"true && false", true, "&&", false},
+		{"false || true", false, "||", true},
+		{"5 <= 6", 5, "<=", 6},
+		{"5 >= 6", 5, ">=", 6},
+		{"5 % 6", 5, "%", 6},
+		{"5 ** 6", 5, "**", 6},
+		{"5 & 6", 5, "&", 6},
+		{"5 | 6", 5, "|", 6},
+		{"5 ^ 6", 5, "^", 6},
+		{"5 << 6", 5, "<<", 6},
+		{"5 >> 6", 5, ">>", 6},
 	}
 
 	for _, tt := range infixTests {
@@ -431,6 +568,46 @@ func TestOperatorPrecedence(t *testing.T) {
 			"add(a * b[2], b[1], 2 * [1, 2][1])",
 			"add((a * (b[2])), (b[1]), (2 * ([1, 2][1])))",
 		},
+		{
+			"a || b && c || d",
+			"((a || (b && c)) || d)",
+		},
+		{
+			"a < b && b == c || !d",
+			"(((a < b) && (b == c)) || (!d))",
+		},
+		{
+			"a = b = c + d || e",
+			"(a = (b = ((c + d) || e)))",
+		},
+		{
+			"a += b *= c",
+			"(a += (b *= c))",
+		},
+		{
+			"a ** b ** c",
+			"(a ** (b ** c))",
+		},
+		{
+			"-a ** b * c",
+			"((-(a ** b)) * c)",
+		},
+		{
+			"a * b % c ** d",
+			"((a * b) % (c ** d))",
+		},
+		{
+			"a | b ^ c & d == e",
+			"(a | (b ^ (c & (d == e))))",
+		},
+		{
+			"a << b + c >= d >> e",
+			"((a << (b + c)) >= (d >> e))",
+		},
+		{
+			"~a & b <= c || d",
+			"(((~a) & (b <= c)) || d)",
+		},
 	}
 
 	for _, tt := range tests {
@@ -462,6 +639,64 @@ func testBooleanLiteral(t *testing.T, expr ast.Expression, value bool) bool {
 	return true
 }
 
+func TestAssignExpressions(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedName  string
+		operator      string
+		expectedValue interface{}
+	}{
+		{"x = 5;", "x", "=", 5},
+		{"y += 1", "y", "+=", 1},
+		{`z -= "foo"`, "z", "-=", "foo"},
+		{"a *= 2", "a", "*=", 2},
+		{"b /= true", "b", "/=", true},
+	}
+
+	for _, tt := range tests {
+		program := testParse(t, tt.input)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain 1 statement. got=%d", len(program.Statements))
+		}
+
+		stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+		if !ok {
+			t.Fatalf("program.Statements[0] is not *ast.ExpressionStatement. got=%T", program.Statements[0])
+		}
+
+		expr, ok := stmt.Expression.(*ast.AssignExpression)
+		if !ok {
+			t.Fatalf("stmt.Expression is not *ast.AssignExpression. got=%T", stmt.Expression)
+		}
+
+		if !testIdentifier(t, expr.Name, tt.expectedName) {
+			continue
+		}
+
+		if expr.Operator != tt.operator {
+			t.Errorf("expr.Operator is not %q. got=%q", tt.operator, expr.Operator)
+		}
+
+		testLiteralExpression(t, expr.Value, tt.expectedValue)
+	}
+}
+
+func TestInvalidAssignmentTarget(t *testing.T) {
+	p := New(lexer.New("let a = 1; a + 1 = 2; let b = 3;"))
+	program := p.ParseProgram()
+
+	errors := p.Errors()
+	expected := "1:12: cannot assign to (a + 1)"
+	if len(errors) != 1 || errors[0] != expected {
+		t.Fatalf("wrong errors. expected=[%q], got=%q", expected, errors)
+	}
+
+	if len(program.Statements) != 2 {
+		t.Errorf("program does not contain the 2 valid statements. got=%q", program.String())
+	}
+}
+
 func TestBooleanExpression(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -585,6 +820,138 @@ func TestIfElseExpression(t *testing.T) {
 	}
 }
 
+func TestWhileStatement(t *testing.T) {
+	program := testParse(t, "while (x < 10) { x += 1; if (x == 5) { break } else { continue } }")
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain 1 statement. got=%d", len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.WhileStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not *ast.WhileStatement. got=%T", program.Statements[0])
+	}
+
+	if stmt.Condition.String() != "(x < 10)" {
+		t.Errorf("condition wrong. expected=%q, got=%q", "(x < 10)", stmt.Condition.String())
+	}
+
+	expected := "{(x += 1)if(x == 5) {break;}else {continue;}}"
+	if stmt.Body.String() != expected {
+		t.Errorf("body wrong. expected=%q, got=%q", expected, stmt.Body.String())
+	}
+}
+
+func TestForStatement(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"for (let i = 0; i < 10; i += 1) { puts(i) }", "for (let i = 0; (i < 10); (i += 1)) {puts(i)}"},
+		{"for (i = 0; i < 10; i += 1) { }", "for ((i = 0); (i < 10); (i += 1)) {}"},
+		{"for (;;) { break; }", "for (; ; ) {break;}"},
+		{"for (; x;) { continue; }", "for (; x; ) {continue;}"},
+	}
+
+	for _, tt := range tests {
+		program := testParse(t, tt.input)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain 1 statement. got=%d", len(program.Statements))
+		}
+
+		stmt, ok := program.Statements[0].(*ast.ForStatement)
+		if !ok {
+			t.Fatalf("program.Statements[0] is not *ast.ForStatement. got=%T", program.Statements[0])
+		}
+
+		if stmt.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, stmt.String())
+		}
+	}
+}
+
+func TestForInStatement(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedKey   string
+		expectedValue string
+	}{
+		{"for (x in [1, 2]) { x }", "", "x"},
+		{"for (i, x in xs) { x }", "i", "x"},
+	}
+
+	for _, tt := range tests {
+		program := testParse(t, tt.input)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain 1 statement. got=%d", len(program.Statements))
+		}
+
+		stmt, ok := program.Statements[0].(*ast.ForInStatement)
+		if !ok {
+			t.Fatalf("program.Statements[0] is not *ast.ForInStatement. got=%T", program.Statements[0])
+		}
+
+		if tt.expectedKey == "" {
+			if stmt.Key != nil {
+				t.Errorf("stmt.Key is not nil. got=%q", stmt.Key)
+			}
+		} else {
+			testIdentifier(t, stmt.Key, tt.expectedKey)
+		}
+		testIdentifier(t, stmt.Value, tt.expectedValue)
+
+		if len(stmt.Body.Statements) != 1 {
+			t.Errorf("body does not contain 1 statement. got=%d", len(stmt.Body.Statements))
+		}
+	}
+}
+
+func TestLoopsFollowedBySemicolons(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"while (i < 3) { i += 1 }; i", "while(i < 3) {(i += 1)}i"},
+		{"for (;;) { break }; i", "for (; ; ) {break;}i"},
+		{"for (x in [1]) { s += x }; s", "for (x in [1]) {(s += x)}s"},
+	}
+
+	for _, tt := range tests {
+		program := testParse(t, tt.input)
+
+		if len(program.Statements) != 2 {
+			t.Fatalf("program.Statements does not contain 2 statements. got=%d", len(program.Statements))
+		}
+		if program.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+}
+
+func TestLoopControlOutsideLoop(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedError string
+	}{
+		{"break;", "1:1: break outside loop"},
+		{"if (true) { continue }", "1:13: continue outside loop"},
+		{"while (true) { let f = fn() { break }; }", "1:31: break outside loop"},
+		{"for (x in xs) { } break", "1:19: break outside loop"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) != 1 || errors[0] != tt.expectedError {
+			t.Errorf("wrong errors for %q. expected=[%q], got=%q", tt.input, tt.expectedError, errors)
+		}
+	}
+}
+
 func TestFunctionLiteral(t *testing.T) {
 	input := `fn(x, y) { x + y; }`
 
@@ -624,6 +991,44 @@ func TestFunctionLiteral(t *testing.T) {
 	testInfixExpression(t, bodyStmt.Expression, id{"x"}, "+", id{"y"})
 }
 
+func TestMacroLiteral(t *testing.T) {
+	input := `macro(x, y) { x + y; }`
+
+	program := testParse(t, input)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program does not have %d statement(s). got=%d", 1, len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not *ast.ExpressionStatement. got=%T", program.Statements[0])
+	}
+
+	macro, ok := stmt.Expression.(*ast.MacroLiteral)
+	if !ok {
+		t.Fatalf("stmt.Expression is not *ast.MacroLiteral. got=%T", stmt.Expression)
+	}
+
+	if len(macro.Parameters) != 2 {
+		t.Fatalf("macro does not have %d parameter(s). got=%d", 2, len(macro.Parameters))
+	}
+
+	testLiteralExpression(t, macro.Parameters[0], id{"x"})
+	testLiteralExpression(t, macro.Parameters[1], id{"y"})
+
+	if len(macro.Body.Statements) != 1 {
+		t.Fatalf("macro body does not have %d statement(s). got=%d", 1, len(macro.Body.Statements))
+	}
+
+	bodyStmt, ok := macro.Body.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("macro.Body.Statements[0] is not *ast.ExpressionStatement. got=%T", macro.Body.Statements[0])
+	}
+
+	testInfixExpression(t, bodyStmt.Expression, id{"x"}, "+", id{"y"})
+}
+
 func TestFunctionLiteralParameters(t *testing.T) {
 	tests := []struct {
 		input          string
@@ -941,3 +1346,189 @@ func TestHashSubscriptExpression(t *testing.T) {
 		testLiteralExpression(t, subscriptExpr.Index, tt.expectedIndex)
 	}
 }
+
+func TestNodeSpans(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedStart int // byte offsets of the first statement's span
+		expectedEnd   int
+	}{
+		{"foobar;", 0, 6},
+		{"let x = 5 * 10;", 0, 14},
+		{"return -a;", 0, 9},
+		{"  a + b * c", 2, 11},
+		{"add(1, 2)", 0, 9},
+		{"[1, 2][0]", 0, 9},
+		{`{"a": 1}`, 0, 8},
+		{"if (x) { y } else { z }", 0, 23},
+		{"fn(x) {\n  x\n}", 0, 13},
+	}
+
+	for _, tt := range tests {
+		program := testParse(t, tt.input)
+
+		span := program.Statements[0].Span()
+		if span.Start.Offset != tt.expectedStart || span.End.Offset != tt.expectedEnd {
+			t.Errorf("wrong span for %q. expected=[%d, %d), got=[%d, %d)",
+				tt.input, tt.expectedStart, tt.expectedEnd, span.Start.Offset, span.End.Offset)
+		}
+	}
+}
+
+func TestErrorPositions(t *testing.T) {
+	input := "let x = 5;\nlet = 10;"
+
+	p := New(lexer.NewWithFilename("test.monkey", input))
+	p.ParseProgram()
+
+	errors := p.Errors()
+	if len(errors) == 0 {
+		t.Fatalf("expected parser errors, got none")
+	}
+
+	expected := "test.monkey:2:5: expected next token to be IDENT, got = instead"
+	if errors[0] != expected {
+		t.Errorf("wrong error. expected=%q, got=%q", expected, errors[0])
+	}
+}
+
+func TestErrorRecovery(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+		expectedProgram string
+	}{
+		{
+			"let = 5; let y = 2; y",
+			"1:5: expected next token to be IDENT, got = instead",
+			"let y = 2;y",
+		},
+		{
+			"let x = 5 +\nlet y = 2; y",
+			"2:1: expected an expression, got LET instead",
+			"let y = 2;y",
+		},
+		{
+			"let f = fn(x) { x + }; f(1)",
+			"1:21: expected an expression, got } instead",
+			"let f = fn(x){};f(1)",
+		},
+		{
+			"if (a) { 1 + } else { 2 }; 3",
+			"1:14: expected an expression, got } instead",
+			"ifa {}else {2}3",
+		},
+		{
+			"if (x { y }; let z = 1",
+			"1:7: expected next token to be ), got { instead",
+			"let z = 1;",
+		},
+		{
+			"} let a = 1",
+			"1:1: expected an expression, got } instead",
+			"let a = 1;",
+		},
+		{
+			"let x = ((1 + 2) * ; let y = 3",
+			"1:20: expected an expression, got ; instead",
+			"let y = 3;",
+		},
+		{
+			"fn(x, 1) { x }",
+			"1:7: expected next token to be IDENT, got INT instead",
+			"",
+		},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) != 1 {
+			t.Errorf("expected exactly 1 error for %q. got=%q", tt.input, errors)
+			continue
+		}
+
+		if errors[0] != tt.expectedMessage {
+			t.Errorf("wrong error for %q. expected=%q, got=%q", tt.input, tt.expectedMessage, errors[0])
+		}
+
+		if program.String() != tt.expectedProgram {
+			t.Errorf("wrong program after recovery for %q. expected=%q, got=%q",
+				tt.input, tt.expectedProgram, program.String())
+		}
+	}
+}
+
+func TestErrorRecoveryReportsLaterErrors(t *testing.T) {
+	tests := []struct {
+		input            string
+		expectedMessages []string
+	}{
+		{
+			"let x = )\nfn(a) { a + }",
+			[]string{"1:9: expected an expression, got ) instead", "2:13: expected an expression, got } instead"},
+		},
+		{
+			"let x = )\nif (y) { 1 + }",
+			[]string{"1:9: expected an expression, got ) instead", "2:14: expected an expression, got } instead"},
+		},
+		{
+			"let = 1\nwhile (x) { let = 2 }",
+			[]string{"1:5: expected next token to be IDENT, got = instead", "2:17: expected next token to be IDENT, got = instead"},
+		},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if fmt.Sprint(errors) != fmt.Sprint(tt.expectedMessages) {
+			t.Errorf("wrong errors for %q. expected=%q, got=%q", tt.input, tt.expectedMessages, errors)
+		}
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	p := New(lexer.New("foo(1, 2"))
+	p.ParseProgram()
+
+	diagnostics := p.Diagnostics()
+	if len(diagnostics) != 1 {
+		t.Fatalf("expected 1 diagnostic. got=%d", len(diagnostics))
+	}
+
+	d := diagnostics[0]
+	if d.Severity != SeverityError {
+		t.Errorf("wrong severity. expected=%s, got=%s", SeverityError, d.Severity)
+	}
+	if d.Span.Start.Offset != 8 {
+		t.Errorf("wrong position. expected offset 8, got=%d", d.Span.Start.Offset)
+	}
+	if len(d.Expected) != 1 || d.Expected[0] != token.RPAREN {
+		t.Errorf("wrong expected tokens. expected=[%s], got=%v", token.RPAREN, d.Expected)
+	}
+	if d.String() != "1:9: error: expected next token to be ), got EOF instead" {
+		t.Errorf("wrong diagnostic string. got=%q", d.String())
+	}
+}
+
+func TestFunctionLiteralWithName(t *testing.T) {
+	program := testParse(t, "let myFunction = fn() { };")
+
+	stmt, ok := program.Statements[0].(*ast.LetStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not *ast.LetStatement. got=%T", program.Statements[0])
+	}
+
+	function, ok := stmt.Value.(*ast.FunctionLiteral)
+	if !ok {
+		t.Fatalf("stmt.Value is not *ast.FunctionLiteral. got=%T", stmt.Value)
+	}
+
+	if function.Name != "myFunction" {
+		t.Errorf("function literal name wrong. expected=%q, got=%q", "myFunction", function.Name)
+	}
+}
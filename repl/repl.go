@@ -4,11 +4,9 @@ import (
 	"bufio"
 	"fmt"
 	"io"
+	"strings"
 
-	"github.com/GenericEntity/interpreter-go/monkey/evaluator"
-	"github.com/GenericEntity/interpreter-go/monkey/lexer"
-	"github.com/GenericEntity/interpreter-go/monkey/object"
-	"github.com/GenericEntity/interpreter-go/monkey/parser"
+	"github.com/GenericEntity/interpreter-go/monkey/interpreter"
 )
 
 const PROMPT = ">> "
@@ -18,33 +16,38 @@ func Greet(out io.Writer, name string) {
 	fmt.Fprintf(out, "Please enjoy the infinite loop of interpretation! (CTRL-C to terminate)\n")
 }
 
-func Start(in io.Reader, out io.Writer) {
-	scanner := bufio.NewScanner(in)
-	env := object.NewEnvironment()
+// Start runs the REPL until in ends. Programs read their input from in and write their output to out.
+// The options configure the interpreter that runs them.
+func Start(in io.Reader, out io.Writer, options ...interpreter.Option) {
+	// programs share the reader, so that input they do not read is left for the REPL
+	reader := bufio.NewReader(in)
+	options = append([]interpreter.Option{interpreter.WithStdout(out), interpreter.WithStdin(reader)}, options...)
+	monkey := interpreter.New(options...)
 
 	for {
 		// Read
 		fmt.Fprint(out, PROMPT)
-		isScanned := scanner.Scan()
-		if !isScanned {
+		line, err := reader.ReadString('\n')
+		if err != nil && line == "" {
 			break
 		}
 
 		// Eval
-		line := scanner.Text()
-		lex := lexer.New(line)
-		p := parser.New(lex)
-
-		program := p.ParseProgram()
-		if len(p.Errors()) != 0 {
-			printParserErrors(out, p.Errors())
-			continue
-		}
-
-		evaluated := evaluator.Eval(program, env)
-		if evaluated != nil {
-			io.WriteString(out, evaluated.Inspect())
+		line = strings.TrimRight(line, "\r\n")
+		evaluated, err := monkey.Eval(line)
+		switch err := err.(type) {
+		case nil:
+			if evaluated != nil {
+				io.WriteString(out, evaluated.Inspect())
+				io.WriteString(out, "\n")
+			}
+		case *interpreter.ParseError:
+			printParserErrors(out, err.Messages())
+		case *interpreter.RuntimeError:
+			io.WriteString(out, err.Traceback())
 			io.WriteString(out, "\n")
+		default:
+			io.WriteString(out, err.Error()+"\n")
 		}
 	}
 }
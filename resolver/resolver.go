@@ -0,0 +1,284 @@
+// Package resolver resolves the variables of a program before it runs, so that they can be stored
+// in slots of frames instead of being looked up by name.
+//
+// Function bodies and for loops have their own scope, but other blocks do not, like in the evaluator.
+// Variables declared outside functions and loops are global, and remain looked up by name, since
+// programs run one after the other share them. All other variables are local to a function, or to the
+// program for loops outside functions, and are stored in the slot of its frame given by their index.
+//
+// A variable must be declared before it is used, except in function bodies, which are resolved at
+// the end of the scope they are defined in, so that functions can refer to functions defined after them.
+package resolver
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/GenericEntity/interpreter-go/monkey/ast"
+	"github.com/GenericEntity/interpreter-go/monkey/token"
+)
+
+// Error is a use of a variable that is not defined.
+type Error struct {
+	Span    token.Span
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.Span.Start, e.Message)
+}
+
+// function is a function being resolved, or the program.
+type function struct {
+	outer  *function
+	blocks []*block // nested scopes, innermost last
+	slots  int      // number of local variables so far
+}
+
+// block is a scope, which declares variables and defines functions to resolve once it ends.
+type block struct {
+	names   map[string]int // slots of the local variables, unless the block is global
+	pending []*ast.FunctionLiteral
+}
+
+type resolver struct {
+	function *function
+	globals  map[string]bool // global variables declared by the program so far
+	defined  func(name string) bool
+	errors   []*Error
+	quoted   bool // whether the expression being resolved is quoted, and so not evaluated
+}
+
+// Resolve sets the scope, index and depth of every identifier in program, and the number of slots
+// of program and its function literals. defined reports whether a variable that is not declared by
+// program exists already, e.g. a builtin function or a global variable of an earlier program;
+// if it is nil, any variable might. It returns the undefined variables, in the order they appear.
+func Resolve(program *ast.Program, defined func(name string) bool) []*Error {
+	r := &resolver{
+		function: &function{},
+		globals:  map[string]bool{},
+		defined:  defined,
+	}
+
+	r.enterBlock()
+	r.resolveStatements(program.Statements)
+	r.leaveBlock()
+	program.Slots = r.function.slots
+
+	sort.SliceStable(r.errors, func(i, j int) bool {
+		return r.errors[i].Span.Start.Offset < r.errors[j].Span.Start.Offset
+	})
+	return r.errors
+}
+
+func (r *resolver) enterBlock() {
+	r.function.blocks = append(r.function.blocks, &block{names: map[string]int{}})
+}
+
+// leaveBlock ends the innermost scope, resolving the functions defined in it.
+func (r *resolver) leaveBlock() {
+	current := r.function.blocks[len(r.function.blocks)-1]
+	for i := 0; i < len(current.pending); i++ {
+		r.resolveFunction(current.pending[i])
+	}
+	r.function.blocks = r.function.blocks[:len(r.function.blocks)-1]
+}
+
+// isGlobal reports whether variables declared in the innermost scope are global.
+func (r *resolver) isGlobal() bool {
+	return r.function.outer == nil && len(r.function.blocks) == 1
+}
+
+// declare declares the variable of ident in the innermost scope.
+// Declaring a variable that already exists in that scope reuses it.
+func (r *resolver) declare(ident *ast.Identifier) {
+	if r.quoted {
+		return
+	}
+	if r.isGlobal() {
+		r.globals[ident.Value] = true
+		ident.Scope, ident.Index, ident.Depth = ast.ScopeGlobal, 0, 0
+		return
+	}
+
+	current := r.function.blocks[len(r.function.blocks)-1]
+	index, ok := current.names[ident.Value]
+	if !ok {
+		index = r.function.slots
+		current.names[ident.Value] = index
+		r.function.slots++
+	}
+	ident.Scope, ident.Index, ident.Depth = ast.ScopeLocal, index, 0
+}
+
+// resolve resolves a use of the variable of ident to the innermost scope that declares it,
+// reporting msg if there is none.
+func (r *resolver) resolve(ident *ast.Identifier, msg string) {
+	if r.quoted {
+		return
+	}
+
+	depth := 0
+	for fn := r.function; fn != nil; fn = fn.outer {
+		for i := len(fn.blocks) - 1; i >= 0; i-- {
+			if index, ok := fn.blocks[i].names[ident.Value]; ok {
+				ident.Scope, ident.Index, ident.Depth = ast.ScopeLocal, index, depth
+				if depth > 0 {
+					ident.Scope = ast.ScopeFree
+				}
+				return
+			}
+		}
+		depth++
+	}
+
+	ident.Scope, ident.Index, ident.Depth = ast.ScopeGlobal, 0, 0
+	if !r.globals[ident.Value] && r.defined != nil && !r.defined(ident.Value) {
+		r.errors = append(r.errors, &Error{Span: ident.Span(), Message: msg + ident.Value})
+	}
+}
+
+func (r *resolver) resolveStatements(stmts []ast.Statement) {
+	for _, stmt := range stmts {
+		r.resolveStatement(stmt)
+	}
+}
+
+func (r *resolver) resolveStatement(stmt ast.Statement) {
+	switch stmt := stmt.(type) {
+	case *ast.ExpressionStatement:
+		r.resolveExpression(stmt.Expression)
+
+	case *ast.LetStatement:
+		// a function can call itself through the variable it is assigned to,
+		// but other values refer to the previous variable with the same name, if any
+		if _, ok := stmt.Value.(*ast.FunctionLiteral); ok {
+			r.declare(stmt.Name)
+			r.resolveExpression(stmt.Value)
+		} else {
+			r.resolveExpression(stmt.Value)
+			r.declare(stmt.Name)
+		}
+
+	case *ast.ReturnStatement:
+		r.resolveExpression(stmt.ReturnValue)
+
+	case *ast.BlockStatement:
+		r.resolveStatements(stmt.Statements)
+
+	case *ast.WhileStatement:
+		r.resolveExpression(stmt.Condition)
+		r.resolveStatements(stmt.Body.Statements)
+
+	case *ast.ForStatement:
+		r.enterBlock()
+		if stmt.Init != nil {
+			r.resolveStatement(stmt.Init)
+		}
+		if stmt.Condition != nil {
+			r.resolveExpression(stmt.Condition)
+		}
+		if stmt.Post != nil {
+			r.resolveExpression(stmt.Post)
+		}
+		r.resolveStatements(stmt.Body.Statements)
+		r.leaveBlock()
+
+	case *ast.ForInStatement:
+		r.resolveExpression(stmt.Iterable)
+		r.enterBlock()
+		if stmt.Key != nil {
+			r.declare(stmt.Key)
+		}
+		r.declare(stmt.Value)
+		r.resolveStatements(stmt.Body.Statements)
+		r.leaveBlock()
+	}
+}
+
+func (r *resolver) resolveExpression(exp ast.Expression) {
+	switch exp := exp.(type) {
+	case *ast.Identifier:
+		r.resolve(exp, "identifier not found: ")
+
+	case *ast.PrefixExpression:
+		r.resolveExpression(exp.Right)
+
+	case *ast.InfixExpression:
+		r.resolveExpression(exp.Left)
+		r.resolveExpression(exp.Right)
+
+	case *ast.AssignExpression:
+		r.resolveExpression(exp.Value)
+		r.resolve(exp.Name, "cannot assign to undeclared variable: ")
+
+	case *ast.IfExpression:
+		r.resolveExpression(exp.Condition)
+		r.resolveStatements(exp.Consequence.Statements)
+		if exp.Alternative != nil {
+			r.resolveStatements(exp.Alternative.Statements)
+		}
+
+	case *ast.FunctionLiteral:
+		if r.quoted {
+			// only to find the calls to unquote in it
+			r.resolveStatements(exp.Body.Statements)
+			break
+		}
+		current := r.function.blocks[len(r.function.blocks)-1]
+		current.pending = append(current.pending, exp)
+
+	case *ast.CallExpression:
+		// the argument of quote is not evaluated, except for the arguments of calls to unquote in it,
+		// which are evaluated where quote is called
+		if isCallTo(exp, "quote") || (r.quoted && isCallTo(exp, "unquote")) {
+			quoted := r.quoted
+			r.quoted = isCallTo(exp, "quote")
+			for _, arg := range exp.Arguments {
+				r.resolveExpression(arg)
+			}
+			r.quoted = quoted
+			break
+		}
+		r.resolveExpression(exp.Function)
+		for _, arg := range exp.Arguments {
+			r.resolveExpression(arg)
+		}
+
+	case *ast.ArrayLiteral:
+		for _, element := range exp.Elements {
+			r.resolveExpression(element)
+		}
+
+	case *ast.SubscriptExpression:
+		r.resolveExpression(exp.Left)
+		r.resolveExpression(exp.Index)
+
+	case *ast.HashLiteral:
+		for key, value := range exp.Pairs {
+			r.resolveExpression(key)
+			r.resolveExpression(value)
+		}
+	}
+}
+
+// isCallTo reports whether exp calls the function name.
+func isCallTo(exp *ast.CallExpression, name string) bool {
+	ident, ok := exp.Function.(*ast.Identifier)
+	return ok && ident.Value == name
+}
+
+// resolveFunction resolves the body of a function literal in a new scope.
+func (r *resolver) resolveFunction(fl *ast.FunctionLiteral) {
+	r.function = &function{outer: r.function}
+	r.enterBlock()
+
+	for _, param := range fl.Parameters {
+		r.declare(param)
+	}
+	r.resolveStatements(fl.Body.Statements)
+
+	r.leaveBlock()
+	fl.Slots = r.function.slots
+	r.function = r.function.outer
+}
@@ -0,0 +1,161 @@
+package resolver
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/GenericEntity/interpreter-go/monkey/ast"
+	"github.com/GenericEntity/interpreter-go/monkey/lexer"
+	"github.com/GenericEntity/interpreter-go/monkey/parser"
+)
+
+// identifiers returns the identifiers of a program named name, in the order they appear.
+func identifiers(program *ast.Program, name string) []*ast.Identifier {
+	var found []*ast.Identifier
+	ast.Inspect(program, func(node ast.Node) bool {
+		if ident, ok := node.(*ast.Identifier); ok && ident.Value == name {
+			found = append(found, ident)
+		}
+		return true
+	})
+	return found
+}
+
+func parse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors for %q: %v", input, p.Errors())
+	}
+	return program
+}
+
+type resolution struct {
+	scope ast.Scope
+	index int
+	depth int
+}
+
+func TestResolve(t *testing.T) {
+	tests := []struct {
+		input    string
+		name     string
+		expected []resolution // of each identifier named name
+	}{
+		{"let x = 1; x", "x", []resolution{{ast.ScopeGlobal, 0, 0}, {ast.ScopeGlobal, 0, 0}}},
+		{"fn(a, b) { a + b }", "b", []resolution{{ast.ScopeLocal, 1, 0}, {ast.ScopeLocal, 1, 0}}},
+		{"fn(a) { let b = a; b }", "b", []resolution{{ast.ScopeLocal, 1, 0}, {ast.ScopeLocal, 1, 0}}},
+		{"fn(a) { fn() { fn() { a } } }", "a", []resolution{{ast.ScopeLocal, 0, 0}, {ast.ScopeFree, 0, 2}}},
+		{"fn(a) { let a = a + 1; a }", "a", []resolution{
+			{ast.ScopeLocal, 0, 0}, {ast.ScopeLocal, 0, 0}, {ast.ScopeLocal, 0, 0}, {ast.ScopeLocal, 0, 0},
+		}},
+		// the value of a let statement refers to the previous variable with its name
+		{"let a = 1; fn() { let a = a }", "a", []resolution{
+			{ast.ScopeGlobal, 0, 0}, {ast.ScopeLocal, 0, 0}, {ast.ScopeGlobal, 0, 0},
+		}},
+		// loops outside functions have local variables
+		{"for (let i = 0; i < 1; i += 1) { i }", "i", []resolution{
+			{ast.ScopeLocal, 0, 0}, {ast.ScopeLocal, 0, 0}, {ast.ScopeLocal, 0, 0}, {ast.ScopeLocal, 0, 0},
+		}},
+		{"for (k, v in []) { fn() { v } }", "v", []resolution{{ast.ScopeLocal, 1, 0}, {ast.ScopeFree, 1, 1}}},
+		// variables of loops shadow variables outside them
+		{"fn(x) { for (x in []) { x } x }", "x", []resolution{
+			{ast.ScopeLocal, 0, 0}, {ast.ScopeLocal, 1, 0}, {ast.ScopeLocal, 1, 0}, {ast.ScopeLocal, 0, 0},
+		}},
+		// functions refer to variables defined after them
+		{"fn() { let f = fn() { g() }; let g = fn() { 1 } }", "g", []resolution{
+			{ast.ScopeFree, 1, 1}, {ast.ScopeLocal, 1, 0},
+		}},
+		{"let f = fn() { y }; let y = 1;", "y", []resolution{{ast.ScopeGlobal, 0, 0}, {ast.ScopeGlobal, 0, 0}}},
+		// only the arguments of unquote are resolved in quoted expressions
+		{"fn(x) { quote(x + unquote(x)) }", "x", []resolution{
+			{ast.ScopeLocal, 0, 0}, {ast.ScopeUnresolved, 0, 0}, {ast.ScopeLocal, 0, 0},
+		}},
+	}
+
+	for _, tt := range tests {
+		program := parse(t, tt.input)
+		if errs := Resolve(program, nil); len(errs) != 0 {
+			t.Fatalf("unexpected errors for %q: %v", tt.input, errs)
+		}
+
+		idents := identifiers(program, tt.name)
+		if len(idents) != len(tt.expected) {
+			t.Fatalf("wrong number of identifiers %s in %q. expected=%d, got=%d",
+				tt.name, tt.input, len(tt.expected), len(idents))
+		}
+		for i, ident := range idents {
+			got := resolution{ident.Scope, ident.Index, ident.Depth}
+			if got != tt.expected[i] {
+				t.Errorf("wrong resolution of %s %d in %q. expected=%+v, got=%+v",
+					tt.name, i, tt.input, tt.expected[i], got)
+			}
+		}
+	}
+}
+
+func TestSlots(t *testing.T) {
+	program := parse(t, `
+for (x in []) { for (y in []) { } }
+let f = fn(a, b) {
+	let c = 1;
+	let c = 2;
+	for (let i = 0; i < 1; i += 1) { let d = i }
+	fn() { }
+};`)
+	if errs := Resolve(program, nil); len(errs) != 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+
+	if program.Slots != 2 {
+		t.Errorf("wrong number of slots of program. expected=2, got=%d", program.Slots)
+	}
+
+	f := program.Statements[1].(*ast.LetStatement).Value.(*ast.FunctionLiteral)
+	if f.Slots != 5 {
+		t.Errorf("wrong number of slots of f. expected=5, got=%d", f.Slots)
+	}
+
+	body := f.Body.Statements
+	inner := body[len(body)-1].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+	if inner.Slots != 0 {
+		t.Errorf("wrong number of slots of inner function. expected=0, got=%d", inner.Slots)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"x", []string{"1:1: identifier not found: x"}},
+		{"x = 1", []string{"1:1: cannot assign to undeclared variable: x"}},
+		{"len(x)", []string{"1:5: identifier not found: x"}},
+		{"let x = x;", []string{"1:9: identifier not found: x"}},
+		{"x; let x = 1;", []string{"1:1: identifier not found: x"}},
+		{"fn() { a }; b", []string{"1:8: identifier not found: a", "1:13: identifier not found: b"}},
+		{"fn() { for (i in []) { } i }", []string{"1:26: identifier not found: i"}},
+		{"let f = fn() { let g = fn() { 1 }; }; g", []string{"1:39: identifier not found: g"}},
+		{"let f = fn() { g() }; let g = fn() { f() };", nil},
+		{"let add = fn(a, b) { a + b }; add(1, 2)", nil},
+		{"quote(a + fn(b) { let c = d; c })", nil},
+		{"quote(unquote(a))", []string{"1:15: identifier not found: a"}},
+		{"unquote(1)", []string{"1:1: identifier not found: unquote"}},
+	}
+
+	defined := func(name string) bool { return name == "len" }
+
+	for _, tt := range tests {
+		errs := Resolve(parse(t, tt.input), defined)
+
+		var got []string
+		for _, err := range errs {
+			got = append(got, err.Error())
+		}
+		if strings.Join(got, "\n") != strings.Join(tt.expected, "\n") {
+			t.Errorf("wrong errors for %q.\nexpected=%q\n     got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
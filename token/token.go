@@ -1,10 +1,44 @@
 package token
 
+import "fmt"
+
 type TokenType string // not great performance to use string, but is simple and versatile
 
 type Token struct {
 	Type    TokenType
 	Literal string
+	Span    Span // where the token appears in the source code
+}
+
+// Position describes a location in the source code.
+type Position struct {
+	Filename string // empty if the source code did not come from a file
+	Offset   int    // byte offset, starting at 0
+	Line     int    // line number, starting at 1
+	Column   int    // column number, starting at 1 (characters since the start of the line)
+}
+
+// IsValid reports whether the position has been set. The zero Position is invalid.
+func (pos Position) IsValid() bool {
+	return pos.Line > 0
+}
+
+// String formats the position as "file:line:column", or "line:column" if there is no filename.
+func (pos Position) String() string {
+	if !pos.IsValid() {
+		return "-"
+	}
+
+	if pos.Filename == "" {
+		return fmt.Sprintf("%d:%d", pos.Line, pos.Column)
+	}
+	return fmt.Sprintf("%s:%d:%d", pos.Filename, pos.Line, pos.Column)
+}
+
+// Span is a range of source code. Start is inclusive and End is exclusive.
+type Span struct {
+	Start Position
+	End   Position
 }
 
 // Possible token types
@@ -15,6 +49,7 @@ const (
 	// Identifiers + literals
 	IDENT  = "IDENT"
 	INT    = "INT"
+	FLOAT  = "FLOAT"
 	STRING = "STRING"
 
 	// Operators
@@ -23,11 +58,29 @@ const (
 	MINUS    = "-"
 	ASTERISK = "*"
 	SLASH    = "/"
+	PERCENT  = "%"
+	POWER    = "**"
 	LT       = "<"
 	GT       = ">"
+	LT_EQ    = "<="
+	GT_EQ    = ">="
 	BANG     = "!"
 	EQ       = "=="
 	NOT_EQ   = "!="
+	AND      = "&&"
+	OR       = "||"
+
+	PLUS_ASSIGN     = "+="
+	MINUS_ASSIGN    = "-="
+	ASTERISK_ASSIGN = "*="
+	SLASH_ASSIGN    = "/="
+
+	BIT_AND = "&"
+	BIT_OR  = "|"
+	BIT_XOR = "^"
+	BIT_NOT = "~"
+	SHL     = "<<"
+	SHR     = ">>"
 
 	// Delimiters
 	COMMA     = ","
@@ -49,16 +102,28 @@ const (
 	IF       = "IF"
 	ELSE     = "ELSE"
 	RETURN   = "RETURN"
+	WHILE    = "WHILE"
+	FOR      = "FOR"
+	IN       = "IN"
+	BREAK    = "BREAK"
+	CONTINUE = "CONTINUE"
+	MACRO    = "MACRO"
 )
 
 var keywords = map[string]TokenType{
-	"fn":     FUNCTION,
-	"let":    LET,
-	"true":   TRUE,
-	"false":  FALSE,
-	"if":     IF,
-	"else":   ELSE,
-	"return": RETURN,
+	"fn":       FUNCTION,
+	"let":      LET,
+	"true":     TRUE,
+	"false":    FALSE,
+	"if":       IF,
+	"else":     ELSE,
+	"return":   RETURN,
+	"while":    WHILE,
+	"for":      FOR,
+	"in":       IN,
+	"break":    BREAK,
+	"continue": CONTINUE,
+	"macro":    MACRO,
 }
 
 // LookupIdent checks if ident is a keyword, and returns the appropriate TokenType.
@@ -0,0 +1,554 @@
+// Package vm runs programs compiled by the compiler package.
+// Operators, builtins, streams and limits are those of an evaluator.Evaluator,
+// so that programs behave the same as when they are evaluated.
+package vm
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/GenericEntity/interpreter-go/monkey/ast"
+	"github.com/GenericEntity/interpreter-go/monkey/compiler"
+	"github.com/GenericEntity/interpreter-go/monkey/evaluator"
+	"github.com/GenericEntity/interpreter-go/monkey/object"
+)
+
+// Closure is a compiled function together with the environment it was defined in.
+type Closure struct {
+	Fn  *compiler.CompiledFunction
+	env *environment
+}
+
+func (cl *Closure) Type() object.ObjectType { return object.FUNCTION_OBJ }
+func (cl *Closure) Inspect() string {
+	literal := cl.Fn.Literal
+	return (&object.Function{Parameters: literal.Parameters, Body: literal.Body}).Inspect()
+}
+
+// environment holds the local variables of a call. Closures keep the environment they were defined in,
+// so that they share its variables with the function that defined them.
+type environment struct {
+	locals []object.Object
+	names  []string // names of the local variables, for errors
+	outer  *environment
+}
+
+func newEnvironment(fn *compiler.CompiledFunction, outer *environment) *environment {
+	return &environment{locals: make([]object.Object, fn.NumLocals), names: fn.LocalNames, outer: outer}
+}
+
+func (env *environment) out(depth int) *environment {
+	for ; depth > 0; depth-- {
+		env = env.outer
+	}
+	return env
+}
+
+// callSite is the instruction at ip in fn that made a call.
+type callSite struct {
+	fn *compiler.CompiledFunction
+	ip int
+}
+
+func (site callSite) node() *ast.CallExpression {
+	call, _ := site.fn.NodeAt(site.ip).(*ast.CallExpression)
+	return call
+}
+
+// frame is a call in progress.
+type frame struct {
+	fn  *compiler.CompiledFunction
+	env *environment
+	ip  int // offset of the next instruction
+	bp  int // height of the stack when the call was made
+
+	loops []int // heights of the stack recorded by OpLoop, by nesting level
+
+	callee   *Closure // the function called, nil for the program
+	call     callSite // where callee was called
+	tail     *Closure // the function that replaced callee through tail calls, if any
+	tailCall callSite // where tail was called
+}
+
+// iterator is the state of a for-in loop.
+type iterator struct {
+	elements []object.Object // values, for arrays and strings
+	pairs    []object.HashPair
+	hasKey   bool
+	next     int
+}
+
+func (it *iterator) Type() object.ObjectType { return "ITERATOR" }
+func (it *iterator) Inspect() string         { return "iterator" }
+
+type VM struct {
+	evaluator   *evaluator.Evaluator
+	constants   []object.Object
+	globals     []object.Object
+	globalNames []string
+	main        *compiler.CompiledFunction
+
+	stack  []object.Object
+	frames []frame
+	ctx    context.Context
+}
+
+// New returns a VM that runs bytecode with the operators, builtins, streams and limits of e,
+// or of an Evaluator with the default settings if e is nil.
+func New(bytecode *compiler.Bytecode, e *evaluator.Evaluator) *VM {
+	return NewWithGlobals(bytecode, e, nil)
+}
+
+// NewWithGlobals is like New, but starts with the given global variables,
+// e.g. those of a previous program compiled with the same compiler.Globals.
+func NewWithGlobals(bytecode *compiler.Bytecode, e *evaluator.Evaluator, globals []object.Object) *VM {
+	if e == nil {
+		e = evaluator.New()
+	}
+	for len(globals) < len(bytecode.GlobalNames) {
+		globals = append(globals, nil)
+	}
+
+	return &VM{
+		evaluator:   e,
+		constants:   bytecode.Constants,
+		globals:     globals,
+		globalNames: bytecode.GlobalNames,
+		main:        bytecode.Main,
+		stack:       make([]object.Object, 0, 256),
+	}
+}
+
+// Globals returns the global variables, to run later programs with.
+func (vm *VM) Globals() []object.Object {
+	return vm.globals
+}
+
+// Run runs the program, returning the value of its last statement,
+// nil if it ends with a let statement, or the *object.Error it failed with.
+func (vm *VM) Run() object.Object {
+	return vm.RunContext(context.Background())
+}
+
+// RunContext is like Run, but stops the program once ctx is done, like evaluator.Evaluator.EvalContext.
+// The context is checked at every call and backward jump.
+func (vm *VM) RunContext(ctx context.Context) object.Object {
+	vm.ctx = ctx
+	vm.stack = vm.stack[:0]
+	vm.frames = append(vm.frames[:0], frame{fn: vm.main, env: newEnvironment(vm.main, nil)})
+
+	result, err := vm.run()
+	if err != nil {
+		return vm.fail(err)
+	}
+	return result
+}
+
+func (vm *VM) push(obj object.Object) {
+	vm.stack = append(vm.stack, obj)
+}
+
+func (vm *VM) pop() object.Object {
+	obj := vm.stack[len(vm.stack)-1]
+	vm.stack = vm.stack[:len(vm.stack)-1]
+	return obj
+}
+
+func (vm *VM) maxDepth() int {
+	if vm.evaluator.MaxDepth == 0 {
+		return evaluator.DefaultMaxDepth
+	}
+	return vm.evaluator.MaxDepth
+}
+
+// run executes instructions until the program returns or fails.
+func (vm *VM) run() (object.Object, *object.Error) {
+	for {
+		f := &vm.frames[len(vm.frames)-1]
+		ins := f.fn.Instructions
+		ip := f.ip
+		op := compiler.Opcode(ins[ip])
+
+		if err := vm.evaluator.Step(); err != nil {
+			// errors are located at the instruction before the ip, which is past the opcode while it runs
+			f.ip++
+			return nil, err
+		}
+
+		var result object.Object
+
+		switch op {
+		case compiler.OpConstant:
+			f.ip += 3
+			// string literals count as allocating their string, like in the evaluator
+			result = vm.evaluator.Allocate(vm.constants[compiler.ReadUint16(ins[ip+1:])])
+
+		case compiler.OpPop:
+			f.ip++
+			vm.pop()
+
+		case compiler.OpTrue:
+			f.ip++
+			vm.push(evaluator.TRUE)
+
+		case compiler.OpFalse:
+			f.ip++
+			vm.push(evaluator.FALSE)
+
+		case compiler.OpNull:
+			f.ip++
+			vm.push(evaluator.NULL)
+
+		case compiler.OpInfix:
+			f.ip += 2
+			right := vm.pop()
+			left := vm.pop()
+			result = vm.evaluator.Infix(compiler.Operators[ins[ip+1]], left, right)
+
+		case compiler.OpPrefix:
+			f.ip += 2
+			result = vm.evaluator.Prefix(compiler.Operators[ins[ip+1]], vm.pop())
+
+		case compiler.OpJump:
+			target := int(compiler.ReadUint16(ins[ip+1:]))
+			f.ip = target
+			if target < ip {
+				if err := vm.checkContext(); err != nil {
+					return nil, err
+				}
+			}
+
+		case compiler.OpJumpNotTruthy, compiler.OpJumpTruthy:
+			f.ip += 3
+			if evaluator.IsTruthy(vm.pop()) == (op == compiler.OpJumpTruthy) {
+				f.ip = int(compiler.ReadUint16(ins[ip+1:]))
+			}
+
+		case compiler.OpGetGlobal:
+			f.ip += 3
+			result = vm.getGlobal(int(compiler.ReadUint16(ins[ip+1:])))
+
+		case compiler.OpSetGlobal:
+			f.ip += 3
+			vm.globals[compiler.ReadUint16(ins[ip+1:])] = vm.pop()
+
+		case compiler.OpGetLocal:
+			f.ip += 3
+			result = getLocal(f.env, int(compiler.ReadUint16(ins[ip+1:])))
+
+		case compiler.OpSetLocal:
+			f.ip += 3
+			f.env.locals[compiler.ReadUint16(ins[ip+1:])] = vm.pop()
+
+		case compiler.OpGetOuter:
+			f.ip += 4
+			env := f.env.out(int(ins[ip+1]))
+			result = getLocal(env, int(compiler.ReadUint16(ins[ip+2:])))
+
+		case compiler.OpAssignGlobal:
+			f.ip += 4
+			index := int(compiler.ReadUint16(ins[ip+1:]))
+			result = vm.assign(&vm.globals[index], vm.globalNames[index], ins[ip+3])
+
+		case compiler.OpAssignLocal:
+			f.ip += 4
+			index := int(compiler.ReadUint16(ins[ip+1:]))
+			result = vm.assign(&f.env.locals[index], f.env.names[index], ins[ip+3])
+
+		case compiler.OpAssignOuter:
+			f.ip += 5
+			env := f.env.out(int(ins[ip+1]))
+			index := int(compiler.ReadUint16(ins[ip+2:]))
+			result = vm.assign(&env.locals[index], env.names[index], ins[ip+4])
+
+		case compiler.OpArray:
+			f.ip += 3
+			n := int(compiler.ReadUint16(ins[ip+1:]))
+			elements := make([]object.Object, n)
+			copy(elements, vm.stack[len(vm.stack)-n:])
+			vm.stack = vm.stack[:len(vm.stack)-n]
+			result = vm.evaluator.Allocate(&object.Array{Elements: elements})
+
+		case compiler.OpHash:
+			f.ip += 3
+			n := 2 * int(compiler.ReadUint16(ins[ip+1:]))
+			result = vm.evaluator.Allocate(buildHash(vm.stack[len(vm.stack)-n:]))
+			vm.stack = vm.stack[:len(vm.stack)-n]
+
+		case compiler.OpIndex:
+			f.ip++
+			index := vm.pop()
+			result = evaluator.Index(vm.pop(), index)
+
+		case compiler.OpCall, compiler.OpTailCall:
+			f.ip += 2
+			if err := vm.call(int(ins[ip+1]), callSite{fn: f.fn, ip: ip}, op == compiler.OpTailCall); err != nil {
+				return nil, err
+			}
+
+		case compiler.OpReturnValue, compiler.OpReturn:
+			var value object.Object
+			if op == compiler.OpReturnValue {
+				value = vm.pop()
+			} else if len(vm.frames) > 1 {
+				value = evaluator.NULL
+			}
+
+			if len(vm.frames) == 1 {
+				return value, nil
+			}
+
+			vm.stack = vm.stack[:f.bp]
+			vm.frames = vm.frames[:len(vm.frames)-1]
+			vm.push(value)
+
+		case compiler.OpClosure:
+			f.ip += 3
+			fn := vm.constants[compiler.ReadUint16(ins[ip+1:])].(*compiler.CompiledFunction)
+			vm.push(&Closure{Fn: fn, env: f.env})
+
+		case compiler.OpIter:
+			f.ip += 2
+			result = newIterator(vm.pop(), ins[ip+1] == 1)
+
+		case compiler.OpIterNext:
+			f.ip += 3
+			it := vm.stack[len(vm.stack)-1].(*iterator)
+			if !vm.iterate(it) {
+				f.ip = int(compiler.ReadUint16(ins[ip+1:]))
+			}
+			if err := vm.checkContext(); err != nil {
+				return nil, err
+			}
+
+		case compiler.OpLoop:
+			f.ip += 2
+			f.loops = append(f.loops[:ins[ip+1]], len(vm.stack))
+
+		case compiler.OpUnwind:
+			f.ip += 2
+			vm.stack = vm.stack[:f.loops[ins[ip+1]]]
+
+		default:
+			panic(fmt.Sprintf("unknown opcode %d", op))
+		}
+
+		if result != nil {
+			if err, ok := result.(*object.Error); ok {
+				return nil, err
+			}
+			vm.push(result)
+		}
+	}
+}
+
+func (vm *VM) getGlobal(index int) object.Object {
+	if value := vm.globals[index]; value != nil {
+		return value
+	}
+
+	name := vm.globalNames[index]
+	if builtin, ok := vm.evaluator.LookupBuiltin(name); ok {
+		return builtin
+	}
+	return &object.Error{Message: "identifier not found: " + name}
+}
+
+// getLocal returns a local variable, which is not set if its let statement has not run yet.
+func getLocal(env *environment, index int) object.Object {
+	if value := env.locals[index]; value != nil {
+		return value
+	}
+	return &object.Error{Message: "identifier not found: " + env.names[index]}
+}
+
+// assign sets variable to the value on top of the stack, combined with its current value if operator
+// is not 0, and returns the new value.
+func (vm *VM) assign(variable *object.Object, name string, operator byte) object.Object {
+	value := vm.pop()
+	if *variable == nil {
+		return &object.Error{Message: "cannot assign to undeclared variable: " + name}
+	}
+
+	if operator != 0 {
+		value = vm.evaluator.Infix(compiler.Operators[operator-1], *variable, value)
+		if _, ok := value.(*object.Error); ok {
+			return value
+		}
+	}
+
+	*variable = value
+	return value
+}
+
+func buildHash(elements []object.Object) object.Object {
+	pairs := make(map[object.HashKey]object.HashPair, len(elements)/2)
+	for i := 0; i < len(elements); i += 2 {
+		key, value := elements[i], elements[i+1]
+
+		hashable, ok := key.(object.Hashable)
+		if !ok {
+			return &object.Error{Message: "invalid key type: " + string(key.Type())}
+		}
+		if _, ok := pairs[hashable.HashKey()]; ok {
+			return &object.Error{Message: "duplicate key: " + key.Inspect()}
+		}
+		pairs[hashable.HashKey()] = object.HashPair{Key: key, Value: value}
+	}
+	return &object.Hash{Pairs: pairs}
+}
+
+// newIterator returns an iterator over the elements of an array, the characters of a string,
+// or the pairs of a hash (in the order of their keys), like in the evaluator.
+func newIterator(iterable object.Object, hasKey bool) object.Object {
+	it := &iterator{hasKey: hasKey}
+
+	switch iterable := iterable.(type) {
+	case *object.Array:
+		it.elements = iterable.Elements
+	case *object.String:
+		for _, ch := range iterable.Value {
+			it.elements = append(it.elements, &object.String{Value: string(ch)})
+		}
+	case *object.Hash:
+		it.pairs = evaluator.SortedHashPairs(iterable)
+	default:
+		return &object.Error{Message: "cannot iterate over " + string(iterable.Type())}
+	}
+
+	return it
+}
+
+// iterate pushes the next value, and key if the loop has a key variable, of it.
+// It returns false if there are no more.
+func (vm *VM) iterate(it *iterator) bool {
+	var key, value object.Object
+
+	switch {
+	case it.pairs != nil && it.next < len(it.pairs):
+		// a single loop variable is bound to the keys
+		key, value = it.pairs[it.next].Key, it.pairs[it.next].Key
+		if it.hasKey {
+			value = it.pairs[it.next].Value
+		}
+	case it.pairs == nil && it.next < len(it.elements):
+		key, value = &object.Integer{Value: int64(it.next)}, it.elements[it.next]
+	default:
+		return false
+	}
+
+	it.next++
+	vm.push(value)
+	if it.hasKey {
+		vm.push(key)
+	}
+	return true
+}
+
+// call calls the function below the arguments on top of the stack.
+// A tail call replaces the frame of the calling function.
+func (vm *VM) call(numArgs int, site callSite, tail bool) *object.Error {
+	args := vm.stack[len(vm.stack)-numArgs:]
+	fn := vm.stack[len(vm.stack)-numArgs-1]
+
+	switch fn := fn.(type) {
+	case *Closure:
+		if err := vm.checkCall(fn, numArgs); err != nil {
+			// the call is in the stack trace, like in the evaluator
+			err.Span = site.node().Span()
+			vm.frames = append(vm.frames, frame{fn: fn.Fn, callee: fn, call: site})
+			return err
+		}
+
+		env := newEnvironment(fn.Fn, fn.env)
+		copy(env.locals, args)
+		vm.stack = vm.stack[:len(vm.stack)-numArgs-1]
+
+		if tail {
+			f := &vm.frames[len(vm.frames)-1]
+			vm.stack = vm.stack[:f.bp]
+			f.fn, f.env, f.ip = fn.Fn, env, 0
+			f.tail, f.tailCall = fn, site
+			return nil
+		}
+
+		vm.frames = append(vm.frames, frame{fn: fn.Fn, env: env, bp: len(vm.stack), callee: fn, call: site})
+		return nil
+
+	case *object.Builtin:
+		// builtins may keep their arguments, which must not change as the stack does
+		args = append([]object.Object(nil), args...)
+		// builtins that return an existing array, hash or string count as allocating it
+		result := vm.evaluator.Allocate(fn.Fn(args...))
+		vm.stack = vm.stack[:len(vm.stack)-numArgs-1]
+		if err, ok := result.(*object.Error); ok {
+			return err
+		}
+		vm.push(result)
+		return nil
+
+	default:
+		return &object.Error{Message: "not a function: " + string(fn.Type())}
+	}
+}
+
+// checkCall returns an error if fn cannot be called with numArgs arguments.
+func (vm *VM) checkCall(fn *Closure, numArgs int) *object.Error {
+	if fn.Fn.NumParameters != numArgs {
+		return &object.Error{Message: fmt.Sprintf("wrong number of arguments to function. expected=%d, got=%d",
+			fn.Fn.NumParameters, numArgs)}
+	}
+	if err := vm.checkContext(); err != nil {
+		return err
+	}
+	if len(vm.frames)-1 >= vm.maxDepth() {
+		return &object.Error{Message: evaluator.ErrMaxDepth.Error(), Err: evaluator.ErrMaxDepth}
+	}
+	return nil
+}
+
+// checkContext returns an error if the context of the program is done.
+func (vm *VM) checkContext() *object.Error {
+	select {
+	case <-vm.ctx.Done():
+		err := vm.ctx.Err()
+		return &object.Error{Message: "evaluation stopped: " + err.Error(), Err: err}
+	default:
+		return nil
+	}
+}
+
+// fail locates err at the instruction being run, and adds the calls in progress to its stack trace,
+// innermost first, like the evaluator.
+func (vm *VM) fail(err *object.Error) *object.Error {
+	// the instruction being run starts before the ip of the frame, which is past its operands
+	top := vm.frames[len(vm.frames)-1]
+	if node := top.fn.NodeAt(top.ip - 1); node != nil && !err.Span.Start.IsValid() {
+		err.Span = node.Span()
+	}
+
+	for i := len(vm.frames) - 1; i > 0; i-- {
+		f := vm.frames[i]
+		if f.tail != nil {
+			err.Stack = append(err.Stack, stackFrame(f.tail, f.tailCall))
+		}
+		err.Stack = append(err.Stack, stackFrame(f.callee, f.call))
+	}
+
+	return err
+}
+
+func stackFrame(fn *Closure, site callSite) object.StackFrame {
+	call := site.node()
+
+	name := fn.Fn.Name
+	if name == "" {
+		if ident, ok := call.Function.(*ast.Identifier); ok {
+			name = ident.Value
+		} else {
+			name = "<anonymous function>"
+		}
+	}
+
+	return object.StackFrame{Function: name, Call: call.Span()}
+}
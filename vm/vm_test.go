@@ -0,0 +1,282 @@
+package vm
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/GenericEntity/interpreter-go/monkey/compiler"
+	"github.com/GenericEntity/interpreter-go/monkey/evaluator"
+	"github.com/GenericEntity/interpreter-go/monkey/lexer"
+	"github.com/GenericEntity/interpreter-go/monkey/object"
+	"github.com/GenericEntity/interpreter-go/monkey/parser"
+	"github.com/GenericEntity/interpreter-go/monkey/resolver"
+)
+
+func run(t *testing.T, e *evaluator.Evaluator, input string) object.Object {
+	t.Helper()
+
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors for %q: %v", input, p.Errors())
+	}
+
+	// report undefined variables before running the program, like the evaluator
+	defined := func(name string) bool {
+		_, ok := e.LookupBuiltin(name)
+		return ok
+	}
+	if errs := resolver.Resolve(program, defined); len(errs) != 0 {
+		return &object.Error{Message: errs[0].Message, Span: errs[0].Span}
+	}
+
+	c := compiler.New()
+	if err := c.Compile(program); err != nil {
+		t.Fatalf("compiler error for %q: %s", input, err)
+	}
+
+	return New(c.Bytecode(), e).Run()
+}
+
+func evaluate(input string, e *evaluator.Evaluator) object.Object {
+	program := parser.New(lexer.New(input)).ParseProgram()
+	return e.Eval(program, object.NewEnvironment())
+}
+
+// describe describes the result of a program, to compare the VM with the evaluator.
+func describe(obj object.Object) string {
+	switch obj := obj.(type) {
+	case nil:
+		// the evaluator has no value where the vm has null, like for empty blocks
+		return describe(evaluator.NULL)
+	case *object.Error:
+		return obj.Traceback()
+	case *object.Hash:
+		// hashes are inspected in random order
+		var out strings.Builder
+		for _, pair := range evaluator.SortedHashPairs(obj) {
+			out.WriteString(pair.Key.Inspect() + ": " + describe(pair.Value) + ", ")
+		}
+		return "{" + out.String() + "}"
+	default:
+		return string(obj.Type()) + " " + obj.Inspect()
+	}
+}
+
+// tests are run by both the VM and the evaluator, which must give the same results.
+var tests = []string{
+	// literals and operators
+	"5", "-5", "2.5", `"monkey"`, "true", "!true", "!5", "~5",
+	"1 + 2 * 3 - 4 / 2", "7 % 3", "2 ** 10", "2 ** 0.5", "1 + 2.5", "10 / 4.0",
+	"5 & 3", "5 | 3", "5 ^ 3", "1 << 10", "1024 >> 3",
+	"1 < 2", "1 > 2", "1 <= 1", "2 >= 3", "1 == 1", "1 != 1", "true == true", "true != false",
+	`"a" + "b"`, `"a" < "b"`, `"a" == "a"`,
+	"9223372036854775807 + 1", "-9223372036854775807 - 2", "3037000500 * 3037000500",
+	"100000000000000000000", "100000000000000000000 / 3", "-9223372036854775808",
+	"true && false", "true || false", "1 && 2", "0 || false", "false && 1 + true", "true || -true",
+
+	// conditionals
+	"if (true) { 10 }", "if (false) { 10 }", "if (1 < 2) { 10 } else { 20 }", "if (1 > 2) { 10 } else { 20 }",
+	"if (true) { }", "if (true) { let x = 1; }",
+
+	// variables
+	"let a = 5; a", "let a = 5; let b = a; let c = a + b + 5; c", "let a = 1;", "let a = 1; let a = a + 1; a",
+	"let x = 1; x = 2; x", "let x = 1; x += 2; x *= 3; x -= 1; x /= 2; x",
+	"let x = 1; let y = (x = 5) + 1; [x, y]",
+
+	// arrays, hashes and subscripts
+	"[1, 2 * 2, 3 + 3]", "[]", "[1, 2, 3][1]", "[1, 2, 3][3]", "[1, 2, 3][-1]", "let a = [1, [2]]; a[1][0]",
+	`{"one": 1, "two": 2, true: 3, 4: 4}`, `{"a": 1}["a"]`, `{"a": 1}["b"]`, `{}`, `let k = "a"; {k: 1}[k]`,
+
+	// functions and closures
+	"let identity = fn(x) { x; }; identity(5);", "let add = fn(a, b) { a + b }; add(5, add(5, 5))",
+	"fn(x) { x; }(5)", "let f = fn() { return 1; 2 }; f()", "let f = fn() { }; f()",
+	"let f = fn() { let x = 1; }; f()",
+	"let newAdder = fn(x) { fn(y) { x + y } }; let addTwo = newAdder(2); addTwo(3)",
+	"let counter = fn() { let n = 0; fn() { n += 1; n } }; let c = counter(); c(); c(); c()",
+	"let a = fn() { let b = fn() { let c = fn() { x }; c() }; b() }; let x = 7; a()",
+	"let f = fn(n) { if (n == 0) { 0 } else { n + f(n - 1) } }; f(100)",
+	"let even = fn(n) { if (n == 0) { true } else { odd(n - 1) } }; let odd = fn(n) { if (n == 0) { false } else { even(n - 1) } }; even(10)",
+	"let outer = fn() { let inner = fn() { inner2() }; let inner2 = fn() { 42 }; inner() }; outer()",
+	"let f = fn(x) { x }; f", "let f = fn(g) { g(2) }; f(fn(x) { x * 3 })",
+	"let x = 10; let f = fn() { x = x + 1 }; f(); f(); x",
+	"let f = fn() { if (false) { let len = 1 }; len }; f()",
+	"let x = 1; let f = fn() { let g = fn() { x }; let r = g(); let x = 2; [r, g()] }; f()",
+	"let x = 1; let f = fn() { x = 5; let x = 2; x }; [f(), x]",
+	"let f = fn() { let x = x; x }; f()",
+
+	// returns
+	"return 10; 9;", "9; return 2 * 5; 9;", "if (10 > 1) { if (10 > 1) { return 10; } return 1; }",
+
+	// tail calls
+	"let count = fn(n) { if (n == 0) { 0 } else { count(n - 1) } }; count(100000)",
+	"let sum = fn(n, acc) { if (n == 0) { return acc; } return sum(n - 1, acc + n); }; sum(100000, 0)",
+
+	// builtins
+	`len("four")`, "len([1, 2])", "first([1, 2])", "last([1, 2])", "rest([1, 2])", "push([1], 2)",
+	`put({}, "a", 1)["a"]`, `int("42")`, "float(1)", "str(12)", "let len = fn(x) { 0 }; len([1])",
+
+	// loops
+	"let i = 0; while (i < 10) { i += 1 } i", "let i = 0; while (i < 10) { i += 1 }",
+	"let s = 0; for (let i = 0; i < 10; i += 1) { s += i } s",
+	"let s = 0; for (let i = 0; i < 10; i += 1) { if (i % 2 == 0) { continue } if (i > 7) { break } s += i } s",
+	"let s = 0; for (;;) { s += 1; if (s == 5) { break } } s",
+	"let s = 0; for (x in [1, 2, 3]) { s += x } s",
+	"let s = 0; for (i, x in [10, 20, 30]) { s += i * x } s",
+	`let s = ""; for (c in "héllo") { s = c + s } s`,
+	`let s = ""; for (i, c in "ab") { s += str(i) + c } s`,
+	`let s = ""; for (k in {"b": 1, "a": 2}) { s += k } s`,
+	`let s = 0; for (k, v in {"b": 1, "a": 2}) { s += v } s`,
+	"let s = 0; for (x in [1, 2, 3]) { if (x == 2) { continue } s += x } s",
+	"let s = 0; for (x in [1, 2, 3]) { for (y in [1, 2, 3]) { if (y == 2) { break } s += x * y } } s",
+	"let f = fn() { for (x in [1, 2, 3]) { if (x == 2) { return x } } }; f()",
+	"let fs = []; for (let i = 0; i < 3; i += 1) { fs = push(fs, fn() { i }) } fs[0]()",
+	"for (x in [1]) { let y = x } y",
+	"let i = 0; while (true) { i += 1; if (i > 3) { break } } i",
+	// break and continue discard the operands of the expressions they are in
+	"let s = []; for (x in [1, 2, 3]) { s = push(s, if (x == 2) { break } else { x }) } s",
+	"let s = 0; for (x in [1, 2, 3]) { s += (if (x == 2) { continue } else { x }) } s",
+	"let f = fn(a, b) { a + b }; let s = 0; for (x in [1, 2, 3]) { s += f(1, if (x == 1) { continue } else { x }) } s",
+	"let f = fn(a, b) { a + b }; let s = 0; for (x in [1, 2]) { for (y in [1, 2]) { s += f(x, if (y == 1) { continue } else { y }) } } s",
+	"let i = 0; let s = []; while (i < 5) { i += 1; s = push(s, [i, if (i % 2 == 0) { continue } else { i }]) } s",
+	"let s = []; for (let i = 0; i < 5; i += 1) { s = push(s, -(if (i == 3) { break } else { i })) } s",
+	"let f = fn(xs) { let s = 0; for (x in xs) { s += (if (x == 2) { continue } else { x }) } s }; f([1, 2, 3])",
+	// the head of a loop belongs to the enclosing loop
+	"let n = 0; for (x in [1, 2, 3]) { while (if (x == 2) { break } else { false }) { } n += x } n",
+	"let n = 0; for (x in [1, 2, 3]) { for (let i = 0; i < 2; if (x == 2) { break } else { i += 1 }) { n += 1 } } n",
+
+	// errors
+	"5 + true;", "5 + true; 5;", "-true", "true + false;", `"Hello" - "World"`, "foobar", "x = 1", "x += 1",
+	`{"name": "Monkey"}[fn(x) { x }];`, `{[1]: 1}`, "1[0]", "let f = fn(x) { x }; f()", "5()",
+	`len(1)`, `len("a", "b")`, "1 / 0", "1 % 0", "1 << -1", "for (x in 1) { }",
+	"let f = fn() { 1 + true }; let g = fn() { f() }; g()",
+	"let f = fn() { 1 + true }; let g = fn() { let r = f(); r }; g()",
+	"let f = fn(n) { if (n == 0) { 1 + true } else { f(n - 1) } }; let g = fn() { let r = f(3); r }; g()",
+	"let f = fn(n) { 1 + f(n + 1) }; f(0)",
+	"let f = fn(x) { x }; let g = fn() { f() }; g()",
+}
+
+func TestVMMatchesEvaluator(t *testing.T) {
+	for _, input := range tests {
+		expected := describe(evaluate(input, evaluator.New()))
+		got := describe(run(t, evaluator.New(), input))
+		if got != expected {
+			t.Errorf("wrong result for %q.\nexpected=%s\n     got=%s", input, expected, got)
+		}
+	}
+}
+
+func TestOptions(t *testing.T) {
+	var out bytes.Buffer
+	e := &evaluator.Evaluator{Stdout: &out, Stdin: strings.NewReader("input\n"), CheckedArithmetic: true, MaxDepth: 50}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`puts(readline())`, "NULL null"},
+		{"9223372036854775807 + 1", "ERROR: 1:1: integer overflow: 9223372036854775807 + 1"},
+		{"let f = fn(n) { if (n == 0) { 0 } else { 1 + f(n - 1) } }; f(49)", "INTEGER 49"},
+		{"let f = fn(n) { if (n == 0) { 0 } else { 1 + f(n - 1) } }; f(50)", "maximum recursion depth exceeded"},
+	}
+
+	for _, tt := range tests {
+		got := describe(run(t, e, tt.input))
+		if !strings.HasPrefix(got, tt.expected) && !strings.HasSuffix(got, tt.expected) {
+			t.Errorf("wrong result for %q. expected=%s, got=%s", tt.input, tt.expected, got)
+		}
+	}
+
+	if out.String() != "input\n" {
+		t.Errorf("wrong output. expected=%q, got=%q", "input\n", out.String())
+	}
+
+	e = evaluator.New()
+	e.Builtins = evaluator.NewRegistry()
+	if got := describe(run(t, e, "len([])")); got != "ERROR: 1:1: identifier not found: len" {
+		t.Errorf("builtin registry not used. got=%s", got)
+	}
+}
+
+func TestBuiltinsKeepArguments(t *testing.T) {
+	var kept []object.Object
+	e := evaluator.New()
+	e.Builtins = e.DefaultBuiltins()
+	e.Builtins.Register("keep", func(args ...object.Object) object.Object {
+		kept = args
+		return evaluator.NULL
+	})
+
+	run(t, e, "keep(1, 2); [3, 4, 5]")
+	if len(kept) != 2 || kept[0].Inspect() != "1" || kept[1].Inspect() != "2" {
+		t.Errorf("arguments changed after the call. expected=[1 2], got=%v", kept)
+	}
+}
+
+func TestRunContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	for _, input := range []string{"while (true) { }", "for (x in [1, 2]) { }", "let f = fn() { f() }; f()"} {
+		p := parser.New(lexer.New(input))
+		c := compiler.New()
+		if err := c.Compile(p.ParseProgram()); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		result, ok := New(c.Bytecode(), nil).RunContext(ctx).(*object.Error)
+		if !ok || result.Err != context.Canceled {
+			t.Errorf("program not stopped for %q. got=%v", input, result)
+		}
+	}
+}
+
+func TestLoopsLeaveNoOperands(t *testing.T) {
+	for _, input := range []string{
+		"let i = 0; while (i < 5) { i += 1; [i, if (i % 2 == 0) { continue } else { i }] } i",
+		"let s = 0; for (let i = 0; i < 5; i += 1) { s += [i, if (i == 3) { break } else { i }][1] } s",
+		"let s = 0; for (x in [1, 2, 3]) { s += -(if (x == 2) { continue } else { x }) } s",
+	} {
+		p := parser.New(lexer.New(input))
+		c := compiler.New()
+		if err := c.Compile(p.ParseProgram()); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		machine := New(c.Bytecode(), nil)
+		machine.Run()
+		if len(machine.stack) != 0 {
+			t.Errorf("operands left on the stack for %q: %v", input, machine.stack)
+		}
+	}
+}
+
+func TestGlobalsBetweenPrograms(t *testing.T) {
+	globals := compiler.NewGlobals()
+	var constants []object.Object
+	var values []object.Object
+
+	for _, tt := range []struct{ input, expected string }{
+		{"let x = 1;", "NULL null"},
+		{"let f = fn() { x + y };", "NULL null"},
+		{"let y = 2; f()", "INTEGER 3"},
+		{"x = 10; f()", "INTEGER 12"},
+	} {
+		c := compiler.NewWithState(globals, constants)
+		if err := c.Compile(parser.New(lexer.New(tt.input)).ParseProgram()); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		bytecode := c.Bytecode()
+		constants = bytecode.Constants
+
+		machine := NewWithGlobals(bytecode, nil, values)
+		got := describe(machine.Run())
+		values = machine.Globals()
+
+		if got != tt.expected {
+			t.Errorf("wrong result for %q. expected=%s, got=%s", tt.input, tt.expected, got)
+		}
+	}
+}